@@ -0,0 +1,260 @@
+// Package audit keeps API audit records somewhere more durable than log files.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"telescope/database"
+	"telescope/lifecycle"
+	"telescope/metric"
+	"time"
+
+	"github.com/segmentio/stats/v4"
+	"go.uber.org/atomic"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueueSize = 10000
+	defaultBatchSize = 500
+	// writeTimeout of a batch or a pruning
+	writeTimeout = time.Minute
+)
+
+// Sink receives audit records of API calls
+type Sink interface {
+	// Write queues record for saving, it never blocks the request.
+	// record must not be modified afterwards.
+	Write(record *database.AuditRecord)
+}
+
+// Config of audit records saved in Postgres
+type Config struct {
+	// Enabled saves audit records to Postgres besides log
+	Enabled bool
+	// QueueSize records are waiting to be saved at most, more are dropped, defaults to 10000
+	QueueSize int
+	// BatchSize records are inserted in one statement at most, defaults to 500
+	BatchSize int
+	// FlushIntervalMilliseconds records are held before saving at most, defaults to 1000
+	FlushIntervalMilliseconds int
+	// RetentionDays records older are pruned, 0 keeps them forever
+	RetentionDays int
+	// PruneIntervalMinutes between prunings, defaults to 60
+	PruneIntervalMinutes int
+}
+
+func (c Config) withDefaults() Config {
+	if c.QueueSize <= 0 {
+		c.QueueSize = defaultQueueSize
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = defaultBatchSize
+	}
+	if c.FlushIntervalMilliseconds <= 0 {
+		c.FlushIntervalMilliseconds = 1000
+	}
+	if c.PruneIntervalMinutes <= 0 {
+		c.PruneIntervalMinutes = 60
+	}
+
+	return c
+}
+
+func (c Config) flushInterval() time.Duration {
+	return time.Duration(c.FlushIntervalMilliseconds) * time.Millisecond
+}
+
+func (c Config) pruneInterval() time.Duration {
+	return time.Duration(c.PruneIntervalMinutes) * time.Minute
+}
+
+func (c Config) retention() time.Duration {
+	return time.Duration(c.RetentionDays) * 24 * time.Hour
+}
+
+// store is implemented by *database.DB
+type store interface {
+	InsertAuditRecords(ctx context.Context, records []*database.AuditRecord) (err error)
+	PruneAuditRecords(ctx context.Context, before time.Time) (deleted int, err error)
+}
+
+// PostgresSink saves records in batches asynchronously.
+//
+// Records are dropped and counted when queue is full,
+// so that a slow database never slows down the API.
+type PostgresSink struct {
+	store  store
+	config Config
+	metric *metric.Collector
+	logger *zap.Logger
+
+	queue chan *database.AuditRecord
+	// stopping is set when Stop is called, records written afterwards are dropped
+	stopping atomic.Bool
+	stopOnce sync.Once
+	// done is closed on stopping
+	done chan struct{}
+	// flushed is closed when queue is drained on stopping
+	flushed chan struct{}
+}
+
+// NewPostgresSink creates a sink saving into db, which is usually a *database.DB.
+// Call Start to make it work, or use Register.
+func NewPostgresSink(db store, config Config, collector *metric.Collector, logger *zap.Logger) *PostgresSink {
+	config = config.withDefaults()
+	if collector == nil {
+		collector = metric.NewNopCollector()
+	}
+
+	return &PostgresSink{
+		store:   db,
+		config:  config,
+		metric:  collector,
+		logger:  logger,
+		queue:   make(chan *database.AuditRecord, config.QueueSize),
+		done:    make(chan struct{}),
+		flushed: make(chan struct{}),
+	}
+}
+
+// Register hooks sink on lc as a worker,
+// which stops after API server so that no record is missing.
+func (s *PostgresSink) Register(lc *lifecycle.Manager) {
+	lc.Append(lifecycle.Hook{
+		Name:     "audit sink",
+		Priority: lifecycle.PriorityWorker,
+		Start: func(context.Context) error {
+			s.Start()
+			return nil
+		},
+		Stop: s.Stop,
+	})
+}
+
+// Write queues record, which is dropped if queue is full
+func (s *PostgresSink) Write(record *database.AuditRecord) {
+	if s.stopping.Load() {
+		s.metric.Incr(metric.AuditRecordsTotal, stats.T("result", "dropped"))
+		return
+	}
+
+	select {
+	case s.queue <- record:
+	default:
+		s.metric.Incr(metric.AuditRecordsTotal, stats.T("result", "dropped"))
+	}
+}
+
+// Start saves queued records and prunes expired ones in background
+func (s *PostgresSink) Start() {
+	go s.run()
+	if s.config.RetentionDays > 0 {
+		go s.pruneRegularly()
+	}
+}
+
+// Stop saves records left in queue, waiting until done or ctx ends.
+func (s *PostgresSink) Stop(ctx context.Context) (err error) {
+	s.stopOnce.Do(func() {
+		s.stopping.Store(true)
+		close(s.done)
+	})
+
+	select {
+	case <-s.flushed:
+	case <-ctx.Done():
+		err = fmt.Errorf("waiting for audit records to be saved: %w", ctx.Err())
+	}
+
+	return
+}
+
+func (s *PostgresSink) run() {
+	defer close(s.flushed)
+
+	ticker := time.NewTicker(s.config.flushInterval())
+	defer ticker.Stop()
+
+	batch := make([]*database.AuditRecord, 0, s.config.BatchSize)
+	for {
+		select {
+		case record := <-s.queue:
+			batch = append(batch, record)
+			if len(batch) >= s.config.BatchSize {
+				batch = s.flush(batch)
+			}
+		case <-ticker.C:
+			batch = s.flush(batch)
+		case <-s.done:
+			for {
+				select {
+				case record := <-s.queue:
+					batch = append(batch, record)
+					if len(batch) >= s.config.BatchSize {
+						batch = s.flush(batch)
+					}
+				default:
+					s.flush(batch)
+					return
+				}
+			}
+		}
+	}
+}
+
+// flush saves batch and returns it emptied for reuse
+func (s *PostgresSink) flush(batch []*database.AuditRecord) []*database.AuditRecord {
+	s.metric.Set(metric.AuditQueueLength, len(s.queue))
+	if len(batch) == 0 {
+		return batch
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	err := s.store.InsertAuditRecords(ctx, batch)
+	if err != nil {
+		s.logger.Error("saving audit records", zap.Int("count", len(batch)), zap.Error(err))
+		s.metric.Add(metric.AuditRecordsTotal, len(batch), stats.T("result", "failed"))
+	} else {
+		s.metric.Add(metric.AuditRecordsTotal, len(batch), stats.T("result", "written"))
+	}
+
+	for i := range batch {
+		batch[i] = nil
+	}
+	return batch[:0]
+}
+
+func (s *PostgresSink) pruneRegularly() {
+	ticker := time.NewTicker(s.config.pruneInterval())
+	defer ticker.Stop()
+
+	for {
+		s.prune(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// prune deletes records older than retention at now
+func (s *PostgresSink) prune(now time.Time) {
+	ctx, cancel := context.WithTimeout(context.Background(), writeTimeout)
+	defer cancel()
+
+	before := now.Add(-s.config.retention())
+	deleted, err := s.store.PruneAuditRecords(ctx, before)
+	if err != nil {
+		s.logger.Error("pruning audit records", zap.Time("before", before), zap.Error(err))
+		return
+	}
+	if deleted > 0 {
+		s.logger.Info("audit records pruned", zap.Time("before", before), zap.Int("deleted", deleted))
+	}
+}
@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"context"
+	"sync"
+	"telescope/database"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	batches [][]*database.AuditRecord
+	before  time.Time
+}
+
+func (f *fakeStore) InsertAuditRecords(_ context.Context, records []*database.AuditRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// batch is reused by sink
+	f.batches = append(f.batches, append([]*database.AuditRecord(nil), records...))
+	return nil
+}
+
+func (f *fakeStore) PruneAuditRecords(_ context.Context, before time.Time) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.before = before
+	return 0, nil
+}
+
+func (f *fakeStore) saved() (batchSizes []int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, batch := range f.batches {
+		batchSizes = append(batchSizes, len(batch))
+	}
+	return
+}
+
+func TestPostgresSink(t *testing.T) {
+	tests := []struct {
+		testName  string
+		config    Config
+		written   int
+		wantSaved []int
+	}{
+		{
+			testName:  "batched",
+			config:    Config{QueueSize: 10, BatchSize: 4, FlushIntervalMilliseconds: 60000},
+			written:   10,
+			wantSaved: []int{4, 4, 2},
+		},
+		{
+			testName:  "dropped when queue is full",
+			config:    Config{QueueSize: 3, BatchSize: 2, FlushIntervalMilliseconds: 60000},
+			written:   5,
+			wantSaved: []int{2, 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			store := new(fakeStore)
+			sink := NewPostgresSink(store, tt.config, nil, zap.NewNop())
+
+			// queued before starting so that drops are deterministic
+			for i := 0; i < tt.written; i++ {
+				sink.Write(&database.AuditRecord{Path: "/api/hello"})
+			}
+			sink.Start()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			require.NoError(t, sink.Stop(ctx))
+
+			assert.Equal(t, tt.wantSaved, store.saved())
+
+			// too late
+			sink.Write(&database.AuditRecord{Path: "/api/hello"})
+			assert.Empty(t, sink.queue)
+		})
+	}
+}
+
+func TestPostgresSink_flushInterval(t *testing.T) {
+	store := new(fakeStore)
+	sink := NewPostgresSink(store, Config{BatchSize: 100, FlushIntervalMilliseconds: 10}, nil, zap.NewNop())
+	sink.Start()
+	defer sink.Stop(context.Background()) // nolint: errcheck
+
+	sink.Write(&database.AuditRecord{Path: "/api/hello"})
+	assert.Eventually(t, func() bool {
+		return len(store.saved()) == 1
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPostgresSink_prune(t *testing.T) {
+	store := new(fakeStore)
+	sink := NewPostgresSink(store, Config{RetentionDays: 30}, nil, zap.NewNop())
+
+	now := time.Date(2021, 10, 31, 0, 0, 0, 0, time.UTC)
+	sink.prune(now)
+	assert.Equal(t, time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC), store.before)
+}
@@ -12,6 +12,8 @@ type RedisConfig struct {
 	Addr     string
 	Password string
 	DB       int
+	// LogCommands logs every command at debug level
+	LogCommands bool
 }
 
 // Cache is a holder for Redis and cache methods
@@ -26,6 +28,10 @@ func NewRedisClient(ctx context.Context, config RedisConfig) (*Cache, error) {
 		Password: config.Password,
 		DB:       config.DB,
 	})
+	client.AddHook(&commandTraceHook{})
+	client.AddHook(&commandLogHook{
+		verbose: config.LogCommands,
+	})
 
 	err := client.Ping(ctx).Err()
 	if err != nil {
@@ -37,3 +43,25 @@ func NewRedisClient(ctx context.Context, config RedisConfig) (*Cache, error) {
 		Redis: client,
 	}, nil
 }
+
+// Ping checks the connection to Redis
+func (c *Cache) Ping(ctx context.Context) (err error) {
+	err = c.Redis.Ping(ctx).Err()
+	if err != nil {
+		err = fmt.Errorf("redis PING: %w", err)
+		return
+	}
+
+	return
+}
+
+// Close closes the Redis client, releasing any open resources.
+func (c *Cache) Close() (err error) {
+	err = c.Redis.Close()
+	if err != nil {
+		err = fmt.Errorf("redis client Close: %w", err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,188 @@
+package cache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	idempotencyKeyPrefix     = "idempotency:"
+	idempotencyLockKeyPrefix = "idempotency-lock:"
+)
+
+var (
+	// ErrIdempotencyKeyReused the key is used by another request whose fingerprint differs
+	ErrIdempotencyKeyReused = errors.New("idempotency key is reused by a different request")
+	// ErrIdempotencyKeyInFlight a request with the same key is being processed
+	ErrIdempotencyKeyInFlight = errors.New("request with the same idempotency key is in flight")
+)
+
+// releaseLockScript deletes lock only if it's still held by us,
+// since it may have expired and been taken by others.
+var releaseLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// IdempotentResponse is a response recorded under an idempotency key
+type IdempotentResponse struct {
+	// Fingerprint of the request which produced the response
+	Fingerprint string
+	StatusCode  int
+	Header      map[string][]string
+	Body        []byte
+	CreatedAt   time.Time
+}
+
+// IdempotencyLock is held while the first request with a key is being processed
+type IdempotencyLock struct {
+	key   string
+	value string
+}
+
+func idempotencyKey(key string) string {
+	return idempotencyKeyPrefix + key
+}
+
+func idempotencyLockKey(key string) string {
+	return idempotencyLockKeyPrefix + key
+}
+
+// BeginIdempotentRequest looks up key for a recorded response,
+// if there's none, it locks the key for lockTimeout so that duplicates wait for the first one.
+//
+// Exactly one of recorded and lock is non-nil when err is nil,
+// the caller replays recorded, or processes the request then calls FinishIdempotentRequest with lock.
+//
+// err is ErrIdempotencyKeyReused if key is used with another fingerprint,
+// or ErrIdempotencyKeyInFlight if the key is locked by a duplicate.
+func (red *Cache) BeginIdempotentRequest(ctx context.Context, key, fingerprint string, lockTimeout time.Duration) (recorded *IdempotentResponse, lock *IdempotencyLock, err error) {
+	recorded, err = red.readIdempotentResponse(ctx, key, fingerprint)
+	if err != nil || recorded != nil {
+		return
+	}
+
+	token := make([]byte, 16)
+	_, err = rand.Read(token)
+	if err != nil {
+		err = fmt.Errorf("generating lock token: %w", err)
+		return
+	}
+
+	lock = &IdempotencyLock{
+		key:   idempotencyLockKey(key),
+		value: fingerprint + ":" + hex.EncodeToString(token),
+	}
+	acquired, err := red.Redis.SetNX(ctx, lock.key, lock.value, lockTimeout).Result()
+	if err != nil {
+		lock = nil
+		err = fmt.Errorf("locking idempotency key: %w", err)
+		return
+	}
+
+	if !acquired {
+		lock = nil
+		var holder string
+		holder, err = red.Redis.Get(ctx, idempotencyLockKey(key)).Result()
+		if errors.Is(err, redis.Nil) {
+			// released just now, the response may be recorded
+			return red.BeginIdempotentRequest(ctx, key, fingerprint, lockTimeout)
+		}
+		if err != nil {
+			err = fmt.Errorf("reading idempotency lock: %w", err)
+			return
+		}
+
+		if strings.HasPrefix(holder, fingerprint+":") {
+			err = ErrIdempotencyKeyInFlight
+		} else {
+			err = ErrIdempotencyKeyReused
+		}
+		return
+	}
+
+	// the first request may have finished between our reading and locking
+	recorded, err = red.readIdempotentResponse(ctx, key, fingerprint)
+	if err != nil || recorded != nil {
+		if releaseErr := red.releaseIdempotencyLock(ctx, lock); releaseErr != nil && err == nil {
+			err = releaseErr
+		}
+		lock = nil
+		return
+	}
+
+	return
+}
+
+// FinishIdempotentRequest records response under the key for ttl then releases lock.
+// response can be nil, in which case retries are processed as new requests.
+//
+// lock is released even if recording fails, so that retries are not stuck in flight until lock expires.
+func (red *Cache) FinishIdempotentRequest(ctx context.Context, lock *IdempotencyLock, response *IdempotentResponse, ttl time.Duration) (err error) {
+	defer func() {
+		releaseErr := red.releaseIdempotencyLock(ctx, lock)
+		switch {
+		case releaseErr == nil:
+		case err == nil:
+			err = releaseErr
+		default:
+			err = fmt.Errorf("%w, and %s", err, releaseErr)
+		}
+	}()
+
+	if response == nil {
+		return
+	}
+
+	key := idempotencyKey(strings.TrimPrefix(lock.key, idempotencyLockKeyPrefix))
+	err = red.Update(ctx, key, response, ttl)
+	if err != nil {
+		err = fmt.Errorf("recording idempotent response: %w", err)
+		return
+	}
+
+	return
+}
+
+// readIdempotentResponse returns nil recorded if there's none
+func (red *Cache) readIdempotentResponse(ctx context.Context, key, fingerprint string) (recorded *IdempotentResponse, err error) {
+	recorded = new(IdempotentResponse)
+	err = red.Read(ctx, idempotencyKey(key), recorded)
+	if errors.Is(err, redis.Nil) {
+		recorded = nil
+		err = nil
+		return
+	}
+	if err != nil {
+		recorded = nil
+		err = fmt.Errorf("reading idempotent response: %w", err)
+		return
+	}
+
+	if recorded.Fingerprint != fingerprint {
+		recorded = nil
+		err = ErrIdempotencyKeyReused
+		return
+	}
+
+	return
+}
+
+func (red *Cache) releaseIdempotencyLock(ctx context.Context, lock *IdempotencyLock) (err error) {
+	err = releaseLockScript.Run(ctx, red.Redis, []string{lock.key}, lock.value).Err()
+	if err != nil {
+		err = fmt.Errorf("releasing idempotency lock: %w", err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,130 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotentRequest(t *testing.T) {
+	const (
+		key         = "idempotency-test-user:key-1"
+		fingerprint = "fingerprint-a"
+		lockTimeout = 10 * time.Second
+		ttl         = 20 * time.Second
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	recorded, lock, err := cache.BeginIdempotentRequest(ctx, key, fingerprint, lockTimeout)
+	require.NoError(t, err)
+	require.Nil(t, recorded)
+	require.NotNil(t, lock)
+
+	// duplicate in flight
+	_, _, err = cache.BeginIdempotentRequest(ctx, key, fingerprint, lockTimeout)
+	require.True(t, errors.Is(err, ErrIdempotencyKeyInFlight))
+	// reused while in flight
+	_, _, err = cache.BeginIdempotentRequest(ctx, key, "fingerprint-b", lockTimeout)
+	require.True(t, errors.Is(err, ErrIdempotencyKeyReused))
+
+	response := &IdempotentResponse{
+		Fingerprint: fingerprint,
+		StatusCode:  http.StatusCreated,
+		Header:      map[string][]string{"Location": {"/api/things/1"}},
+		Body:        []byte(`{"code":0}`),
+		CreatedAt:   time.Now(),
+	}
+	err = cache.FinishIdempotentRequest(ctx, lock, response, ttl)
+	require.NoError(t, err)
+
+	// replay
+	recorded, lock, err = cache.BeginIdempotentRequest(ctx, key, fingerprint, lockTimeout)
+	require.NoError(t, err)
+	require.Nil(t, lock)
+	require.Equal(t, response.StatusCode, recorded.StatusCode)
+	require.Equal(t, response.Header, recorded.Header)
+	require.Equal(t, response.Body, recorded.Body)
+
+	// reused after completion
+	_, _, err = cache.BeginIdempotentRequest(ctx, key, "fingerprint-b", lockTimeout)
+	require.True(t, errors.Is(err, ErrIdempotencyKeyReused))
+
+	// nothing recorded, retry is processed again
+	const failedKey = "idempotency-test-user:key-2"
+	_, lock, err = cache.BeginIdempotentRequest(ctx, failedKey, fingerprint, lockTimeout)
+	require.NoError(t, err)
+	err = cache.FinishIdempotentRequest(ctx, lock, nil, ttl)
+	require.NoError(t, err)
+	recorded, lock, err = cache.BeginIdempotentRequest(ctx, failedKey, fingerprint, lockTimeout)
+	require.NoError(t, err)
+	require.Nil(t, recorded)
+	require.NotNil(t, lock)
+	err = cache.FinishIdempotentRequest(ctx, lock, nil, ttl)
+	require.NoError(t, err)
+}
+
+// failingSetHook fails SET commands, which records responses as well as takes locks
+type failingSetHook struct{}
+
+var errSetFailed = errors.New("SET failed on purpose")
+
+func (failingSetHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	if cmd.Name() == "set" {
+		return ctx, errSetFailed
+	}
+	return ctx, nil
+}
+
+func (failingSetHook) AfterProcess(context.Context, redis.Cmder) error {
+	return nil
+}
+
+func (failingSetHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (failingSetHook) AfterProcessPipeline(context.Context, []redis.Cmder) error {
+	return nil
+}
+
+func TestFinishIdempotentRequest_recordingFails(t *testing.T) {
+	const (
+		key         = "idempotency-test-user:key-3"
+		fingerprint = "fingerprint-a"
+		lockTimeout = 10 * time.Second
+		ttl         = 20 * time.Second
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// a client of its own, leaving the shared one intact
+	failing := &Cache{Redis: redis.NewClient(cache.Redis.Options())}
+	failing.Redis.AddHook(failingSetHook{})
+	defer failing.Close()
+
+	_, lock, err := cache.BeginIdempotentRequest(ctx, key, fingerprint, lockTimeout)
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+
+	err = failing.FinishIdempotentRequest(ctx, lock, &IdempotentResponse{
+		Fingerprint: fingerprint,
+		StatusCode:  http.StatusCreated,
+		CreatedAt:   time.Now(),
+	}, ttl)
+	require.True(t, errors.Is(err, errSetFailed))
+
+	// released, the retry is processed as a new request rather than in flight
+	recorded, lock, err := cache.BeginIdempotentRequest(ctx, key, fingerprint, lockTimeout)
+	require.NoError(t, err)
+	require.Nil(t, recorded)
+	require.NotNil(t, lock)
+	require.NoError(t, cache.FinishIdempotentRequest(ctx, lock, nil, ttl))
+}
@@ -0,0 +1,191 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-pg/pg/v10"
+	"go.uber.org/zap"
+)
+
+// idPlaceholder in key templates is replaced with changed row id
+const idPlaceholder = "{id}"
+
+// InvalidationConfig decides which Postgres channels to listen on
+// and how notifications on them translate into cache revoking.
+type InvalidationConfig struct {
+	// Postgres channels to LISTEN, usually fed by triggers
+	// installed by database.InstallCacheInvalidationTrigger
+	Channels []string
+	// Rules per table, notifications from tables without rule are ignored
+	Rules []InvalidationRule
+}
+
+// InvalidationRule tells which keys to revoke when a row of Table changes.
+//
+// "{id}" in Keys and Patterns is replaced with the id of the changed row.
+type InvalidationRule struct {
+	Table string
+	// Keys revoked by Revoke
+	Keys []string
+	// Patterns revoked by RevokeByPattern,
+	// matching rule: https://redis.io/commands/keys
+	Patterns []string
+}
+
+// watcher is implemented by *database.DB
+type watcher interface {
+	Watch(ctx context.Context, callback func(context.Context, pg.Notification), topic ...string) (err error)
+}
+
+// invalidationPayload is the notification payload.
+//
+// Triggers send Table, Op and IDs, while anyone can send Keys and Patterns directly, e.g.
+//
+//	NOTIFY cache_invalidation, '{"keys": ["user:42"], "patterns": ["user-list:*"]}';
+type invalidationPayload struct {
+	Table    string   `json:"table"`
+	Op       string   `json:"op"`
+	IDs      []string `json:"ids"`
+	Keys     []string `json:"keys"`
+	Patterns []string `json:"patterns"`
+}
+
+// Invalidator bridges Postgres NOTIFY to cache revoking,
+// so that cache stays fresh even if data is changed outside of our handlers.
+type Invalidator struct {
+	cache    *Cache
+	logger   *zap.Logger
+	channels []string
+	rules    map[string]InvalidationRule
+}
+
+// NewInvalidator creates an Invalidator, call Start to make it work.
+func NewInvalidator(cache *Cache, logger *zap.Logger, config InvalidationConfig) *Invalidator {
+	rules := make(map[string]InvalidationRule, len(config.Rules))
+	for _, rule := range config.Rules {
+		existing := rules[rule.Table]
+		existing.Table = rule.Table
+		existing.Keys = append(existing.Keys, rule.Keys...)
+		existing.Patterns = append(existing.Patterns, rule.Patterns...)
+		rules[rule.Table] = existing
+	}
+
+	return &Invalidator{
+		cache:    cache,
+		logger:   logger,
+		channels: config.Channels,
+		rules:    rules,
+	}
+}
+
+// Start subscribes configured channels on db, which is usually a *database.DB
+func (inv *Invalidator) Start(ctx context.Context, db watcher) (err error) {
+	if len(inv.channels) == 0 {
+		return
+	}
+
+	err = db.Watch(ctx, inv.Handle, inv.channels...)
+	if err != nil {
+		err = fmt.Errorf("db.Watch: %w", err)
+		return
+	}
+
+	return
+}
+
+// Handle revokes cache according to notify
+func (inv *Invalidator) Handle(ctx context.Context, notify pg.Notification) {
+	keys, patterns, err := inv.resolve(notify.Payload)
+	if err != nil {
+		inv.logger.Warn("malformed cache invalidation payload",
+			zap.String("channel", notify.Channel),
+			zap.String("payload", notify.Payload),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if len(keys) > 0 {
+		err = inv.cache.Revoke(ctx, keys...)
+		if err != nil {
+			inv.logger.Error("revoking cache by notification",
+				zap.String("channel", notify.Channel),
+				zap.Strings("keys", keys),
+				zap.Error(err),
+			)
+		}
+	}
+
+	for _, pattern := range patterns {
+		err = inv.cache.RevokeByPattern(ctx, pattern)
+		if err != nil {
+			inv.logger.Error("revoking cache by pattern by notification",
+				zap.String("channel", notify.Channel),
+				zap.String("pattern", pattern),
+				zap.Error(err),
+			)
+		}
+	}
+}
+
+// resolve translates payload into keys and patterns.
+//
+// payload not being a JSON object is treated as a single key,
+// or a single pattern if it contains glob characters.
+func (inv *Invalidator) resolve(payload string) (keys, patterns []string, err error) {
+	payload = strings.TrimSpace(payload)
+	if payload == "" {
+		return
+	}
+
+	if !strings.HasPrefix(payload, "{") {
+		if strings.ContainsAny(payload, "*?[") {
+			patterns = append(patterns, payload)
+		} else {
+			keys = append(keys, payload)
+		}
+		return
+	}
+
+	var p invalidationPayload
+	err = json.Unmarshal([]byte(payload), &p)
+	if err != nil {
+		err = fmt.Errorf("json.Unmarshal: %w", err)
+		return
+	}
+
+	keys = append(keys, p.Keys...)
+	patterns = append(patterns, p.Patterns...)
+
+	if p.Table == "" {
+		return
+	}
+	rule, ok := inv.rules[p.Table]
+	if !ok {
+		return
+	}
+	keys = append(keys, expandIDs(rule.Keys, p.IDs)...)
+	patterns = append(patterns, expandIDs(rule.Patterns, p.IDs)...)
+
+	return
+}
+
+// expandIDs replaces "{id}" in templates with each of ids.
+// Templates without "{id}" are kept as is.
+func expandIDs(templates []string, ids []string) (product []string) {
+	for _, template := range templates {
+		if !strings.Contains(template, idPlaceholder) {
+			product = append(product, template)
+			continue
+		}
+
+		for _, id := range ids {
+			product = append(product, strings.ReplaceAll(template, idPlaceholder, id))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestInvalidator_resolve(t *testing.T) {
+	inv := NewInvalidator(nil, zap.NewNop(), InvalidationConfig{
+		Channels: []string{"cache_invalidation"},
+		Rules: []InvalidationRule{
+			{
+				Table:    "users",
+				Keys:     []string{"user:{id}", "user-count"},
+				Patterns: []string{"user:{id}:*"},
+			},
+			{
+				Table: "users",
+				Keys:  []string{"user-profile:{id}"},
+			},
+		},
+	})
+
+	tests := []struct {
+		testName     string
+		payload      string
+		wantKeys     []string
+		wantPatterns []string
+		wantErr      bool
+	}{
+		{
+			testName: "empty",
+			payload:  "",
+		},
+		{
+			testName: "plain key",
+			payload:  "user:42",
+			wantKeys: []string{"user:42"},
+		},
+		{
+			testName:     "plain pattern",
+			payload:      "user:*",
+			wantPatterns: []string{"user:*"},
+		},
+		{
+			testName:     "direct keys and patterns",
+			payload:      `{"keys": ["a", "b"], "patterns": ["c:*"]}`,
+			wantKeys:     []string{"a", "b"},
+			wantPatterns: []string{"c:*"},
+		},
+		{
+			testName:     "trigger",
+			payload:      `{"table": "users", "op": "UPDATE", "ids": ["1", "2"]}`,
+			wantKeys:     []string{"user:1", "user:2", "user-count", "user-profile:1", "user-profile:2"},
+			wantPatterns: []string{"user:1:*", "user:2:*"},
+		},
+		{
+			testName: "trigger without rule",
+			payload:  `{"table": "orders", "op": "DELETE", "ids": ["1"]}`,
+		},
+		{
+			testName: "malformed",
+			payload:  `{"table": `,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			keys, patterns, err := inv.resolve(tt.payload)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantKeys, keys)
+			require.Equal(t, tt.wantPatterns, patterns)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"telescope/logging"
+
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// commandLogHook logs commands with logger carried by context,
+// so that they can be told apart by request ID.
+type commandLogHook struct {
+	// verbose logs every command at debug level
+	verbose bool
+}
+
+var _ redis.Hook = (*commandLogHook)(nil)
+
+func (h *commandLogHook) BeforeProcess(ctx context.Context, _ redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *commandLogHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.log(ctx, cmd)
+	return nil
+}
+
+func (h *commandLogHook) BeforeProcessPipeline(ctx context.Context, _ []redis.Cmder) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *commandLogHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	for _, cmd := range cmds {
+		h.log(ctx, cmd)
+	}
+	return nil
+}
+
+// log only logs command name, arguments may be large or sensitive.
+func (h *commandLogHook) log(ctx context.Context, cmd redis.Cmder) {
+	err := cmd.Err()
+	// cache miss is not an error
+	failed := err != nil && !errors.Is(err, redis.Nil)
+	if !failed && !h.verbose {
+		return
+	}
+
+	logger := logging.FromContext(ctx)
+	if failed {
+		logger.Error("redis command failed",
+			zap.String("command", cmd.FullName()),
+			zap.Error(err),
+		)
+		return
+	}
+
+	logger.Debug("redis command", zap.String("command", cmd.FullName()))
+}
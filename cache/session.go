@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	sessionKeyPrefix      = "session:"
+	userSessionsKeyPrefix = "user-sessions:"
+)
+
+// ErrSessionNotFound session does not exist or has expired
+var ErrSessionNotFound = errors.New("session not found")
+
+// Session is server side session data
+type Session struct {
+	ID     string
+	UserID string
+	Roles  []string
+	// CSRFToken must be presented by unsafe requests within the session
+	CSRFToken string
+	CreatedAt time.Time
+	// Values holds arbitrary data within the session
+	Values map[string]string
+}
+
+func sessionKey(id string) string {
+	return sessionKeyPrefix + id
+}
+
+func userSessionsKey(userID string) string {
+	return userSessionsKeyPrefix + userID
+}
+
+// SaveSession creates or overwrites session,
+// which expires after idleTimeout without being read.
+func (red *Cache) SaveSession(ctx context.Context, session *Session, idleTimeout time.Duration) (err error) {
+	err = red.Update(ctx, sessionKey(session.ID), session, idleTimeout)
+	if err != nil {
+		err = fmt.Errorf("saving session: %w", err)
+		return
+	}
+
+	if session.UserID == "" {
+		return
+	}
+
+	// index sessions by user so that we can log out everywhere.
+	// The index outlives any of its sessions, stale members are harmless.
+	indexKey := userSessionsKey(session.UserID)
+	_, err = red.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.SAdd(ctx, indexKey, session.ID)
+		pipe.Expire(ctx, indexKey, idleTimeout)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("indexing session by user: %w", err)
+		return
+	}
+
+	return
+}
+
+// ReadSession reads session by id and slides its expiration by idleTimeout.
+//
+// err is ErrSessionNotFound if there's no such session.
+func (red *Cache) ReadSession(ctx context.Context, id string, idleTimeout time.Duration) (session *Session, err error) {
+	session = new(Session)
+	err = red.Read(ctx, sessionKey(id), session)
+	if errors.Is(err, redis.Nil) {
+		session = nil
+		err = ErrSessionNotFound
+		return
+	}
+	if err != nil {
+		session = nil
+		err = fmt.Errorf("reading session: %w", err)
+		return
+	}
+
+	_, err = red.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, sessionKey(id), idleTimeout)
+		if session.UserID != "" {
+			pipe.Expire(ctx, userSessionsKey(session.UserID), idleTimeout)
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("sliding session expiration: %w", err)
+		return
+	}
+
+	return
+}
+
+// DeleteSession deletes session by id, deleting a non-existing session is not an error.
+func (red *Cache) DeleteSession(ctx context.Context, session *Session) (err error) {
+	_, err = red.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Unlink(ctx, sessionKey(session.ID))
+		if session.UserID != "" {
+			pipe.SRem(ctx, userSessionsKey(session.UserID), session.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("deleting session: %w", err)
+		return
+	}
+
+	return
+}
+
+// RotateSession moves session to newID, keeping its data,
+// the old id is no longer valid afterwards.
+//
+// Rotate on privilege change to defeat session fixation.
+func (red *Cache) RotateSession(ctx context.Context, session *Session, newID string, idleTimeout time.Duration) (err error) {
+	oldSession := *session
+	session.ID = newID
+
+	err = red.SaveSession(ctx, session, idleTimeout)
+	if err != nil {
+		err = fmt.Errorf("SaveSession: %w", err)
+		return
+	}
+
+	err = red.DeleteSession(ctx, &oldSession)
+	if err != nil {
+		err = fmt.Errorf("DeleteSession: %w", err)
+		return
+	}
+
+	return
+}
+
+// DeleteUserSessions deletes all sessions of user, a.k.a. log out everywhere.
+func (red *Cache) DeleteUserSessions(ctx context.Context, userID string) (err error) {
+	indexKey := userSessionsKey(userID)
+
+	ids, err := red.Redis.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		err = fmt.Errorf("redis SMEMBERS: %w", err)
+		return
+	}
+
+	keys := make([]string, 0, len(ids)+1)
+	for _, id := range ids {
+		keys = append(keys, sessionKey(id))
+	}
+	keys = append(keys, indexKey)
+
+	err = red.Revoke(ctx, keys...)
+	if err != nil {
+		err = fmt.Errorf("Revoke: %w", err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSession(t *testing.T) {
+	const (
+		userID      = "session-test-user-a3f1"
+		idleTimeout = 20 * time.Second
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := cache.ReadSession(ctx, "no-such-session", idleTimeout)
+	require.True(t, errors.Is(err, ErrSessionNotFound))
+
+	session := &Session{
+		ID:        "session-test-1",
+		UserID:    userID,
+		Roles:     []string{"admin"},
+		CSRFToken: "csrf",
+		CreatedAt: time.Now(),
+		Values:    map[string]string{"theme": "dark"},
+	}
+	err = cache.SaveSession(ctx, session, idleTimeout)
+	require.NoError(t, err)
+
+	// sliding expiration
+	err = cache.Redis.Expire(ctx, sessionKey(session.ID), time.Second).Err()
+	require.NoError(t, err)
+	got, err := cache.ReadSession(ctx, session.ID, idleTimeout)
+	require.NoError(t, err)
+	require.Equal(t, session.UserID, got.UserID)
+	require.Equal(t, session.Roles, got.Roles)
+	require.Equal(t, session.Values, got.Values)
+	ttl, err := cache.Redis.TTL(ctx, sessionKey(session.ID)).Result()
+	require.NoError(t, err)
+	require.True(t, ttl > time.Second)
+
+	// rotation
+	err = cache.RotateSession(ctx, got, "session-test-2", idleTimeout)
+	require.NoError(t, err)
+	_, err = cache.ReadSession(ctx, "session-test-1", idleTimeout)
+	require.True(t, errors.Is(err, ErrSessionNotFound))
+	got, err = cache.ReadSession(ctx, "session-test-2", idleTimeout)
+	require.NoError(t, err)
+	require.Equal(t, "csrf", got.CSRFToken)
+
+	// log out everywhere
+	another := *session
+	another.ID = "session-test-3"
+	err = cache.SaveSession(ctx, &another, idleTimeout)
+	require.NoError(t, err)
+
+	err = cache.DeleteUserSessions(ctx, userID)
+	require.NoError(t, err)
+	for _, id := range []string{"session-test-2", "session-test-3"} {
+		_, err = cache.ReadSession(ctx, id, idleTimeout)
+		require.True(t, errors.Is(err, ErrSessionNotFound))
+	}
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"telescope/tracing"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("telescope/cache")
+
+// commandTraceHook starts a client span for each command or pipeline
+type commandTraceHook struct{}
+
+var _ redis.Hook = (*commandTraceHook)(nil)
+
+func (h *commandTraceHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return h.start(ctx, cmd.FullName(), cmd.FullName())
+}
+
+func (h *commandTraceHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	h.end(ctx, []redis.Cmder{cmd})
+	return nil
+}
+
+func (h *commandTraceHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	ctx, err := h.start(ctx, "pipeline", pipelineOperation(cmds))
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("db.redis.num_cmd", len(cmds)))
+	return ctx, err
+}
+
+func (h *commandTraceHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	h.end(ctx, cmds)
+	return nil
+}
+
+// start only records command names, arguments may be large or sensitive.
+func (h *commandTraceHook) start(ctx context.Context, spanName, operation string) (context.Context, error) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		// no trace to join, e.g. commands of background jobs
+		return ctx, nil
+	}
+
+	ctx, _ = tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperationKey.String(operation),
+		),
+	)
+
+	return ctx, nil
+}
+
+func (h *commandTraceHook) end(ctx context.Context, cmds []redis.Cmder) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	defer span.End()
+
+	for _, cmd := range cmds {
+		err := cmd.Err()
+		// cache miss is not an error
+		if err != nil && !errors.Is(err, redis.Nil) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+	}
+}
+
+// pipelineOperation joins names of commands, e.g. "multi get exec"
+func pipelineOperation(cmds []redis.Cmder) (operation string) {
+	for i, cmd := range cmds {
+		if i > 0 {
+			operation += " "
+		}
+		operation += cmd.FullName()
+	}
+
+	return
+}
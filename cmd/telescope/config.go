@@ -1,18 +1,27 @@
 package main
 
 import (
+	"telescope/audit"
 	"telescope/cache"
 	"telescope/controller"
 	"telescope/database"
+	"telescope/lifecycle"
+	"telescope/logging"
+	"telescope/metric"
+	"telescope/tracing"
 )
 
 type Config struct {
-	Log      LogConfig
-	API      controller.Config
+	Log logging.Config
+	API controller.Config
+	// Audit saves API audit records to Postgres
+	Audit    audit.Config
 	Postgres database.PostgresConfig
 	Redis    cache.RedisConfig
-}
-
-type LogConfig struct {
-	ProductionMode bool
+	// CacheInvalidation revokes cache on Postgres notifications
+	CacheInvalidation cache.InvalidationConfig
+	Metric            metric.Config
+	Tracing           tracing.Config
+	// Lifecycle orders shutting down
+	Lifecycle lifecycle.Config
 }
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"telescope/errorcode"
+)
+
+// errorsCommand dumps registered error codes for API docs, e.g.
+//
+//	telescope errors -format markdown > docs/errors.md
+func errorsCommand(w io.Writer, args []string) (err error) {
+	flags := flag.NewFlagSet("errors", flag.ContinueOnError)
+	format := flags.String("format", "markdown", "output format, markdown or json")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	entries := errorcode.Entries(errorcode.DefaultCatalog)
+	switch *format {
+	case "markdown", "md":
+		err = errorcode.WriteMarkdown(w, entries)
+	case "json":
+		err = errorcode.WriteJSON(w, entries)
+	default:
+		err = fmt.Errorf("unknown format %q, want markdown or json", *format)
+	}
+
+	return
+}
@@ -7,7 +7,15 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"telescope/audit"
+	"telescope/cache"
 	"telescope/controller"
+	"telescope/database"
+	"telescope/health"
+	"telescope/lifecycle"
+	"telescope/logging"
+	"telescope/metric"
+	"telescope/tracing"
 
 	"github.com/BurntSushi/toml"
 )
@@ -27,8 +35,141 @@ func main() {
 
 	// set default value here
 	var config = Config{
+		Log: logging.Config{
+			OutputPaths: []string{"stderr"},
+			Rotation: logging.RotationConfig{
+				MaxSizeMB:  100,
+				MaxBackups: 10,
+				MaxAgeDays: 30,
+			},
+			AuditSampling: logging.SamplingConfig{
+				Initial:    100,
+				Thereafter: 10,
+			},
+		},
 		API: controller.Config{
 			Port: 3000,
+			PayloadAudit: controller.PayloadAuditConfig{
+				RequestBodyMaxBytes:  512,
+				ResponseBodyMaxBytes: 512,
+				RedactFields:         []string{"password", "secret", "token", "accessToken", "refreshToken", "apiKey", "credential"},
+				RedactPatterns:       []string{`\b\d{4}[ -]?\d{4}[ -]?\d{4}[ -]?\d{1,7}\b`},
+				LogHeaders:           []string{"Accept", "Accept-Language", "Content-Length", "Content-Type", "User-Agent", "X-Request-ID"},
+				SkipRoutes:           []string{},
+			},
+			Session: controller.SessionConfig{
+				CookieName:             "telescope_session",
+				Path:                   "/",
+				SameSite:               "Lax",
+				IdleTimeoutSeconds:     30 * 60,
+				AbsoluteTimeoutSeconds: 12 * 60 * 60,
+			},
+			Permission: controller.PermissionConfig{
+				Roles: map[string][]string{
+					"admin": {"*"},
+				},
+				CacheSeconds: 60,
+			},
+			CORS: controller.CORSConfig{
+				Default: controller.CORSPolicy{
+					AllowOrigins:  []string{"https://example.com", "https://*.example.com"},
+					AllowHeaders:  []string{"Content-Type", "Authorization", "Token", "X-CSRF-Token", "X-Request-ID", "Idempotency-Key", "If-Match", "If-None-Match"},
+					ExposeHeaders: []string{"X-Request-ID", "Idempotent-Replayed", "ETag", "Last-Modified"},
+					MaxAgeSeconds: 43200,
+				},
+			},
+			Health: health.Config{
+				TimeoutMilliseconds: 1000,
+				CacheMilliseconds:   1000,
+			},
+			Idempotency: controller.IdempotencyConfig{
+				TTLSeconds:         24 * 60 * 60,
+				LockTimeoutSeconds: 60,
+			},
+			SSE: controller.SSEConfig{
+				Topics: []controller.SSETopic{
+					{Name: "announcement"},
+				},
+				HeartbeatSeconds: 15,
+				ClientBufferSize: 64,
+				ReplaySize:       256,
+			},
+			WebSocket: controller.WebSocketConfig{
+				Rooms: []controller.WebSocketRoom{
+					{Name: "chat:*"},
+				},
+				PingSeconds:         30,
+				PongTimeoutSeconds:  60,
+				WriteTimeoutSeconds: 10,
+				SendQueueSize:       64,
+				MaxMessageBytes:     64 << 10,
+			},
+			Server: controller.ServerConfig{
+				ReadHeaderTimeoutSeconds:   10,
+				IdleTimeoutSeconds:         120,
+				MaxHeaderBytes:             1 << 20,
+				RestartReadyTimeoutSeconds: 30,
+				TLS: controller.TLSConfig{
+					ReloadIntervalSeconds: 60,
+					ClientAuth:            controller.ClientAuthRequire,
+					MinVersion:            "1.2",
+				},
+			},
+			BodyLimit: controller.BodyLimitConfig{
+				DefaultBytes: 256 << 10,
+				Routes: []controller.BodyLimitRule{
+					{Prefix: "/api/uploads", MaxBytes: 32 << 20},
+				},
+			},
+			Upload: controller.UploadConfig{
+				Dir: "uploads",
+			},
+			Timeout: controller.TimeoutConfig{
+				DefaultSeconds: 30,
+				Routes: []controller.TimeoutRule{
+					{Prefix: "/api/uploads", Seconds: 300},
+				},
+			},
+			LoadShedding: controller.LoadSheddingConfig{
+				MaxInFlight:               1000,
+				Adaptive:                  true,
+				MinInFlight:               100,
+				TargetLatencyMilliseconds: 500,
+				RetryAfterSeconds:         1,
+				ExemptRoutes:              []string{"/healthz", "/readyz"},
+			},
+		},
+		Audit: audit.Config{
+			Enabled:                   false,
+			QueueSize:                 10000,
+			BatchSize:                 500,
+			FlushIntervalMilliseconds: 1000,
+			RetentionDays:             180,
+			PruneIntervalMinutes:      60,
+		},
+		Postgres: database.PostgresConfig{
+			SlowQueryMilliseconds: 200,
+		},
+		CacheInvalidation: cache.InvalidationConfig{
+			Channels: []string{"cache_invalidation"},
+		},
+		Metric: metric.Config{
+			Enabled:      true,
+			Addr:         ":2000",
+			Prefix:       "telescope",
+			ProcessStats: true,
+		},
+		Tracing: tracing.Config{
+			Exporter:     tracing.ExporterNone,
+			ServiceName:  "telescope",
+			OTLPEndpoint: "localhost:4318",
+			OTLPInsecure: true,
+			FilePath:     "traces.json",
+			SampleRatio:  1,
+		},
+		Lifecycle: lifecycle.Config{
+			DrainSeconds:        5,
+			PhaseTimeoutSeconds: 10,
 		},
 	}
 
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"telescope/controller"
+
+	"github.com/BurntSushi/toml"
+	"github.com/gin-gonic/gin"
+)
+
+// openAPICommand writes OpenAPI document, commit it so that API changes show up in review, e.g.
+//
+//	telescope openapi -o docs/openapi.json
+func openAPICommand(w io.Writer, args []string) (err error) {
+	flags := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	output := flags.String("o", "", "write to file instead of stdout")
+	err = flags.Parse(args)
+	if err != nil {
+		return
+	}
+
+	// config is optional, it only affects details like session cookie name
+	var config Config
+	_, err = toml.DecodeFile(*configPath, &config)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		err = fmt.Errorf("loading config file: toml.DecodeFile: %w", err)
+		return
+	}
+
+	// keep route debug logs out of output
+	gin.SetMode(gin.ReleaseMode)
+	doc := controller.GenerateAPIDocument(config.API)
+
+	if *output != "" {
+		var f *os.File
+		f, err = os.Create(*output)
+		if err != nil {
+			err = fmt.Errorf("creating output file: %w", err)
+			return
+		}
+		defer func() {
+			closeErr := f.Close()
+			if err == nil && closeErr != nil {
+				err = fmt.Errorf("closing output file: %w", closeErr)
+			}
+		}()
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(doc)
+	if err != nil {
+		err = fmt.Errorf("encoding document: %w", err)
+		return
+	}
+
+	return
+}
@@ -4,10 +4,16 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"telescope/audit"
 	"telescope/cache"
 	"telescope/controller"
 	"telescope/database"
+	"telescope/lifecycle"
+	"telescope/logging"
+	"telescope/metric"
+	"telescope/tracing"
 	"telescope/version"
 	"time"
 
@@ -27,10 +33,28 @@ func init() {
 func main() {
 	flag.Parse()
 
+	// subcommands
+	var command func(w io.Writer, args []string) error
+	switch flag.Arg(0) {
+	case "errors":
+		command = errorsCommand
+	case "openapi":
+		command = openAPICommand
+	}
+	if command != nil {
+		err := command(os.Stdout, flag.Args()[1:])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
-		err    error
-		config Config
-		logger *zap.Logger
+		err      error
+		config   Config
+		logger   *zap.Logger
+		logLevel zap.AtomicLevel
 	)
 
 	defer func() {
@@ -51,20 +75,31 @@ func main() {
 		return
 	}
 
-	if config.Log.ProductionMode {
-		logger, err = zap.NewProduction()
-	} else {
-		logger, err = zap.NewDevelopment()
-	}
+	logger, logLevel, err = logging.New(config.Log)
 	if err != nil {
 		err = fmt.Errorf("initializing zap logger: %w", err)
 		return
 	}
 	defer logger.Sync() // nolint: errcheck
 	zap.ReplaceGlobals(logger)
+	stopWatchingLevel := logging.WatchLevelSignal(logLevel, logger)
+	defer stopWatchingLevel()
 
 	logger.Info("starting...", zap.String("version", version.FullNameWithBuildDate))
 
+	lc := lifecycle.New(config.Lifecycle, logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), config.Tracing)
+	if err != nil {
+		err = fmt.Errorf("tracing.Setup: %w", err)
+		return
+	}
+	lc.Append(lifecycle.Hook{
+		Name:     "tracing",
+		Priority: lifecycle.PriorityTelemetry,
+		Stop:     shutdownTracing,
+	})
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -76,28 +111,103 @@ func main() {
 		err = fmt.Errorf("database.NewDatabase: %w", err)
 		return
 	}
-	defer db.Close() // nolint: errcheck
+	lc.Append(lifecycle.Hook{
+		Name:     "Postgres listener",
+		Priority: lifecycle.PriorityListener,
+		Stop: func(context.Context) error {
+			return db.CloseListener()
+		},
+	})
+	lc.Append(lifecycle.Hook{
+		Name:     "Postgres",
+		Priority: lifecycle.PriorityStore,
+		Stop: func(context.Context) (err error) {
+			if errs := db.Close(); len(errs) > 0 {
+				err = fmt.Errorf("db.Close: %v", errs)
+			}
+			return
+		},
+	})
 	logger.Info("database connected")
 
+	err = db.CreateTables(ctx)
+	if err != nil {
+		err = fmt.Errorf("db.CreateTables: %w", err)
+		return
+	}
+
 	logger.Info("connecting to Redis...")
 	redis, err := cache.NewRedisClient(ctx, config.Redis)
 	if err != nil {
 		err = fmt.Errorf("cache.NewRedisClient: %w", err)
 		return
 	}
+	lc.Append(lifecycle.Hook{
+		Name:     "Redis",
+		Priority: lifecycle.PriorityStore,
+		Stop: func(context.Context) error {
+			return redis.Close()
+		},
+	})
 	logger.Info("Redis connected")
 
-	server := controller.NewServer(controller.ServerOpt{
+	err = cache.NewInvalidator(redis, logger, config.CacheInvalidation).Start(ctx, db)
+	if err != nil {
+		err = fmt.Errorf("starting cache invalidator: %w", err)
+		return
+	}
+
+	collector := metric.NewCollector(config.Metric)
+	collector.Register(lc, config.Metric.Addr)
+	if config.Metric.Enabled {
+		logger.Info("metric service is starting", zap.String("addr", config.Metric.Addr))
+	}
+
+	var auditSink audit.Sink
+	if config.Audit.Enabled {
+		postgresSink := audit.NewPostgresSink(db, config.Audit, collector, logger)
+		postgresSink.Register(lc)
+		auditSink = postgresSink
+	}
+
+	server, err := controller.NewServer(controller.ServerOpt{
 		Port:          config.API.Port,
 		Logger:        logger,
+		LogLevel:      logLevel,
 		Database:      db,
 		Redis:         redis,
 		AuditResponse: config.API.AuditResponse,
+		PayloadAudit:  config.API.PayloadAudit,
+		AuditSink:     auditSink,
+		Auth:          config.API.Auth,
+		Session:       config.API.Session,
+		Permission:    config.API.Permission,
+		CORS:          config.API.CORS,
+		Metric:        collector,
+		Health:        config.API.Health,
+		Idempotency:   config.API.Idempotency,
+		SSE:           config.API.SSE,
+		WebSocket:     config.API.WebSocket,
+		Server:        config.API.Server,
+		BodyLimit:     config.API.BodyLimit,
+		Upload:        config.API.Upload,
+		Timeout:       config.API.Timeout,
+		LoadShedding:  config.API.LoadShedding,
 	})
+	if err != nil {
+		err = fmt.Errorf("controller.NewServer: %w", err)
+		return
+	}
 
-	logger.Info("public API service is starting", zap.Int("port", config.API.Port))
+	server.Register(lc)
+
+	logger.Info("public API service is starting",
+		zap.Int("port", config.API.Port),
+		zap.String("unixSocket", config.API.Server.UnixSocket),
+		zap.Bool("tls", config.API.Server.TLS.CertFile != ""),
+	)
 
-	err = server.ListenAndServe()
+	err = lc.Run()
 	if err != nil {
 		return
 	}
@@ -0,0 +1,511 @@
+package controller
+
+import (
+	"bytes"
+	_ "embed" // embed API document page
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"telescope/errorcode"
+	"telescope/health"
+	"telescope/openapi"
+	"telescope/version"
+
+	"github.com/gin-gonic/gin"
+)
+
+// security scheme names
+const (
+	securityBearer  = "bearer"
+	securityToken   = "token"
+	securitySession = "session"
+)
+
+// APIOperation annotates a handler for OpenAPI document
+type APIOperation struct {
+	Summary     string
+	Description string
+	Tags        []string
+	// Request is the type of JSON request body, e.g. loginRequest{}, nil means no body.
+	Request interface{}
+	// Query is a struct whose fields tagged with form are query parameters
+	Query interface{}
+	// Response is the type of R.Data on success, nil means no data.
+	Response interface{}
+	// ContentType of response which is not wrapped in R, e.g. "text/html"
+	ContentType string
+	// Errors the handler may respond with, besides those implied by Auth and Request.
+	Errors []*errorcode.Error
+	// Auth requires authentication
+	Auth bool
+	// SkipIdempotency tells Idempotency-Key is ignored, e.g. for streamed uploads
+	SkipIdempotency bool
+	// Hidden keeps the route out of the document
+	Hidden bool
+}
+
+var (
+	apiOperationMu sync.RWMutex
+	// apiOperations by handler name
+	apiOperations = make(map[string]APIOperation)
+)
+
+// DescribeHandler annotates handler for OpenAPI document,
+// handler is a gin.HandlerFunc or a method expression like (*Controller).Login.
+func DescribeHandler(handler interface{}, operation APIOperation) {
+	apiOperationMu.Lock()
+	defer apiOperationMu.Unlock()
+
+	apiOperations[handlerName(handler)] = operation
+}
+
+// handlerName is the same for method value and method expression,
+// so that it matches handler name in gin.RouteInfo.
+func handlerName(handler interface{}) string {
+	return normalizeHandlerName(runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name())
+}
+
+func normalizeHandlerName(name string) string {
+	return strings.TrimSuffix(name, "-fm")
+}
+
+func apiOperationOf(handler string) (operation APIOperation, found bool) {
+	apiOperationMu.RLock()
+	defer apiOperationMu.RUnlock()
+
+	operation, found = apiOperations[normalizeHandlerName(handler)]
+	return
+}
+
+func init() {
+	DescribeHandler((*Controller).IndexPage, APIOperation{Hidden: true})
+	DescribeHandler((*Controller).RobotsTXT, APIOperation{Hidden: true})
+	DescribeHandler((*Controller).OpenAPI, APIOperation{Hidden: true})
+	DescribeHandler((*Controller).APIDocPage, APIOperation{Hidden: true})
+
+	DescribeHandler((*Controller).Healthz, APIOperation{
+		Summary:  "Liveness probe",
+		Tags:     []string{"health"},
+		Response: health.Report{},
+	})
+	DescribeHandler((*Controller).Readyz, APIOperation{
+		Summary:     "Readiness probe",
+		Description: "Responds 503 when a dependency is down or the instance is shutting down.",
+		Tags:        []string{"health"},
+		Response:    health.Report{},
+	})
+	DescribeHandler((*Controller).Hello, APIOperation{
+		Summary:  "Say hello",
+		Tags:     []string{"health"},
+		Response: "",
+	})
+
+	DescribeHandler((*Controller).Login, APIOperation{
+		Summary:     "Log in",
+		Description: "Verifies username and password, and starts a cookie session.",
+		Tags:        []string{"session"},
+		Request:     loginRequest{},
+		Response:    sessionResponse{},
+		Errors:      []*errorcode.Error{errorcode.ErrUnauthorized},
+	})
+	DescribeHandler((*Controller).CurrentSession, APIOperation{
+		Summary:  "Current session",
+		Tags:     []string{"session"},
+		Response: sessionResponse{},
+		Auth:     true,
+	})
+	DescribeHandler((*Controller).Logout, APIOperation{
+		Summary: "Log out",
+		Tags:    []string{"session"},
+		Auth:    true,
+	})
+	DescribeHandler((*Controller).LogoutEverywhere, APIOperation{
+		Summary: "Log out from every device",
+		Tags:    []string{"session"},
+		Auth:    true,
+	})
+
+	DescribeHandler((*Controller).Events, APIOperation{
+		Summary: "Subscribe events",
+		Description: "Streams notifications of topics as server-sent events, whose event name is the topic. " +
+			"Reconnecting clients resume by Last-Event-ID, and get a resync event if some events are gone in between.",
+		Tags:        []string{"events"},
+		Query:       eventsQuery{},
+		ContentType: sseContentType,
+		Errors:      []*errorcode.Error{errorcode.ErrUnknownTopic, errorcode.ErrForbidden, errorcode.ErrValidationFailed},
+		Auth:        true,
+	})
+
+	DescribeHandler((*Controller).WebSocket, APIOperation{
+		Summary: "WebSocket gateway",
+		Description: "Upgrades to WebSocket, on which clients send JSON messages " +
+			`{"type": "join"|"leave"|"publish", "room": "...", "data": ...} ` +
+			"and receive joined, left, message and error in the same shape. " +
+			"Browsers may offer subprotocols " + wsSubprotocol + " and " + wsTokenProtocolPrefix + "<credential> to authenticate.",
+		Tags: []string{"events"},
+		Auth: true,
+	})
+
+	DescribeHandler((*Controller).Whoami, APIOperation{
+		Summary:  "Who am I",
+		Tags:     []string{"auth"},
+		Response: Principal{},
+		Auth:     true,
+	})
+	DescribeHandler((*Controller).MyPermissions, APIOperation{
+		Summary:  "My permissions",
+		Tags:     []string{"auth"},
+		Response: []string{},
+		Auth:     true,
+	})
+
+	DescribeHandler((*Controller).Upload, APIOperation{
+		Summary: "Upload files",
+		Description: "Saves files of a multipart/form-data body, or the whole body of any other type as a single file. " +
+			"Files are streamed to storage, the size of body is capped by body limit of the route. " +
+			"Idempotency-Key is ignored as bodies are never buffered.",
+		Tags:            []string{"uploads"},
+		Query:           uploadQuery{},
+		Response:        uploadResponse{},
+		Errors:          []*errorcode.Error{errorcode.ErrBadBinding, errorcode.ErrPayloadTooLarge, errorcode.ErrForbidden},
+		Auth:            true,
+		SkipIdempotency: true,
+	})
+
+	DescribeHandler((*Controller).GetLogLevel, APIOperation{
+		Summary:  "Current log level",
+		Tags:     []string{"admin"},
+		Response: logLevelResponse{},
+		Errors:   []*errorcode.Error{errorcode.ErrForbidden},
+		Auth:     true,
+	})
+	DescribeHandler((*Controller).SetLogLevel, APIOperation{
+		Summary:     "Change log level",
+		Description: "Changes log level at runtime until restarting, sending SIGUSR1 toggles debug level as well.",
+		Tags:        []string{"admin"},
+		Request:     logLevelRequest{},
+		Response:    logLevelResponse{},
+		Errors:      []*errorcode.Error{errorcode.ErrForbidden},
+		Auth:        true,
+	})
+	DescribeHandler((*Controller).AuditRecords, APIOperation{
+		Summary: "Query audit records",
+		Description: "Lists API calls saved for compliance, the latest first. " +
+			"Bodies are redacted and cut as in audit log. Pass beforeID for the next page.",
+		Tags:     []string{"admin"},
+		Query:    auditRecordsQuery{},
+		Response: auditRecordsResponse{},
+		Errors:   []*errorcode.Error{errorcode.ErrForbidden, errorcode.ErrValidationFailed},
+		Auth:     true,
+	})
+	DescribeHandler((*Controller).GetUserRoles, APIOperation{
+		Summary:     "Roles of a user",
+		Description: "Responds ETag of the user's version, which is sent back in If-Match when changing roles.",
+		Tags:        []string{"admin"},
+		Response:    userRolesResponse{},
+		Errors:      []*errorcode.Error{errorcode.ErrUserNotFound, errorcode.ErrForbidden},
+		Auth:        true,
+	})
+	DescribeHandler((*Controller).UpdateUserRoles, APIOperation{
+		Summary: "Change roles of a user",
+		Description: "Replaces roles of the user and ends sessions of the user, so that they log in again with new roles. " +
+			"When the caller changes roles of itself, its session is rotated instead, the response carries the new CSRF token. " +
+			"Send If-Match with ETag from reading roles, which fails with 412 if the user has been changed since.",
+		Tags:     []string{"admin"},
+		Request:  userRolesRequest{},
+		Response: userRolesResponse{},
+		Errors:   []*errorcode.Error{errorcode.ErrUserNotFound, errorcode.ErrPreconditionFailed, errorcode.ErrForbidden},
+		Auth:     true,
+	})
+}
+
+// APIDocument generates OpenAPI document of routes
+func (con *Controller) APIDocument(routes gin.RoutesInfo) *openapi.Document {
+	generator := openapi.NewGenerator()
+	envelope := generator.Define("R", &openapi.Schema{
+		Type:        "object",
+		Description: "Envelope of every JSON response, code is 0 on success.",
+		Properties: map[string]*openapi.Schema{
+			"code":    {Type: "integer", Description: "0 on success, otherwise an error code"},
+			"msg":     {Type: "string"},
+			"data":    {Description: "payload on success"},
+			"details": {Description: "details on error, e.g. invalid fields"},
+		},
+		Required: []string{"code", "msg", "data"},
+	})
+	generator.Schema(FieldError{})
+
+	var catalog bytes.Buffer
+	_ = errorcode.WriteMarkdown(&catalog, errorcode.Entries(nil))
+
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       version.Name + " API",
+			Description: "Error codes:\n\n" + catalog.String(),
+			Version:     version.Version,
+		},
+		Paths: make(map[string]*openapi.PathItem),
+		Components: openapi.Components{
+			SecuritySchemes: map[string]*openapi.SecurityScheme{
+				securityBearer: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "API key or JWT",
+				},
+				securityToken: {
+					Type:        "apiKey",
+					In:          openapi.InHeader,
+					Name:        tokenHeader,
+					Description: "API key or JWT",
+				},
+				securitySession: {
+					Type:        "apiKey",
+					In:          "cookie",
+					Name:        con.Session.CookieName,
+					Description: "Cookie session, unsafe methods also require " + csrfTokenHeader + " header",
+				},
+			},
+		},
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+
+	hasGet := make(map[string]bool)
+	for _, route := range routes {
+		if route.Method == http.MethodGet {
+			hasGet[route.Path] = true
+		}
+	}
+
+	operationIDs := make(map[string]bool)
+	for _, route := range routes {
+		if route.Method == http.MethodHead && hasGet[route.Path] {
+			// HEAD is implied by GET
+			continue
+		}
+
+		annotation, found := apiOperationOf(route.Handler)
+		if annotation.Hidden {
+			continue
+		}
+		if !found {
+			annotation.Summary = "Undocumented"
+		}
+
+		path, params := openAPIPath(route.Path)
+		operation := &openapi.Operation{
+			Tags:        annotation.Tags,
+			Summary:     annotation.Summary,
+			Description: annotation.Description,
+			OperationID: operationID(route, operationIDs),
+			Parameters:  append(params, generator.Parameters(annotation.Query, openapi.InQuery)...),
+			Responses:   make(map[string]*openapi.Response),
+		}
+
+		if annotation.Request != nil {
+			operation.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content: map[string]openapi.MediaType{
+					gin.MIMEJSON: {Schema: generator.Schema(annotation.Request)},
+				},
+			}
+		}
+
+		if annotation.ContentType != "" {
+			operation.Responses[strconv.Itoa(http.StatusOK)] = &openapi.Response{
+				Description: http.StatusText(http.StatusOK),
+				Content: map[string]openapi.MediaType{
+					annotation.ContentType: {Schema: &openapi.Schema{Type: "string"}},
+				},
+			}
+		} else {
+			data := &openapi.Schema{Nullable: true}
+			if annotation.Response != nil {
+				data = generator.Schema(annotation.Response)
+			}
+			operation.Responses[strconv.Itoa(http.StatusOK)] = &openapi.Response{
+				Description: http.StatusText(http.StatusOK),
+				Content: map[string]openapi.MediaType{
+					gin.MIMEJSON: {Schema: &openapi.Schema{
+						AllOf: []*openapi.Schema{envelope, {
+							Type:       "object",
+							Properties: map[string]*openapi.Schema{"data": data},
+						}},
+					}},
+				},
+			}
+		}
+
+		errs := append([]*errorcode.Error(nil), annotation.Errors...)
+		if annotation.Request != nil {
+			errs = append(errs, errorcode.ErrBadBinding, errorcode.ErrValidationFailed, errorcode.ErrPayloadTooLarge)
+		}
+		if annotation.Auth {
+			errs = append(errs, errorcode.ErrUnauthorized)
+			if !isSafeMethod(route.Method) && !annotation.SkipIdempotency {
+				errs = append(errs, errorcode.ErrInvalidCSRFToken,
+					errorcode.ErrInvalidIdempotencyKey, errorcode.ErrIdempotencyKeyReused, errorcode.ErrIdempotencyKeyInFlight)
+				maxKeyLength := maxIdempotencyKeyLength
+				operation.Parameters = append(operation.Parameters, &openapi.Parameter{
+					Name: idempotencyKeyHeader,
+					In:   openapi.InHeader,
+					Description: fmt.Sprintf("Unique key of at most %d characters, retries with the same key get the recorded response "+
+						"with header %s instead of running again.", maxIdempotencyKeyLength, idempotentReplayedHeader),
+					Schema: &openapi.Schema{Type: "string", MaxLength: &maxKeyLength},
+				})
+			}
+			operation.Security = []openapi.SecurityRequirement{
+				{securityBearer: {}},
+				{securityToken: {}},
+				{securitySession: {}},
+			}
+		}
+		addErrorResponses(operation, envelope, errs)
+
+		if route.Method == http.MethodGet && annotation.ContentType != sseContentType {
+			// see ConditionalMiddleware
+			operation.Responses[strconv.Itoa(http.StatusNotModified)] = &openapi.Response{
+				Description: "Not Modified, the representation matches If-None-Match or If-Modified-Since",
+			}
+		}
+
+		item := doc.Paths[path]
+		if item == nil {
+			item = &openapi.PathItem{}
+			doc.Paths[path] = item
+		}
+		(*item)[strings.ToLower(route.Method)] = operation
+	}
+
+	doc.Components.Schemas = generator.Schemas()
+	return doc
+}
+
+// addErrorResponses groups errors by HTTP status
+func addErrorResponses(operation *openapi.Operation, envelope *openapi.Schema, errs []*errorcode.Error) {
+	byStatus := make(map[int][]*errorcode.Error)
+	for _, e := range errs {
+		byStatus[e.StatusCode()] = append(byStatus[e.StatusCode()], e)
+	}
+
+	for status, errs := range byStatus {
+		sort.Slice(errs, func(i, j int) bool {
+			return errs[i].Code() < errs[j].Code()
+		})
+
+		var (
+			codes        []interface{}
+			descriptions []string
+			seen         = make(map[int]bool)
+		)
+		for _, e := range errs {
+			if seen[e.Code()] {
+				continue
+			}
+			seen[e.Code()] = true
+			codes = append(codes, e.Code())
+			descriptions = append(descriptions, fmt.Sprintf("%d %s", e.Code(), e.Message()))
+		}
+
+		operation.Responses[strconv.Itoa(status)] = &openapi.Response{
+			Description: strings.Join(descriptions, "; "),
+			Content: map[string]openapi.MediaType{
+				gin.MIMEJSON: {Schema: &openapi.Schema{
+					AllOf: []*openapi.Schema{envelope, {
+						Type: "object",
+						Properties: map[string]*openapi.Schema{
+							"code": {Type: "integer", Enum: codes},
+						},
+					}},
+				}},
+			},
+		}
+	}
+}
+
+// openAPIPath turns "/api/users/:id" into "/api/users/{id}" along with its parameters.
+func openAPIPath(ginPath string) (path string, params []*openapi.Parameter) {
+	segments := strings.Split(ginPath, "/")
+	for i, segment := range segments {
+		if segment == "" || (segment[0] != ':' && segment[0] != '*') {
+			continue
+		}
+
+		name := segment[1:]
+		segments[i] = "{" + name + "}"
+		params = append(params, &openapi.Parameter{
+			Name:     name,
+			In:       openapi.InPath,
+			Required: true,
+			Schema:   &openapi.Schema{Type: "string"},
+		})
+	}
+
+	path = strings.Join(segments, "/")
+	return
+}
+
+// operationID is the handler method name, suffixed with method on collision.
+func operationID(route gin.RouteInfo, taken map[string]bool) (id string) {
+	id = normalizeHandlerName(route.Handler)
+	if dot := strings.LastIndexByte(id, '.'); dot >= 0 {
+		id = id[dot+1:]
+	}
+	if taken[id] {
+		id += strings.Title(strings.ToLower(route.Method))
+	}
+	taken[id] = true
+
+	return
+}
+
+// OpenAPI serves OpenAPI document of registered routes
+func (con *Controller) OpenAPI(c *gin.Context) {
+	con.apiDocOnce.Do(func() {
+		var routes gin.RoutesInfo
+		if con.routes != nil {
+			routes = con.routes()
+		}
+		con.apiDoc, con.apiDocErr = json.Marshal(con.APIDocument(routes))
+	})
+	if con.apiDocErr != nil {
+		_ = c.Error(fmt.Errorf("marshaling API document: %w", con.apiDocErr))
+		return
+	}
+
+	skipLogging(c)
+	c.Data(http.StatusOK, gin.MIMEJSON, con.apiDoc)
+}
+
+//go:embed telescope-api.html
+var apiDocPageContent []byte
+
+// APIDocPage renders OpenAPI document for human
+func (con *Controller) APIDocPage(c *gin.Context) {
+	skipLogging(c)
+	c.Data(http.StatusOK, "text/html; charset=utf-8", apiDocPageContent)
+}
+
+// GenerateAPIDocument generates OpenAPI document without starting a server, e.g. for CLI.
+func GenerateAPIDocument(config Config) *openapi.Document {
+	control := &Controller{
+		Session: config.Session.withDefaults(),
+	}
+
+	g := gin.New()
+	registerRoutes(g, control)
+
+	return control.APIDocument(g.Routes())
+}
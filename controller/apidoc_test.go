@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"telescope/errorcode"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_openAPIPath(t *testing.T) {
+	tests := []struct {
+		ginPath    string
+		wantPath   string
+		wantParams []string
+	}{
+		{ginPath: "/api/hello", wantPath: "/api/hello"},
+		{ginPath: "/api/users/:id", wantPath: "/api/users/{id}", wantParams: []string{"id"}},
+		{ginPath: "/api/users/:id/posts/:postID", wantPath: "/api/users/{id}/posts/{postID}", wantParams: []string{"id", "postID"}},
+		{ginPath: "/static/*filepath", wantPath: "/static/{filepath}", wantParams: []string{"filepath"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ginPath, func(t *testing.T) {
+			path, params := openAPIPath(tt.ginPath)
+			assert.Equal(t, tt.wantPath, path)
+
+			var names []string
+			for _, param := range params {
+				names = append(names, param.Name)
+				assert.True(t, param.Required)
+			}
+			assert.Equal(t, tt.wantParams, names)
+		})
+	}
+}
+
+func TestController_APIDocument(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	control := &Controller{
+		Session: SessionConfig{}.withDefaults(),
+	}
+	g := gin.New()
+	registerRoutes(g, control)
+	doc := control.APIDocument(g.Routes())
+
+	t.Run("hidden", func(t *testing.T) {
+		assert.NotContains(t, doc.Paths, "/")
+		assert.NotContains(t, doc.Paths, "/api/openapi.json")
+	})
+
+	t.Run("HEAD is folded into GET", func(t *testing.T) {
+		item := doc.Paths["/api/hello"]
+		require.NotNil(t, item)
+		assert.Contains(t, *item, "get")
+		assert.NotContains(t, *item, "head")
+		assert.Contains(t, (*item)["get"].Responses, statusKey(http.StatusNotModified))
+	})
+
+	t.Run("request body implies binding errors", func(t *testing.T) {
+		login := (*doc.Paths["/api/session"])["post"]
+		require.NotNil(t, login)
+		assert.Equal(t, "Login", login.OperationID)
+		assert.Equal(t, "#/components/schemas/LoginRequest", login.RequestBody.Content[gin.MIMEJSON].Schema.Ref)
+		assert.Nil(t, login.Security)
+		for _, e := range []*errorcode.Error{errorcode.ErrBadBinding, errorcode.ErrValidationFailed, errorcode.ErrUnauthorized} {
+			assert.Contains(t, login.Responses, statusKey(e.StatusCode()))
+		}
+	})
+
+	t.Run("auth implies security, CSRF and Idempotency-Key on unsafe methods", func(t *testing.T) {
+		logout := (*doc.Paths["/api/session"])["delete"]
+		require.NotNil(t, logout)
+		assert.Len(t, logout.Security, 3)
+		assert.Contains(t, logout.Responses, statusKey(http.StatusUnauthorized))
+		assert.Contains(t, logout.Responses, statusKey(http.StatusForbidden))
+		assert.Contains(t, logout.Responses, statusKey(http.StatusConflict))
+		require.NotEmpty(t, logout.Parameters)
+		assert.Equal(t, idempotencyKeyHeader, logout.Parameters[len(logout.Parameters)-1].Name)
+
+		current := (*doc.Paths["/api/session"])["get"]
+		require.NotNil(t, current)
+		assert.NotContains(t, current.Responses, statusKey(http.StatusForbidden))
+		assert.Empty(t, current.Parameters)
+	})
+
+	t.Run("If-Match fails with 412", func(t *testing.T) {
+		update := (*doc.Paths["/api/admin/users/{id}/roles"])["put"]
+		require.NotNil(t, update)
+		assert.Contains(t, update.Responses, statusKey(http.StatusPreconditionFailed))
+	})
+
+	assert.Equal(t, "telescope_session", doc.Components.SecuritySchemes[securitySession].Name)
+	assert.Contains(t, doc.Components.Schemas, "R")
+	assert.Contains(t, doc.Components.Schemas, "SessionResponse")
+}
+
+func statusKey(status int) string {
+	return strconv.Itoa(status)
+}
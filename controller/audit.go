@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"telescope/database"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// permissionAudit is required to query audit records
+	permissionAudit = "admin:audit"
+
+	defaultAuditRecordsLimit = 100
+)
+
+type auditRecordsQuery struct {
+	Principal string    `form:"principal" description:"ID of user or API key"`
+	From      time.Time `form:"from" time_format:"2006-01-02T15:04:05Z07:00" description:"RFC 3339, inclusive"`
+	To        time.Time `form:"to" time_format:"2006-01-02T15:04:05Z07:00" binding:"omitempty,gtfield=From" description:"RFC 3339, exclusive"`
+	BeforeID  int64     `form:"beforeID" binding:"omitempty,gte=1" description:"ID of the last record of previous page"`
+	Limit     int       `form:"limit" binding:"omitempty,gte=1,lte=1000" description:"defaults to 100"`
+}
+
+type auditRecordsResponse struct {
+	Records []database.AuditRecord `json:"records"`
+}
+
+// AuditRecords lists saved audit records, the latest first.
+func (con *Controller) AuditRecords(c *gin.Context) {
+	var query auditRecordsQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+	if query.Limit == 0 {
+		query.Limit = defaultAuditRecordsLimit
+	}
+
+	records, err := con.DB.QueryAuditRecords(c.Request.Context(), database.AuditRecordFilter{
+		Principal: query.Principal,
+		From:      query.From,
+		To:        query.To,
+		BeforeID:  query.BeforeID,
+		Limit:     query.Limit,
+	})
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+	if records == nil {
+		records = []database.AuditRecord{}
+	}
+
+	ok(c, auditRecordsResponse{Records: records})
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telescope/database"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type recordingSink struct {
+	records []*database.AuditRecord
+}
+
+func (s *recordingSink) Write(record *database.AuditRecord) {
+	s.records = append(s.records, record)
+}
+
+func TestController_LogMiddleware_auditSink(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	sink := new(recordingSink)
+	con := &Controller{
+		Logger:    zap.NewNop(),
+		AuditSink: sink,
+	}
+
+	g := gin.New()
+	g.Use(con.LogMiddleware, con.PayloadAuditLogMiddleware(), func(c *gin.Context) {
+		c.Set(ctxPrincipalKey, &Principal{ID: "alice"})
+	})
+	g.POST("/users/:id", func(c *gin.Context) {
+		_, _ = io.ReadAll(c.Request.Body)
+		c.Status(http.StatusNoContent)
+	})
+	g.GET("/hello", func(c *gin.Context) {
+		skipLogging(c)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/users/42", strings.NewReader(`{"password":"123456"}`))
+	req.Header.Set("Content-Type", "application/json")
+	g.ServeHTTP(httptest.NewRecorder(), req)
+	g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/hello", nil))
+
+	require.Len(t, sink.records, 1)
+	record := sink.records[0]
+	assert.Equal(t, "alice", record.Principal)
+	assert.Equal(t, http.MethodPost, record.Method)
+	assert.Equal(t, "/users/:id", record.Route)
+	assert.Equal(t, "/users/42", record.Path)
+	assert.Equal(t, http.StatusNoContent, record.Status)
+	assert.Equal(t, `{"password":"[REDACTED]"}`, record.RequestBody)
+	assert.False(t, record.CreatedAt.IsZero())
+}
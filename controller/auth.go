@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"telescope/database"
+	"telescope/errorcode"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	ctxPrincipalKey = "principal"
+
+	// tokenHeader is the header name allowed by default CORS policy
+	tokenHeader = "Token"
+)
+
+// Kinds of principal
+const (
+	PrincipalKindAPIKey = "apiKey"
+	PrincipalKindJWT    = "jwt"
+)
+
+// errCredentialNotSupported is returned by Authenticator
+// when credential is not in the format it knows.
+var errCredentialNotSupported = errors.New("credential not supported")
+
+// AuthConfig config on authentication
+type AuthConfig struct {
+	// APIKey enables API keys stored in Postgres
+	APIKey bool
+	// JWT is enabled when JWT.KeyDir is not empty
+	JWT JWTConfig
+}
+
+// Principal is who the caller is
+type Principal struct {
+	// ID of user or API key
+	ID string `json:"id"`
+	// Kind of credential the principal is authenticated by
+	Kind  string   `json:"kind"`
+	Roles []string `json:"roles"`
+}
+
+// Authenticator tells who the caller is by credential
+type Authenticator interface {
+	// Authenticate returns errCredentialNotSupported if
+	// credential is not in the format it knows,
+	// so that next Authenticator can have a try.
+	Authenticate(ctx context.Context, credential string) (principal *Principal, err error)
+}
+
+// newAuthenticators builds authenticators enabled by config
+func newAuthenticators(config AuthConfig, db *database.DB) (authenticators []Authenticator, err error) {
+	if config.JWT.KeyDir != "" {
+		var jwtAuthenticator *JWTAuthenticator
+		jwtAuthenticator, err = NewJWTAuthenticator(config.JWT)
+		if err != nil {
+			err = fmt.Errorf("NewJWTAuthenticator: %w", err)
+			return
+		}
+		authenticators = append(authenticators, jwtAuthenticator)
+	}
+
+	if config.APIKey {
+		authenticators = append(authenticators, &APIKeyAuthenticator{DB: db})
+	}
+
+	return
+}
+
+// AuthMiddleware authenticates the caller and attaches the principal to gin.Context.
+//
+// Requests without credential or with invalid one pass through anonymously,
+// use RequireAuth to guard routes.
+func (con *Controller) AuthMiddleware(c *gin.Context) {
+	credential := credentialOf(c)
+	if credential == "" || len(con.Authenticators) == 0 {
+		c.Next()
+		return
+	}
+
+	for _, authenticator := range con.Authenticators {
+		principal, err := authenticator.Authenticate(c.Request.Context(), credential)
+		if errors.Is(err, errCredentialNotSupported) {
+			continue
+		}
+		if err != nil {
+			con.loggerOf(c).Debug("authentication failed",
+				zap.String("path", c.Request.URL.Path),
+				zap.String("clientIP", c.ClientIP()),
+				zap.Error(err),
+			)
+			break
+		}
+
+		c.Set(ctxPrincipalKey, principal)
+		break
+	}
+
+	c.Next()
+}
+
+// RequireAuth guards routes from anonymous callers,
+// use it on route groups.
+func (con *Controller) RequireAuth(c *gin.Context) {
+	if _, ok := principalOf(c); ok {
+		c.Next()
+		return
+	}
+
+	if c.GetBool(ctxCSRFRejectedKey) {
+		_ = c.Error(errorcode.ErrInvalidCSRFToken)
+	} else {
+		_ = c.Error(errorcode.ErrUnauthorized)
+	}
+	c.Abort()
+}
+
+// principalOf returns the principal attached by AuthMiddleware
+func principalOf(c *gin.Context) (principal *Principal, ok bool) {
+	value, ok := c.Get(ctxPrincipalKey)
+	if !ok {
+		return
+	}
+
+	principal, ok = value.(*Principal)
+	return
+}
+
+// credentialOf extracts credential from
+// "Authorization: Bearer <credential>" or "Token: <credential>",
+// or from WebSocket subprotocol "access_token.<credential>" since browsers can not set headers on WebSocket.
+func credentialOf(c *gin.Context) string {
+	const bearerPrefix = "Bearer "
+
+	authorization := c.GetHeader("Authorization")
+	if len(authorization) > len(bearerPrefix) && strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return strings.TrimSpace(authorization[len(bearerPrefix):])
+	}
+
+	if token := strings.TrimSpace(c.GetHeader(tokenHeader)); token != "" {
+		return token
+	}
+
+	if websocket.IsWebSocketUpgrade(c.Request) {
+		for _, protocol := range websocket.Subprotocols(c.Request) {
+			if strings.HasPrefix(protocol, wsTokenProtocolPrefix) {
+				return protocol[len(wsTokenProtocolPrefix):]
+			}
+		}
+	}
+
+	return ""
+}
+
+// Whoami tells the caller who it is
+func (con *Controller) Whoami(c *gin.Context) {
+	principal, _ := principalOf(c)
+	ok(c, principal)
+}
+
+// APIKeyAuthenticator authenticates static API keys hashed in Postgres
+type APIKeyAuthenticator struct {
+	DB *database.DB
+}
+
+// Authenticate implements Authenticator
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, credential string) (principal *Principal, err error) {
+	// JWT has dots while API keys don't
+	if strings.Contains(credential, ".") {
+		err = errCredentialNotSupported
+		return
+	}
+
+	key, err := a.DB.APIKeyByHash(ctx, hashAPIKey(credential))
+	if err != nil {
+		err = fmt.Errorf("APIKeyByHash: %w", err)
+		return
+	}
+	if key == nil {
+		err = errors.New("no such API key")
+		return
+	}
+	if !key.Usable(time.Now()) {
+		err = fmt.Errorf("API key %d is expired or revoked", key.ID)
+		return
+	}
+
+	principal = &Principal{
+		ID:    fmt.Sprintf("apiKey:%d", key.ID),
+		Kind:  PrincipalKindAPIKey,
+		Roles: key.Roles,
+	}
+	return
+}
+
+// GenerateAPIKey generates a new API key and its hash.
+//
+// Hand the key to its holder and save only the hash with database.CreateAPIKey.
+func GenerateAPIKey() (key, keyHash string, err error) {
+	key, err = secureToken(44)
+	if err != nil {
+		err = fmt.Errorf("secureToken: %w", err)
+		return
+	}
+
+	keyHash = hashAPIKey(key)
+	return
+}
+
+// hashAPIKey API keys are long random strings,
+// SHA-256 is good enough for them.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
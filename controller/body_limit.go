@@ -0,0 +1,172 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"telescope/errorcode"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxRequestBodyBytes = 256 << 10
+
+	// ctxBodyLimitKey holds body limit of current route in bytes
+	ctxBodyLimitKey = "bodyLimit"
+)
+
+// errBodyTooLarge is returned by reading body beyond limit, ErrorMiddleware translates it into 413.
+var errBodyTooLarge = errors.New("request body is too large")
+
+// BodyLimitConfig caps request body size by route
+type BodyLimitConfig struct {
+	// DefaultBytes caps bodies of routes without a rule, defaults to 256 KiB
+	DefaultBytes int
+	// Routes override DefaultBytes for groups of routes
+	Routes []BodyLimitRule
+}
+
+// BodyLimitRule caps bodies of routes under Prefix
+type BodyLimitRule struct {
+	// Prefix of route templates like "/api/uploads", matching whole segments.
+	// The longest matching prefix wins.
+	Prefix string
+	// MaxBytes of request body, must be positive
+	MaxBytes int
+}
+
+// bodyLimiter tells body limit of routes, use newBodyLimiter to create one.
+type bodyLimiter struct {
+	defaultBytes int
+	// rules with longer prefix first
+	rules []BodyLimitRule
+}
+
+func newBodyLimiter(config BodyLimitConfig) (limiter *bodyLimiter, err error) {
+	limiter = &bodyLimiter{
+		defaultBytes: config.DefaultBytes,
+		rules:        make([]BodyLimitRule, 0, len(config.Routes)),
+	}
+	if limiter.defaultBytes <= 0 {
+		limiter.defaultBytes = defaultMaxRequestBodyBytes
+	}
+
+	for _, rule := range config.Routes {
+		rule.Prefix, err = normalizeRoutePrefix(rule.Prefix)
+		if err != nil {
+			limiter = nil
+			err = fmt.Errorf("body limit: %w", err)
+			return
+		}
+		if rule.MaxBytes <= 0 {
+			limiter = nil
+			err = fmt.Errorf("body limit of prefix %q must be positive, got %d", rule.Prefix, rule.MaxBytes)
+			return
+		}
+
+		limiter.rules = append(limiter.rules, rule)
+	}
+	sort.SliceStable(limiter.rules, func(i, j int) bool {
+		return len(limiter.rules[i].Prefix) > len(limiter.rules[j].Prefix)
+	})
+
+	return
+}
+
+// limitOf route template in bytes
+func (l *bodyLimiter) limitOf(route string) int {
+	for _, rule := range l.rules {
+		if matchRoutePrefix(route, rule.Prefix) {
+			return rule.MaxBytes
+		}
+	}
+
+	return l.defaultBytes
+}
+
+// normalizeRoutePrefix checks prefix of route rules and trims trailing slash
+func normalizeRoutePrefix(prefix string) (normalized string, err error) {
+	if !strings.HasPrefix(prefix, "/") {
+		err = fmt.Errorf("route prefix %q must start with /", prefix)
+		return
+	}
+
+	normalized = strings.TrimSuffix(prefix, "/")
+	return
+}
+
+// matchRoutePrefix tells whether route template is under normalized prefix by whole segments
+func matchRoutePrefix(route, prefix string) bool {
+	return route == prefix || strings.HasPrefix(route, prefix+"/")
+}
+
+// LimitReaderMiddleware limits the request size by route,
+// oversized requests get 413 whether Content-Length tells it or not.
+//
+// Use it inside ErrorMiddleware.
+func (con *Controller) LimitReaderMiddleware() func(c *gin.Context) {
+	limiter := con.bodyLimiter
+	if limiter == nil {
+		// default config always works
+		limiter, _ = newBodyLimiter(BodyLimitConfig{})
+	}
+
+	return func(c *gin.Context) {
+		limit := limiter.limitOf(c.FullPath())
+		c.Set(ctxBodyLimitKey, limit)
+
+		if c.Request.ContentLength > int64(limit) {
+			_ = c.Error(errPayloadTooLarge(limit))
+			c.Abort()
+			return
+		}
+
+		c.Request.Body = &limitedBody{
+			ReadCloser: c.Request.Body,
+			left:       limit,
+			limit:      limit,
+		}
+
+		c.Next()
+	}
+}
+
+func errPayloadTooLarge(limit int) *errorcode.Error {
+	return errorcode.ErrPayloadTooLarge.WithParams(map[string]string{"limit": strconv.Itoa(limit)})
+}
+
+// limitedBody fails with errBodyTooLarge once more than limit bytes are read,
+// while a body of exactly limit bytes ends with io.EOF as usual.
+type limitedBody struct {
+	io.ReadCloser
+	// left is negative once body is too large
+	left  int
+	limit int
+}
+
+func (b *limitedBody) Read(p []byte) (n int, err error) {
+	if b.left < 0 {
+		err = fmt.Errorf("limit is %d bytes: %w", b.limit, errBodyTooLarge)
+		return
+	}
+	if len(p) == 0 {
+		return
+	}
+
+	// one more byte tells whether body ends at limit
+	if len(p) > b.left+1 {
+		p = p[:b.left+1]
+	}
+	n, err = b.ReadCloser.Read(p)
+	b.left -= n
+	if b.left < 0 {
+		n += b.left
+		err = fmt.Errorf("limit is %d bytes: %w", b.limit, errBodyTooLarge)
+	}
+
+	return
+}
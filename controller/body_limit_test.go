@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telescope/errorcode"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func Test_bodyLimiter_limitOf(t *testing.T) {
+	limiter, err := newBodyLimiter(BodyLimitConfig{
+		DefaultBytes: 100,
+		Routes: []BodyLimitRule{
+			{Prefix: "/api/uploads/", MaxBytes: 1000},
+			{Prefix: "/api/uploads/avatars", MaxBytes: 10},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		route string
+		want  int
+	}{
+		{route: "/api/uploads", want: 1000},
+		{route: "/api/uploads/:id", want: 1000},
+		{route: "/api/uploads/avatars", want: 10},
+		{route: "/api/uploadsX", want: 100},
+		{route: "", want: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			assert.Equal(t, tt.want, limiter.limitOf(tt.route))
+		})
+	}
+}
+
+func Test_newBodyLimiter_badRule(t *testing.T) {
+	_, err := newBodyLimiter(BodyLimitConfig{Routes: []BodyLimitRule{{Prefix: "api", MaxBytes: 1}}})
+	assert.Error(t, err)
+	_, err = newBodyLimiter(BodyLimitConfig{Routes: []BodyLimitRule{{Prefix: "/api"}}})
+	assert.Error(t, err)
+}
+
+func TestController_LimitReaderMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	limiter, err := newBodyLimiter(BodyLimitConfig{
+		DefaultBytes: 8,
+		Routes:       []BodyLimitRule{{Prefix: "/uploads", MaxBytes: 16}},
+	})
+	require.NoError(t, err)
+	con := &Controller{
+		Logger:      zap.NewNop(),
+		bodyLimiter: limiter,
+	}
+
+	g := gin.New()
+	g.Use(con.ErrorMiddleware, con.LimitReaderMiddleware())
+	echo := func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		c.String(http.StatusOK, string(body))
+	}
+	g.POST("/echo", echo)
+	g.POST("/uploads", echo)
+
+	tests := []struct {
+		testName   string
+		path       string
+		body       string
+		chunked    bool
+		wantStatus int
+	}{
+		{testName: "within default", path: "/echo", body: "12345678", wantStatus: http.StatusOK},
+		{testName: "over default", path: "/echo", body: "123456789", wantStatus: http.StatusRequestEntityTooLarge},
+		{testName: "over default without content length", path: "/echo", body: "123456789", chunked: true, wantStatus: http.StatusRequestEntityTooLarge},
+		{testName: "within route limit", path: "/uploads", body: "123456789", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+			if tt.chunked {
+				req.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.body, w.Body.String())
+				return
+			}
+
+			var resp R
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, errorcode.CodePayloadTooLarge, resp.Code)
+			assert.Equal(t, "Request body is larger than 8 bytes", resp.Msg)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"telescope/errorcode"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxETagBodySize responses larger than this are streamed as is without ETag,
+// rather than held in memory to be hashed.
+const maxETagBodySize = 1 << 20
+
+// ConditionalMiddleware answers conditional GET and HEAD with 304 Not Modified.
+//
+// Successful responses get a strong ETag hashed from body unless the handler sets one,
+// which is compared with If-None-Match, while If-Modified-Since is compared with
+// Last-Modified set by the handler. Handlers knowing versions of resources
+// can use notModified to skip building responses,
+// while handlers of PUT and PATCH check If-Match by preconditionsMet.
+//
+// Use it inside gzip middleware so that ETag is computed on identity body,
+// gzip middleware weakens the ETag when compressing, which still matches If-None-Match.
+// Use it inside ErrorMiddleware so that errors are not buffered.
+func (con *Controller) ConditionalMiddleware(c *gin.Context) {
+	if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+		c.Next()
+		return
+	}
+
+	writer := &bufferingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	defer func() {
+		c.Writer = writer.ResponseWriter
+	}()
+
+	c.Next()
+
+	if writer.passthrough || writer.buf.Len() == 0 {
+		return
+	}
+
+	header := writer.Header()
+	if writer.Status() == http.StatusOK && len(c.Errors) == 0 {
+		if header.Get("ETag") == "" {
+			header.Set("ETag", strongETag(writer.buf.Bytes()))
+		}
+
+		if isNotModified(c.Request, header.Get("ETag"), header.Get("Last-Modified")) {
+			header.Del("Content-Type")
+			header.Del("Content-Length")
+			writer.ResponseWriter.WriteHeader(http.StatusNotModified)
+			writer.ResponseWriter.WriteHeaderNow()
+			return
+		}
+	}
+
+	_, _ = writer.ResponseWriter.Write(writer.buf.Bytes())
+}
+
+// bufferingWriter holds body until the handler finishes,
+// it gives up buffering once the handler flushes, which means streaming,
+// or once body grows beyond maxETagBodySize.
+type bufferingWriter struct {
+	gin.ResponseWriter
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (w *bufferingWriter) Write(b []byte) (int, error) {
+	if !w.passthrough && w.buf.Len()+len(b) > maxETagBodySize {
+		w.giveUp()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.Write(b)
+	}
+
+	return w.buf.Write(b)
+}
+
+func (w *bufferingWriter) WriteString(s string) (int, error) {
+	if !w.passthrough && w.buf.Len()+len(s) > maxETagBodySize {
+		w.giveUp()
+	}
+	if w.passthrough {
+		return w.ResponseWriter.WriteString(s)
+	}
+
+	return w.buf.WriteString(s)
+}
+
+// Written tells whether the handler has responded, though the body may be in buffer.
+func (w *bufferingWriter) Written() bool {
+	return w.buf.Len() > 0 || w.ResponseWriter.Written()
+}
+
+// Size counts buffered body as written
+func (w *bufferingWriter) Size() int {
+	if w.passthrough || w.buf.Len() == 0 {
+		return w.ResponseWriter.Size()
+	}
+
+	return w.buf.Len()
+}
+
+func (w *bufferingWriter) Flush() {
+	if !w.passthrough {
+		w.giveUp()
+	}
+
+	w.ResponseWriter.Flush()
+}
+
+// giveUp buffering, writing out what is buffered
+func (w *bufferingWriter) giveUp() {
+	w.passthrough = true
+	if w.buf.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+// strongETag of body
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return quoteETag(base64.RawURLEncoding.EncodeToString(sum[:18]))
+}
+
+// quoteETag makes an ETag of opaque tag, e.g. version of a resource,
+// which must not contain double quotes.
+func quoteETag(tag string) string {
+	return `"` + tag + `"`
+}
+
+// notModified sets validators of the current resource,
+// etag is made by quoteETag, either validator can be empty or zero.
+// It tells whether the request is answered with 304 Not Modified,
+// so that handler can skip building the response.
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	var modified string
+	if etag != "" {
+		c.Header("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		modified = lastModified.UTC().Format(http.TimeFormat)
+		c.Header("Last-Modified", modified)
+	}
+
+	if !isNotModified(c.Request, etag, modified) {
+		return false
+	}
+
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// preconditionsMet evaluates If-Match and If-Unmodified-Since against validators of the current resource,
+// which guards PUT and PATCH from overwriting changes made by others since the client read the resource.
+// etag is made by quoteETag, either validator can be empty or zero.
+//
+// It responds ErrPreconditionFailed and returns false when any precondition fails.
+func preconditionsMet(c *gin.Context, etag string, lastModified time.Time) bool {
+	var met bool
+	if ifMatch := c.GetHeader("If-Match"); ifMatch != "" {
+		// ETag is weakened by gzip middleware only for content coding,
+		// so weak tags from clients are compared by opaque tag as well.
+		met = etag != "" && etagListMatches(ifMatch, etag)
+	} else if since, err := http.ParseTime(c.GetHeader("If-Unmodified-Since")); err == nil && !lastModified.IsZero() {
+		met = !lastModified.Truncate(time.Second).After(since)
+	} else {
+		met = true
+	}
+
+	if !met {
+		_ = c.Error(errorcode.ErrPreconditionFailed)
+		c.Abort()
+	}
+
+	return met
+}
+
+// isNotModified evaluates If-None-Match, then If-Modified-Since when the former is absent,
+// against validators of the response.
+func isNotModified(r *http.Request, etag, lastModified string) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etag != "" && etagListMatches(ifNoneMatch, etag)
+	}
+
+	if lastModified == "" {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(lastModified)
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// etagListMatches tells whether etag is in list like `"a", W/"b"` or is `*`,
+// by weak comparison, i.e. W/ prefix is ignored.
+func etagListMatches(list, etag string) bool {
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	etag = strings.TrimPrefix(etag, "W/")
+	for {
+		list = strings.TrimLeft(list, " \t,")
+		if list == "" {
+			return false
+		}
+
+		list = strings.TrimPrefix(list, "W/")
+		if !strings.HasPrefix(list, `"`) {
+			// malformed
+			return false
+		}
+		end := strings.IndexByte(list[1:], '"')
+		if end < 0 {
+			return false
+		}
+		if list[:end+2] == etag {
+			return true
+		}
+		list = list[end+2:]
+	}
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nanmu42/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestController_ConditionalMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var (
+		bigBody      = strings.Repeat("telescope ", 1024)
+		lastModified = time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+		hugeStreamed bool
+	)
+
+	con := &Controller{Logger: zap.NewNop()}
+	g := gin.New()
+	g.Use(gzip.DefaultHandler().Gin, con.ErrorMiddleware, con.ConditionalMiddleware)
+	g.GET("/big", func(c *gin.Context) {
+		c.String(http.StatusOK, bigBody)
+	})
+	g.GET("/versioned", func(c *gin.Context) {
+		if notModified(c, quoteETag("v2"), lastModified) {
+			return
+		}
+		c.String(http.StatusOK, "version 2")
+	})
+	g.GET("/huge", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		chunk := strings.Repeat("x", 64<<10)
+		for written := 0; written <= maxETagBodySize; written += len(chunk) {
+			_, _ = c.Writer.WriteString(chunk)
+		}
+		// streamed beyond the cap rather than buffered
+		writer, ok := c.Writer.(*bufferingWriter)
+		hugeStreamed = ok && writer.passthrough && writer.buf.Len() == 0
+	})
+	g.GET("/failed", func(c *gin.Context) {
+		c.String(http.StatusInternalServerError, "oops")
+	})
+
+	serve := func(path string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("ETag from body", func(t *testing.T) {
+		w := serve("/big", nil)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, bigBody, w.Body.String())
+		etag := w.Header().Get("ETag")
+		assert.Equal(t, strongETag([]byte(bigBody)), etag)
+
+		w = serve("/big", map[string]string{"If-None-Match": `"stale", ` + etag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Empty(t, w.Header().Get("Content-Type"))
+	})
+
+	t.Run("gzip weakens ETag which still matches", func(t *testing.T) {
+		w := serve("/big", map[string]string{"Accept-Encoding": "gzip"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		etag := w.Header().Get("ETag")
+		assert.Equal(t, "W/"+strongETag([]byte(bigBody)), etag)
+
+		w = serve("/big", map[string]string{"Accept-Encoding": "gzip", "If-None-Match": etag})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("version ETag", func(t *testing.T) {
+		w := serve("/versioned", map[string]string{"If-None-Match": `"v1"`})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `"v2"`, w.Header().Get("ETag"))
+		assert.Equal(t, "Tue, 01 Jun 2021 08:00:00 GMT", w.Header().Get("Last-Modified"))
+
+		w = serve("/versioned", map[string]string{"If-None-Match": `"v2"`})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Empty(t, w.Body.String())
+	})
+
+	t.Run("If-Modified-Since", func(t *testing.T) {
+		w := serve("/versioned", map[string]string{"If-Modified-Since": "Tue, 01 Jun 2021 08:00:00 GMT"})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		w = serve("/versioned", map[string]string{"If-Modified-Since": "Mon, 31 May 2021 08:00:00 GMT"})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// If-None-Match takes precedence
+		w = serve("/versioned", map[string]string{
+			"If-None-Match":     `"v1"`,
+			"If-Modified-Since": "Tue, 01 Jun 2021 08:00:00 GMT",
+		})
+		assert.Equal(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("huge body is streamed without ETag", func(t *testing.T) {
+		w := serve("/huge", map[string]string{"If-None-Match": "*"})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.True(t, hugeStreamed)
+		assert.Empty(t, w.Header().Get("ETag"))
+		assert.Greater(t, w.Body.Len(), maxETagBodySize)
+		assert.Equal(t, strings.Repeat("x", w.Body.Len()), w.Body.String())
+	})
+
+	t.Run("failure is not validated", func(t *testing.T) {
+		w := serve("/failed", map[string]string{"If-None-Match": "*"})
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+		assert.Empty(t, w.Header().Get("ETag"))
+		assert.Equal(t, "oops", w.Body.String())
+	})
+}
+
+func Test_preconditionsMet(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	lastModified := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		testName string
+		header   map[string]string
+		want     bool
+	}{
+		{testName: "no precondition", want: true},
+		{testName: "matching ETag", header: map[string]string{"If-Match": `"v1", "v2"`}, want: true},
+		{testName: "ETag weakened by gzip", header: map[string]string{"If-Match": `W/"v2"`}, want: true},
+		{testName: "any", header: map[string]string{"If-Match": `*`}, want: true},
+		{testName: "stale ETag", header: map[string]string{"If-Match": `"v1"`}, want: false},
+		{testName: "malformed ETag", header: map[string]string{"If-Match": `v2`}, want: false},
+		{testName: "unmodified", header: map[string]string{"If-Unmodified-Since": "Tue, 01 Jun 2021 08:00:00 GMT"}, want: true},
+		{testName: "modified", header: map[string]string{"If-Unmodified-Since": "Mon, 31 May 2021 08:00:00 GMT"}, want: false},
+		{
+			testName: "If-Match takes precedence",
+			header: map[string]string{
+				"If-Match":            `"v2"`,
+				"If-Unmodified-Since": "Mon, 31 May 2021 08:00:00 GMT",
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodPut, "/api/things/1", nil)
+			for k, v := range tt.header {
+				c.Request.Header.Set(k, v)
+			}
+
+			assert.Equal(t, tt.want, preconditionsMet(c, quoteETag("v2"), lastModified))
+			assert.Equal(t, !tt.want, c.IsAborted())
+		})
+	}
+}
@@ -1,9 +1,39 @@
 package controller
 
+import "telescope/health"
+
 // Config config on controller
 type Config struct {
 	// port which service is listening on
 	Port int
 	// record response body
 	AuditResponse bool
+	// body caps and redaction of payloads in audit log
+	PayloadAudit PayloadAuditConfig
+	// authentication
+	Auth AuthConfig
+	// cookie session
+	Session SessionConfig
+	// role-based authorization
+	Permission PermissionConfig
+	// cross-origin resource sharing
+	CORS CORSConfig
+	// liveness and readiness probes
+	Health health.Config
+	// replaying responses for retries carrying Idempotency-Key
+	Idempotency IdempotencyConfig
+	// server-sent events of Postgres notifications
+	SSE SSEConfig
+	// WebSocket rooms fanned out across instances by Redis
+	WebSocket WebSocketConfig
+	// timeouts, TLS and listener of HTTP server
+	Server ServerConfig
+	// request body size by route
+	BodyLimit BodyLimitConfig
+	// file uploading to local disk
+	Upload UploadConfig
+	// request deadlines by route
+	Timeout TimeoutConfig
+	// rejecting requests when too many are in flight
+	LoadShedding LoadSheddingConfig
 }
@@ -9,8 +9,13 @@ import (
 	"os"
 	"path"
 	"strconv"
+	"sync"
+	"telescope/audit"
 	"telescope/cache"
 	"telescope/database"
+	"telescope/health"
+	"telescope/metric"
+	"telescope/storage"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
@@ -20,14 +25,52 @@ const (
 	ctxSkipLoggingKey   = "skipLogging"
 	ctxRequestAuditKey  = "requestAudit"
 	ctxResponseAuditKey = "responseAudit"
+
+	ctxRequestHeadersAuditKey  = "requestHeadersAudit"
+	ctxResponseHeadersAuditKey = "responseHeadersAudit"
 )
 
 // Controller is where http logic lives
 type Controller struct {
-	Logger        *zap.Logger
+	Logger *zap.Logger
+	// LogLevel of Logger, which can be changed at runtime
+	LogLevel      zap.AtomicLevel
 	DB            *database.DB
 	Cache         *cache.Cache
 	AuditResponse bool
+	// AuditSink saves audit records besides log, nil means log only
+	AuditSink audit.Sink
+	// Authenticators are tried in order by AuthMiddleware
+	Authenticators []Authenticator
+	Session        SessionConfig
+	Permissions    *PermissionResolver
+	Metric         *metric.Collector
+	Health         *health.Registry
+	Idempotency    IdempotencyConfig
+	SSE            SSEConfig
+	SSEHub         *SSEHub
+	// WebSocketConfig is named so as WebSocket is the handler
+	WebSocketConfig WebSocketConfig
+	WebSocketHub    *WebSocketHub
+	// Storage keeps uploaded files, nil means uploading is disabled
+	Storage storage.Storage
+
+	// cors decides cross-origin WebSocket as well
+	cors *CORS
+	// payloadAuditor redacts payloads in audit log, default config is used if nil
+	payloadAuditor *payloadAuditor
+	// bodyLimiter caps request bodies by route, default config is used if nil
+	bodyLimiter *bodyLimiter
+	// timeouts are deadlines of routes, default config is used if nil
+	timeouts *routeTimeouts
+	// concurrencyLimiter sheds load, nil means no shedding
+	concurrencyLimiter *concurrencyLimiter
+
+	// routes registered, for API document
+	routes     func() gin.RoutesInfo
+	apiDocOnce sync.Once
+	apiDoc     []byte
+	apiDocErr  error
 }
 
 // skipLogging marks when we don't want logging
@@ -35,8 +78,9 @@ func skipLogging(c *gin.Context) {
 	c.Set(ctxSkipLoggingKey, true)
 }
 
-// Hello says hello world,
-// also stands for health check.
+// Hello says hello world.
+//
+// Use /healthz and /readyz for health check.
 func (con *Controller) Hello(c *gin.Context) {
 	skipLogging(c)
 	if c.Request.Method == http.MethodHead {
@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultCORSMaxAge = 43200
+
+// defaultCORSAllowHeaders is used when CORSPolicy.AllowHeaders is empty
+var defaultCORSAllowHeaders = []string{"Content-Type", "Authorization", tokenHeader, csrfTokenHeader, requestIDHeader}
+
+// CORSConfig config on CORS
+type CORSConfig struct {
+	// Default policy applies to all routes, CORS is disabled when it allows no origin
+	Default CORSPolicy
+	// Overrides replace Default for routes under PathPrefix,
+	// the longest matching PathPrefix wins.
+	Overrides []CORSOverride
+}
+
+// CORSOverride policy for a route group
+type CORSOverride struct {
+	// PathPrefix is usually the path of a route group, e.g. "/api/admin", matching whole segments.
+	// The longest matching prefix wins.
+	PathPrefix string
+	Policy     CORSPolicy
+}
+
+// CORSPolicy decides which cross-origin requests are allowed
+type CORSPolicy struct {
+	// AllowOrigins accepts exact origins like "https://example.com",
+	// wildcard subdomains like "https://*.example.com",
+	// or "*" for any origin.
+	AllowOrigins []string
+	// AllowOriginPatterns are regular expressions matched against the whole origin
+	AllowOriginPatterns []string
+	// AllowHeaders request headers allowed, defaults to Content-Type, Authorization, Token, X-CSRF-Token and X-Request-ID
+	AllowHeaders []string
+	// ExposeHeaders response headers exposed to scripts
+	ExposeHeaders []string
+	// AllowCredentials allows cookies and HTTP authentication
+	AllowCredentials bool
+	// MaxAgeSeconds how long preflight result can be cached, defaults to 43200
+	MaxAgeSeconds int
+}
+
+// corsPolicy is compiled CORSPolicy
+type corsPolicy struct {
+	anyOrigin        bool
+	exactOrigins     map[string]struct{}
+	wildcardOrigins  []wildcardOrigin
+	originPatterns   []*regexp.Regexp
+	allowHeaders     string
+	exposeHeaders    string
+	allowCredentials bool
+	maxAge           string
+}
+
+// wildcardOrigin "https://*.example.com" matches "https://api.example.com"
+type wildcardOrigin struct {
+	prefix string
+	suffix string
+}
+
+func compileCORSPolicy(policy CORSPolicy) (compiled *corsPolicy, err error) {
+	compiled = &corsPolicy{
+		exactOrigins:     make(map[string]struct{}, len(policy.AllowOrigins)),
+		allowCredentials: policy.AllowCredentials,
+		exposeHeaders:    strings.Join(policy.ExposeHeaders, ", "),
+	}
+
+	for _, origin := range policy.AllowOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "*":
+			compiled.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			starAt := strings.Index(origin, "*")
+			if strings.Count(origin, "*") > 1 || !strings.HasPrefix(origin[starAt:], "*.") {
+				err = fmt.Errorf("invalid wildcard origin %q, want something like https://*.example.com", origin)
+				return
+			}
+			compiled.wildcardOrigins = append(compiled.wildcardOrigins, wildcardOrigin{
+				prefix: origin[:starAt],
+				suffix: origin[starAt+1:],
+			})
+		default:
+			compiled.exactOrigins[origin] = struct{}{}
+		}
+	}
+
+	for _, pattern := range policy.AllowOriginPatterns {
+		var re *regexp.Regexp
+		re, err = regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			err = fmt.Errorf("compiling origin pattern %q: %w", pattern, err)
+			return
+		}
+		compiled.originPatterns = append(compiled.originPatterns, re)
+	}
+
+	allowHeaders := policy.AllowHeaders
+	if len(allowHeaders) == 0 {
+		allowHeaders = defaultCORSAllowHeaders
+	}
+	compiled.allowHeaders = strings.Join(allowHeaders, ", ")
+
+	maxAge := policy.MaxAgeSeconds
+	if maxAge <= 0 {
+		maxAge = defaultCORSMaxAge
+	}
+	compiled.maxAge = strconv.Itoa(maxAge)
+
+	return
+}
+
+// enabled policy allowing no origin does nothing
+func (p *corsPolicy) enabled() bool {
+	return p.anyOrigin || len(p.exactOrigins) > 0 || len(p.wildcardOrigins) > 0 || len(p.originPatterns) > 0
+}
+
+func (p *corsPolicy) allows(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if _, ok := p.exactOrigins[origin]; ok {
+		return true
+	}
+	for _, w := range p.wildcardOrigins {
+		// at least one character for the subdomain
+		if len(origin) > len(w.prefix)+len(w.suffix) &&
+			strings.HasPrefix(origin, w.prefix) &&
+			strings.HasSuffix(origin, w.suffix) &&
+			!strings.Contains(origin[len(w.prefix):len(origin)-len(w.suffix)], "/") {
+			return true
+		}
+	}
+	for _, re := range p.originPatterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// allowOriginValue "*" can not be used along with credentials
+func (p *corsPolicy) allowOriginValue(origin string) string {
+	if p.anyOrigin && !p.allowCredentials {
+		return "*"
+	}
+
+	return origin
+}
+
+type corsOverride struct {
+	pathPrefix string
+	policy     *corsPolicy
+}
+
+// CORS applies CORS policies, use NewCORS to create one.
+type CORS struct {
+	defaultPolicy *corsPolicy
+	// sorted by length of pathPrefix, longest first
+	overrides []corsOverride
+
+	routes     func() gin.RoutesInfo
+	routesOnce sync.Once
+	// methods registered by route path template
+	routeMethods map[string][]string
+	// templates is sorted keys of routeMethods
+	templates []string
+}
+
+// NewCORS compiles config into CORS,
+// routes tells registered routes for answering preflight, e.g. (*gin.Engine).Routes.
+func NewCORS(config CORSConfig, routes func() gin.RoutesInfo) (cors *CORS, err error) {
+	cors = &CORS{
+		routes: routes,
+	}
+
+	cors.defaultPolicy, err = compileCORSPolicy(config.Default)
+	if err != nil {
+		err = fmt.Errorf("default policy: %w", err)
+		return
+	}
+
+	for _, override := range config.Overrides {
+		var prefix string
+		prefix, err = normalizeRoutePrefix(override.PathPrefix)
+		if err != nil {
+			err = fmt.Errorf("CORS override: %w", err)
+			return
+		}
+
+		var policy *corsPolicy
+		policy, err = compileCORSPolicy(override.Policy)
+		if err != nil {
+			err = fmt.Errorf("policy for %q: %w", override.PathPrefix, err)
+			return
+		}
+		cors.overrides = append(cors.overrides, corsOverride{
+			pathPrefix: prefix,
+			policy:     policy,
+		})
+	}
+	sort.SliceStable(cors.overrides, func(i, j int) bool {
+		return len(cors.overrides[i].pathPrefix) > len(cors.overrides[j].pathPrefix)
+	})
+
+	return
+}
+
+// Middleware answers preflight requests and decorates cross-origin responses.
+//
+// Use it before any middleware which may abort, so that error responses carry CORS headers too.
+func (cors *CORS) Middleware(c *gin.Context) {
+	policy := cors.policyFor(c.Request.URL.Path)
+	if !policy.enabled() {
+		c.Next()
+		return
+	}
+
+	header := c.Writer.Header()
+	header.Add("Vary", "Origin")
+
+	origin := c.Request.Header.Get("Origin")
+	if origin == "" {
+		c.Next()
+		return
+	}
+
+	preflight := c.Request.Method == http.MethodOptions &&
+		c.Request.Header.Get("Access-Control-Request-Method") != ""
+
+	if !policy.allows(origin) {
+		if preflight {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		// let the browser block it
+		c.Next()
+		return
+	}
+
+	header.Set("Access-Control-Allow-Origin", policy.allowOriginValue(origin))
+	if policy.allowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+
+	if !preflight {
+		if policy.exposeHeaders != "" {
+			header.Set("Access-Control-Expose-Headers", policy.exposeHeaders)
+		}
+		c.Next()
+		return
+	}
+
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+
+	methods := cors.methodsOf(c.Request.URL.Path)
+	if len(methods) == 0 {
+		// no such route, let NoRoute handle it
+		c.Next()
+		return
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+	header.Set("Access-Control-Allow-Headers", policy.allowHeaders)
+	header.Set("Access-Control-Max-Age", policy.maxAge)
+
+	c.AbortWithStatus(http.StatusNoContent)
+}
+
+func (cors *CORS) policyFor(path string) *corsPolicy {
+	for _, override := range cors.overrides {
+		if matchRoutePrefix(path, override.pathPrefix) {
+			return override.policy
+		}
+	}
+
+	return cors.defaultPolicy
+}
+
+// methodsOf lists methods registered on routes matching path
+func (cors *CORS) methodsOf(path string) (methods []string) {
+	cors.routesOnce.Do(cors.loadRoutes)
+
+	seen := make(map[string]struct{})
+	for _, template := range cors.templates {
+		if !routeMatches(template, path) {
+			continue
+		}
+		for _, method := range cors.routeMethods[template] {
+			if _, ok := seen[method]; ok {
+				continue
+			}
+			seen[method] = struct{}{}
+			methods = append(methods, method)
+		}
+	}
+	sort.Strings(methods)
+
+	return
+}
+
+// loadRoutes routes are registered before serving, so loading them once is enough.
+func (cors *CORS) loadRoutes() {
+	cors.routeMethods = make(map[string][]string)
+	if cors.routes == nil {
+		return
+	}
+
+	for _, route := range cors.routes() {
+		cors.routeMethods[route.Path] = append(cors.routeMethods[route.Path], route.Method)
+	}
+	for template := range cors.routeMethods {
+		cors.templates = append(cors.templates, template)
+	}
+	sort.Strings(cors.templates)
+}
+
+// routeMatches matches path against gin route template like "/api/users/:id" or "/static/*filepath"
+func routeMatches(template, path string) bool {
+	for {
+		if template == "" || path == "" {
+			return template == path
+		}
+
+		switch template[0] {
+		case '*':
+			return true
+		case ':':
+			templateEnd := strings.IndexByte(template, '/')
+			pathEnd := strings.IndexByte(path, '/')
+			if pathEnd == 0 {
+				// parameter must not be empty
+				return false
+			}
+			if templateEnd == -1 {
+				return pathEnd == -1
+			}
+			if pathEnd == -1 {
+				return false
+			}
+			template = template[templateEnd:]
+			path = path[pathEnd:]
+		default:
+			if template[0] != path[0] {
+				return false
+			}
+			template = template[1:]
+			path = path[1:]
+		}
+	}
+}
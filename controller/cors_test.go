@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_corsPolicy_allows(t *testing.T) {
+	policy, err := compileCORSPolicy(CORSPolicy{
+		AllowOrigins:        []string{"https://example.com", "https://*.example.org"},
+		AllowOriginPatterns: []string{`http://localhost:\d+`},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "https://example.com", want: true},
+		{origin: "https://EXAMPLE.com", want: true},
+		{origin: "http://example.com", want: false},
+		{origin: "https://api.example.com", want: false},
+		{origin: "https://api.example.org", want: true},
+		{origin: "https://a.b.example.org", want: true},
+		{origin: "https://example.org", want: false},
+		{origin: "https://.example.org", want: false},
+		{origin: "https://evil.com/.example.org", want: false},
+		{origin: "http://localhost:8080", want: true},
+		{origin: "http://localhost:8080.evil.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			if got := policy.allows(tt.origin); got != tt.want {
+				t.Errorf("allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_routeMatches(t *testing.T) {
+	tests := []struct {
+		template string
+		path     string
+		want     bool
+	}{
+		{template: "/", path: "/", want: true},
+		{template: "/api/hello", path: "/api/hello", want: true},
+		{template: "/api/hello", path: "/api/hello/", want: false},
+		{template: "/api/session", path: "/api/session/all", want: false},
+		{template: "/api/users/:id", path: "/api/users/42", want: true},
+		{template: "/api/users/:id", path: "/api/users/", want: false},
+		{template: "/api/users/:id", path: "/api/users/42/posts", want: false},
+		{template: "/api/users/:id/posts", path: "/api/users/42/posts", want: true},
+		{template: "/static/*filepath", path: "/static/js/app.js", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.template+" "+tt.path, func(t *testing.T) {
+			if got := routeMatches(tt.template, tt.path); got != tt.want {
+				t.Errorf("routeMatches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORS_Middleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var g *gin.Engine
+	cors, err := NewCORS(CORSConfig{
+		Default: CORSPolicy{
+			AllowOrigins:  []string{"https://example.com"},
+			ExposeHeaders: []string{"X-Request-ID"},
+		},
+		Overrides: []CORSOverride{
+			{
+				PathPrefix: "/api/admin",
+				Policy: CORSPolicy{
+					AllowOrigins:     []string{"https://admin.example.com"},
+					AllowCredentials: true,
+				},
+			},
+		},
+	}, func() gin.RoutesInfo {
+		return g.Routes()
+	})
+	require.NoError(t, err)
+
+	g = gin.New()
+	g.HandleMethodNotAllowed = true
+	g.Use(cors.Middleware)
+	handler := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	g.GET("/api/users/:id", handler)
+	g.PUT("/api/users/:id", handler)
+	g.DELETE("/api/admin/users/:id", handler)
+
+	serve := func(method, path, origin string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("simple request", func(t *testing.T) {
+		w := serve(http.MethodGet, "/api/users/1", "https://example.com", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "https://example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Request-ID", w.Header().Get("Access-Control-Expose-Headers"))
+		assert.Equal(t, "Origin", w.Header().Get("Vary"))
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+	})
+
+	t.Run("disallowed origin", func(t *testing.T) {
+		w := serve(http.MethodGet, "/api/users/1", "https://evil.com", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		w := serve(http.MethodOptions, "/api/users/1", "https://example.com", map[string]string{
+			"Access-Control-Request-Method": http.MethodPut,
+		})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "GET, PUT", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal(t, "Content-Type, Authorization, Token, X-CSRF-Token, X-Request-ID", w.Header().Get("Access-Control-Allow-Headers"))
+		assert.Equal(t, "43200", w.Header().Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("preflight disallowed origin", func(t *testing.T) {
+		w := serve(http.MethodOptions, "/api/users/1", "https://evil.com", map[string]string{
+			"Access-Control-Request-Method": http.MethodPut,
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("override with credentials", func(t *testing.T) {
+		w := serve(http.MethodOptions, "/api/admin/users/1", "https://admin.example.com", map[string]string{
+			"Access-Control-Request-Method": http.MethodDelete,
+		})
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Equal(t, "https://admin.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+		assert.Equal(t, "DELETE", w.Header().Get("Access-Control-Allow-Methods"))
+
+		w = serve(http.MethodOptions, "/api/admin/users/1", "https://example.com", map[string]string{
+			"Access-Control-Request-Method": http.MethodDelete,
+		})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestCORS_policyFor(t *testing.T) {
+	cors, err := NewCORS(CORSConfig{
+		Overrides: []CORSOverride{
+			{PathPrefix: "/api/admin/", Policy: CORSPolicy{AllowOrigins: []string{"https://admin.example.com"}}},
+			{PathPrefix: "/api/admin/users", Policy: CORSPolicy{AllowOrigins: []string{"https://users.example.com"}}},
+		},
+	}, nil)
+	require.NoError(t, err)
+	admin, users := cors.overrides[1].policy, cors.overrides[0].policy
+
+	tests := []struct {
+		path string
+		want *corsPolicy
+	}{
+		{path: "/api/admin", want: admin},
+		{path: "/api/admin/log-level", want: admin},
+		{path: "/api/admin/users/1", want: users},
+		{path: "/api/administrator", want: cors.defaultPolicy},
+		{path: "/api/admin-users", want: cors.defaultPolicy},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			assert.Same(t, tt.want, cors.policyFor(tt.path))
+		})
+	}
+
+	_, err = NewCORS(CORSConfig{Overrides: []CORSOverride{{PathPrefix: "api"}}}, nil)
+	assert.Error(t, err)
+}
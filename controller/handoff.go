@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"telescope/lifecycle"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// handoffListenerEnv tells child the fd of listener handed off by parent
+	handoffListenerEnv = "TELESCOPE_LISTENER_FD"
+	// handoffReadyEnv tells child the fd to write once it's ready
+	handoffReadyEnv = "TELESCOPE_READY_FD"
+	// systemd socket activation passes fds from 3,
+	// see https://www.freedesktop.org/software/systemd/man/sd_listen_fds.html
+	listenFDsStart = 3
+
+	defaultRestartReadyTimeout = 30
+)
+
+// inheritedListener returns listener handed off by parent or passed by systemd socket activation,
+// listener is nil if there's none.
+//
+// Environment variables are unset once read, so that children don't take them by mistake.
+func inheritedListener() (listener net.Listener, err error) {
+	var fd int
+	if value, ok := os.LookupEnv(handoffListenerEnv); ok {
+		_ = os.Unsetenv(handoffListenerEnv)
+		fd, err = strconv.Atoi(value)
+		if err != nil {
+			err = fmt.Errorf("parsing %s: %w", handoffListenerEnv, err)
+			return
+		}
+	} else if pid, _ := strconv.Atoi(os.Getenv("LISTEN_PID")); pid == os.Getpid() {
+		count, _ := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+		_ = os.Unsetenv("LISTEN_PID")
+		_ = os.Unsetenv("LISTEN_FDS")
+		_ = os.Unsetenv("LISTEN_FDNAMES")
+		if count < 1 {
+			return
+		}
+		// the server listens on one socket
+		fd = listenFDsStart
+	} else {
+		return
+	}
+
+	file := os.NewFile(uintptr(fd), "listener")
+	// FileListener works on a dup of it
+	defer file.Close()
+
+	listener, err = net.FileListener(file)
+	if err != nil {
+		err = fmt.Errorf("net.FileListener of fd %d: %w", fd, err)
+		return
+	}
+
+	return
+}
+
+// notifyParentReady tells parent which is handing off that this process is serving,
+// it does nothing if this process is not started by handoff.
+func notifyParentReady() (err error) {
+	value, ok := os.LookupEnv(handoffReadyEnv)
+	if !ok {
+		return
+	}
+	_ = os.Unsetenv(handoffReadyEnv)
+
+	fd, err := strconv.Atoi(value)
+	if err != nil {
+		err = fmt.Errorf("parsing %s: %w", handoffReadyEnv, err)
+		return
+	}
+
+	file := os.NewFile(uintptr(fd), "ready")
+	defer file.Close()
+
+	_, err = file.Write([]byte{1})
+	if err != nil {
+		err = fmt.Errorf("writing ready fd: %w", err)
+		return
+	}
+
+	return
+}
+
+// watchRestart hands off listener on SIGHUP or SIGUSR2 until server stops,
+// then shuts down for the child to take over.
+//
+// Under systemd, prefer socket activation and restarting by systemd,
+// which takes the exit of main process as the service stopping.
+func (s *GracefulServer) watchRestart(lc *lifecycle.Manager) {
+	restart := make(chan os.Signal, 1)
+	signal.Notify(restart, syscall.SIGHUP, syscall.SIGUSR2)
+	defer signal.Stop(restart)
+
+	for {
+		select {
+		case <-s.stopped:
+			return
+		case received := <-restart:
+			s.logger.Info("received signal, restarting...", zap.String("signal", received.String()))
+
+			pid, err := s.handoff()
+			if err != nil {
+				s.logger.Error("restarting failed, keep serving", zap.Error(err))
+				continue
+			}
+
+			s.logger.Info("child is ready, shutting down", zap.Int("childPID", pid))
+			lc.Shutdown()
+			return
+		}
+	}
+}
+
+// handoff starts a new process of the same executable with listener,
+// and waits for it to be ready.
+func (s *GracefulServer) handoff() (pid int, err error) {
+	filer, ok := s.listener.(interface {
+		File() (*os.File, error)
+	})
+	if !ok {
+		err = fmt.Errorf("listener %T can not be handed off", s.listener)
+		return
+	}
+	listenerFile, err := filer.File()
+	if err != nil {
+		err = fmt.Errorf("getting listener file: %w", err)
+		return
+	}
+	defer listenerFile.Close()
+
+	readyReader, readyWriter, err := os.Pipe()
+	if err != nil {
+		err = fmt.Errorf("os.Pipe: %w", err)
+		return
+	}
+	defer readyReader.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyWriter.Close()
+		err = fmt.Errorf("os.Executable: %w", err)
+		return
+	}
+
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles[i] becomes fd 3+i in child
+	cmd.ExtraFiles = []*os.File{listenerFile, readyWriter}
+	cmd.Env = append(handoffEnviron(os.Environ()),
+		handoffListenerEnv+"="+strconv.Itoa(listenFDsStart),
+		handoffReadyEnv+"="+strconv.Itoa(listenFDsStart+1),
+	)
+	err = cmd.Start()
+	// child holds its own copy, reading gets EOF once the child exits
+	readyWriter.Close()
+	if err != nil {
+		err = fmt.Errorf("starting child: %w", err)
+		return
+	}
+	pid = cmd.Process.Pid
+
+	err = waitReady(readyReader, s.config.restartReadyTimeout())
+	if err != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		err = fmt.Errorf("waiting for child %d to be ready: %w", pid, err)
+		return
+	}
+	_ = cmd.Process.Release()
+
+	// the socket file is served by child now
+	if unixListener, ok := s.listener.(*net.UnixListener); ok {
+		unixListener.SetUnlinkOnClose(false)
+	}
+
+	return
+}
+
+// waitReady waits for a byte from reader
+func waitReady(reader *os.File, timeout time.Duration) (err error) {
+	err = reader.SetReadDeadline(time.Now().Add(timeout))
+	if err != nil {
+		err = fmt.Errorf("SetReadDeadline: %w", err)
+		return
+	}
+
+	_, err = reader.Read(make([]byte, 1))
+	if errors.Is(err, io.EOF) {
+		err = errors.New("child exited before being ready")
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("reading ready fd: %w", err)
+		return
+	}
+
+	return
+}
+
+// handoffEnviron removes listener variables of this process from environ
+func handoffEnviron(environ []string) (filtered []string) {
+	for _, variable := range environ {
+		name := variable
+		if i := strings.IndexByte(variable, '='); i >= 0 {
+			name = variable[:i]
+		}
+		switch name {
+		case handoffListenerEnv, handoffReadyEnv, "LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES":
+			continue
+		}
+
+		filtered = append(filtered, variable)
+	}
+
+	return
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_inheritedListener(t *testing.T) {
+	t.Run("none", func(t *testing.T) {
+		t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()+1))
+		t.Setenv("LISTEN_FDS", "1")
+
+		listener, err := inheritedListener()
+		require.NoError(t, err)
+		assert.Nil(t, listener)
+	})
+
+	t.Run("handed off", func(t *testing.T) {
+		parent, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer parent.Close()
+		file, err := parent.(*net.TCPListener).File()
+		require.NoError(t, err)
+		defer file.Close()
+		// inheritedListener owns the fd, like the one passed to child
+		fd, err := syscall.Dup(int(file.Fd()))
+		require.NoError(t, err)
+		t.Setenv(handoffListenerEnv, strconv.Itoa(fd))
+
+		listener, err := inheritedListener()
+		require.NoError(t, err)
+		require.NotNil(t, listener)
+		defer listener.Close()
+		_, found := os.LookupEnv(handoffListenerEnv)
+		assert.False(t, found)
+
+		// parent stops accepting while the inherited one keeps going
+		require.NoError(t, parent.Close())
+		go func() {
+			conn, err := listener.Accept()
+			if err == nil {
+				_ = conn.Close()
+			}
+		}()
+		conn, err := net.DialTimeout("tcp", parent.Addr().String(), time.Second)
+		require.NoError(t, err)
+		_ = conn.Close()
+	})
+}
+
+func Test_waitReady(t *testing.T) {
+	tests := []struct {
+		testName string
+		child    func(w *os.File)
+		wantErr  bool
+	}{
+		{
+			testName: "ready",
+			child: func(w *os.File) {
+				_, _ = w.Write([]byte{1})
+			},
+		},
+		{
+			testName: "exited",
+			child: func(w *os.File) {
+				_ = w.Close()
+			},
+			wantErr: true,
+		},
+		{
+			testName: "timeout",
+			child:    func(w *os.File) {},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			r, w, err := os.Pipe()
+			require.NoError(t, err)
+			defer r.Close()
+			defer w.Close()
+
+			tt.child(w)
+			err = waitReady(r, 100*time.Millisecond)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func Test_handoffEnviron(t *testing.T) {
+	got := handoffEnviron([]string{
+		"PATH=/usr/bin",
+		handoffListenerEnv + "=3",
+		handoffReadyEnv + "=4",
+		"LISTEN_PID=42",
+		"LISTEN_FDS=1",
+		"LISTEN_FDNAMES=api",
+		"LISTEN_ADDR=:3000",
+	})
+	assert.Equal(t, []string{"PATH=/usr/bin", "LISTEN_ADDR=:3000"}, got)
+}
@@ -0,0 +1,68 @@
+package controller
+
+import (
+	"net/http"
+	"telescope/health"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerHealthChecks registers built-in checks on dependencies
+func (con *Controller) registerHealthChecks() {
+	if con.DB != nil {
+		con.Health.Register(health.Check{
+			Name:    "postgres",
+			Kind:    health.Readiness,
+			Checker: health.CheckerFunc(con.DB.Ping),
+		})
+		con.Health.Register(health.Check{
+			Name:    "postgres-listener",
+			Kind:    health.Readiness,
+			Checker: health.CheckerFunc(con.DB.PingListener),
+		})
+	}
+	if con.Cache != nil {
+		con.Health.Register(health.Check{
+			Name:    "redis",
+			Kind:    health.Readiness,
+			Checker: health.CheckerFunc(con.Cache.Ping),
+		})
+	}
+}
+
+// Healthz is the liveness probe, it fails only when the process itself is broken,
+// restarting does not help when dependencies are down.
+func (con *Controller) Healthz(c *gin.Context) {
+	con.healthReport(c, con.Health.Liveness())
+}
+
+// Readyz is the readiness probe, it fails when dependencies are down
+// or graceful shutdown has started.
+func (con *Controller) Readyz(c *gin.Context) {
+	con.healthReport(c, con.Health.Readiness())
+}
+
+func (con *Controller) healthReport(c *gin.Context, report health.Report) {
+	skipLogging(c)
+
+	status := http.StatusOK
+	if !report.Healthy() {
+		status = http.StatusServiceUnavailable
+	}
+
+	if c.Request.Method == http.MethodHead {
+		c.Status(status)
+		return
+	}
+
+	if status == http.StatusOK {
+		ok(c, report)
+		return
+	}
+
+	c.PureJSON(status, R{
+		Code: status,
+		Msg:  http.StatusText(status),
+		Data: report,
+	})
+}
@@ -0,0 +1,258 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"telescope/cache"
+	"telescope/errorcode"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	maxIdempotentResponseSize = 1 << 20
+	defaultIdempotencyTTL     = 24 * 60 * 60
+	defaultIdempotencyLock    = 60
+	// idempotencyFinishTimeout bounds recording response after the client may have gone
+	idempotencyFinishTimeout = 5 * time.Second
+)
+
+// IdempotencyConfig config on Idempotency-Key support
+type IdempotencyConfig struct {
+	// TTLSeconds responses are replayed for retries within this long, defaults to 24 hours
+	TTLSeconds int
+	// LockTimeoutSeconds duplicates are rejected while the first request is in progress,
+	// the lock expires after this long in case the process dies, defaults to 60 seconds.
+	LockTimeoutSeconds int
+}
+
+func (i IdempotencyConfig) withDefaults() IdempotencyConfig {
+	if i.TTLSeconds <= 0 {
+		i.TTLSeconds = defaultIdempotencyTTL
+	}
+	if i.LockTimeoutSeconds <= 0 {
+		i.LockTimeoutSeconds = defaultIdempotencyLock
+	}
+
+	return i
+}
+
+func (i IdempotencyConfig) ttl() time.Duration {
+	return time.Duration(i.TTLSeconds) * time.Second
+}
+
+func (i IdempotencyConfig) lockTimeout() time.Duration {
+	return time.Duration(i.LockTimeoutSeconds) * time.Second
+}
+
+// IdempotencyMiddleware makes unsafe requests carrying Idempotency-Key header safe to retry:
+// the response of the first request is recorded and replayed for retries with the same key,
+// while reusing the key with another request or sending duplicates concurrently is rejected.
+//
+// Keys are scoped by principal, so use it after RequireAuth.
+// Responses with status 500 and above are not recorded,
+// nor are failures reported through c.Error, so that retries process them again.
+func (con *Controller) IdempotencyMiddleware(c *gin.Context) {
+	key := c.GetHeader(idempotencyKeyHeader)
+	if key == "" || isSafeMethod(c.Request.Method) || con.Cache == nil {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		_ = c.Error(errorcode.ErrInvalidIdempotencyKey)
+		c.Abort()
+		return
+	}
+
+	principal, authenticated := principalOf(c)
+	if !authenticated {
+		// anonymous callers can not be told apart, their keys may collide
+		c.Next()
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("reading request body: %w", err))
+		c.Abort()
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var (
+		scopedKey   = principal.Kind + ":" + principal.ID + ":" + key
+		fingerprint = requestFingerprint(c.Request.Method, c.Request.URL.RequestURI(), body)
+		config      = con.Idempotency
+	)
+
+	recorded, lock, err := con.Cache.BeginIdempotentRequest(c.Request.Context(), scopedKey, fingerprint, config.lockTimeout())
+	switch {
+	case errors.Is(err, cache.ErrIdempotencyKeyReused):
+		_ = c.Error(errorcode.ErrIdempotencyKeyReused)
+		c.Abort()
+		return
+	case errors.Is(err, cache.ErrIdempotencyKeyInFlight):
+		c.Header("Retry-After", "1")
+		_ = c.Error(errorcode.ErrIdempotencyKeyInFlight)
+		c.Abort()
+		return
+	case err != nil:
+		_ = c.Error(fmt.Errorf("BeginIdempotentRequest: %w", err))
+		c.Abort()
+		return
+	case recorded != nil:
+		replayResponse(c, recorded)
+		c.Abort()
+		return
+	}
+
+	writer := newRecordingWriter(c.Writer)
+	c.Writer = writer
+
+	var completed bool
+	defer func() {
+		var response *cache.IdempotentResponse
+		// nothing is recorded on panic,
+		// nor if handler reports failure without responding.
+		if completed && (writer.Written() || len(c.Errors) == 0) {
+			response = writer.response(fingerprint)
+		}
+
+		// the client may be gone, which is exactly when it's going to retry
+		ctx, cancel := context.WithTimeout(context.Background(), idempotencyFinishTimeout)
+		defer cancel()
+
+		finishErr := con.Cache.FinishIdempotentRequest(ctx, lock, response, config.ttl())
+		if finishErr != nil {
+			con.loggerOf(c).Error("finishing idempotent request failed",
+				zap.Error(finishErr),
+				zap.String("idempotencyKey", key),
+			)
+		}
+	}()
+
+	c.Next()
+	completed = true
+}
+
+// requestFingerprint tells whether a retry is the same request
+func requestFingerprint(method, uri string, body []byte) string {
+	h := sha256.New()
+	_, _ = io.WriteString(h, method)
+	_, _ = h.Write([]byte{0})
+	_, _ = io.WriteString(h, uri)
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(body)
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replayResponse writes recorded response,
+// headers set by middlewares for this request are kept unless the handler set them then.
+func replayResponse(c *gin.Context, recorded *cache.IdempotentResponse) {
+	header := c.Writer.Header()
+	for name, values := range recorded.Header {
+		header[name] = values
+	}
+	header.Set(idempotentReplayedHeader, "true")
+
+	c.Writer.WriteHeader(recorded.StatusCode)
+	_, _ = c.Writer.Write(recorded.Body)
+}
+
+// unrecordedHeaders are never replayed.
+// Encoding headers are set by gzip middleware outside for the body before compressing,
+// which is what gets recorded, so they are decided again for each replay.
+var unrecordedHeaders = map[string]bool{
+	"Set-Cookie":                    true,
+	"Content-Encoding":              true,
+	"Content-Length":                true,
+	"Vary":                          true,
+	http.CanonicalHeaderKey("ETag"): true,
+}
+
+// recordingWriter keeps what the handler writes
+type recordingWriter struct {
+	gin.ResponseWriter
+	// headerBefore handler runs, so that we know what the handler sets
+	headerBefore http.Header
+	body         bytes.Buffer
+	oversized    bool
+}
+
+func newRecordingWriter(w gin.ResponseWriter) *recordingWriter {
+	return &recordingWriter{
+		ResponseWriter: w,
+		headerBefore:   w.Header().Clone(),
+	}
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.record(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.record([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *recordingWriter) record(b []byte) {
+	if w.oversized {
+		return
+	}
+	if w.body.Len()+len(b) > maxIdempotentResponseSize {
+		w.oversized = true
+		w.body.Reset()
+		return
+	}
+
+	w.body.Write(b)
+}
+
+// response to be recorded, nil means it's not worth recording.
+func (w *recordingWriter) response(fingerprint string) *cache.IdempotentResponse {
+	if w.oversized || w.Status() >= http.StatusInternalServerError {
+		return nil
+	}
+
+	header := make(map[string][]string)
+	for name, values := range w.Header() {
+		if unrecordedHeaders[name] || equalValues(w.headerBefore[name], values) {
+			continue
+		}
+		header[name] = values
+	}
+
+	return &cache.IdempotentResponse{
+		Fingerprint: fingerprint,
+		StatusCode:  w.Status(),
+		Header:      header,
+		Body:        w.body.Bytes(),
+		CreatedAt:   time.Now(),
+	}
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"bytes"
+	stdgzip "compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telescope/cache"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nanmu42/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_requestFingerprint(t *testing.T) {
+	base := requestFingerprint(http.MethodPost, "/api/orders", []byte(`{"amount":1}`))
+	assert.Len(t, base, 64)
+	assert.Equal(t, base, requestFingerprint(http.MethodPost, "/api/orders", []byte(`{"amount":1}`)))
+
+	assert.NotEqual(t, base, requestFingerprint(http.MethodPut, "/api/orders", []byte(`{"amount":1}`)))
+	assert.NotEqual(t, base, requestFingerprint(http.MethodPost, "/api/orders?dry=1", []byte(`{"amount":1}`)))
+	assert.NotEqual(t, base, requestFingerprint(http.MethodPost, "/api/orders", []byte(`{"amount":2}`)))
+	// fields are delimited
+	assert.NotEqual(t,
+		requestFingerprint(http.MethodPost, "/a", []byte("b")),
+		requestFingerprint(http.MethodPost, "/ab", nil))
+}
+
+func Test_recordingWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		testName   string
+		handler    gin.HandlerFunc
+		wantNil    bool
+		wantStatus int
+		wantHeader map[string][]string
+		wantBody   string
+	}{
+		{
+			testName: "created",
+			handler: func(c *gin.Context) {
+				c.Header("Location", "/api/orders/1")
+				c.SetCookie("flavor", "gin", 0, "/", "", false, true)
+				c.String(http.StatusCreated, "created")
+			},
+			wantStatus: http.StatusCreated,
+			wantHeader: map[string][]string{
+				"Location":     {"/api/orders/1"},
+				"Content-Type": {"text/plain; charset=utf-8"},
+			},
+			wantBody: "created",
+		},
+		{
+			testName: "no content",
+			handler: func(c *gin.Context) {
+				c.Status(http.StatusNoContent)
+			},
+			wantStatus: http.StatusNoContent,
+			wantHeader: map[string][]string{},
+		},
+		{
+			testName: "server error is not recorded",
+			handler: func(c *gin.Context) {
+				c.String(http.StatusInternalServerError, "oops")
+			},
+			wantNil: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			// set by outer middleware, not part of the recorded response
+			c.Header("X-Request-ID", "abc")
+
+			writer := newRecordingWriter(c.Writer)
+			c.Writer = writer
+			tt.handler(c)
+
+			got := writer.response("fingerprint")
+			if tt.wantNil {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, "fingerprint", got.Fingerprint)
+			assert.Equal(t, tt.wantStatus, got.StatusCode)
+			assert.Equal(t, tt.wantHeader, got.Header)
+			assert.Equal(t, tt.wantBody, string(got.Body))
+		})
+	}
+}
+
+func Test_replayResponse_gzip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	body := strings.Repeat("a", 4<<10)
+	var recorded *cache.IdempotentResponse
+
+	g := gin.New()
+	g.Use(gzip.DefaultHandler().Gin)
+	g.POST("/record", func(c *gin.Context) {
+		writer := newRecordingWriter(c.Writer)
+		c.Writer = writer
+		c.String(http.StatusOK, body)
+		recorded = writer.response("fingerprint")
+	})
+	g.POST("/replay", func(c *gin.Context) {
+		replayResponse(c, recorded)
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/record", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	require.NotNil(t, recorded)
+	assert.NotContains(t, recorded.Header, "Content-Encoding")
+	assert.NotContains(t, recorded.Header, "Vary")
+	assert.Equal(t, body, string(recorded.Body))
+
+	tests := []struct {
+		testName       string
+		acceptEncoding string
+		wantEncoding   string
+	}{
+		{testName: "retry without gzip", acceptEncoding: "", wantEncoding: ""},
+		{testName: "retry with gzip", acceptEncoding: "gzip", wantEncoding: "gzip"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/replay", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantEncoding, w.Header().Get("Content-Encoding"))
+			got := w.Body.Bytes()
+			if tt.wantEncoding == "gzip" {
+				reader, err := stdgzip.NewReader(bytes.NewReader(got))
+				require.NoError(t, err)
+				got, err = io.ReadAll(reader)
+				require.NoError(t, err)
+			}
+			assert.Equal(t, body, string(got))
+			assert.Equal(t, "true", w.Header().Get(idempotentReplayedHeader))
+		})
+	}
+}
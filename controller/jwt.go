@@ -0,0 +1,270 @@
+package controller
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// defaultJWTKeyReloadSeconds how often key files are reloaded
+	defaultJWTKeyReloadSeconds = 60
+	// jwtKeyReloadMinInterval limits reloading triggered by unknown key id
+	jwtKeyReloadMinInterval = 5 * time.Second
+)
+
+// JWTConfig config on JWT verification
+type JWTConfig struct {
+	// KeyDir is where verification keys live, one key per file,
+	// file name without extension is the key id("kid").
+	//
+	// *.pem files are RSA public keys for RS256,
+	// other files are shared secrets for HS256.
+	//
+	// Keys are rotated by adding or removing files,
+	// which is picked up on reload.
+	KeyDir string
+	// Issuer, if not empty, must match "iss" claim
+	Issuer string
+	// Audience, if not empty, must be in "aud" claim
+	Audience string
+	// ReloadSeconds is how often KeyDir is reloaded, defaults to 60
+	ReloadSeconds int
+}
+
+// jwtClaims claims we care about
+type jwtClaims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles,omitempty"`
+}
+
+// jwtKey verification key
+type jwtKey struct {
+	id     string
+	method jwt.SigningMethod
+	// []byte for HS256, *rsa.PublicKey for RS256
+	key interface{}
+}
+
+// JWTAuthenticator verifies HS256/RS256 JWT with keys loaded from local files
+type JWTAuthenticator struct {
+	config         JWTConfig
+	reloadInterval time.Duration
+	parser         *jwt.Parser
+
+	mu       sync.RWMutex
+	keys     map[string]jwtKey
+	loadedAt time.Time
+}
+
+// NewJWTAuthenticator loads keys and creates a JWTAuthenticator
+func NewJWTAuthenticator(config JWTConfig) (a *JWTAuthenticator, err error) {
+	if config.ReloadSeconds <= 0 {
+		config.ReloadSeconds = defaultJWTKeyReloadSeconds
+	}
+
+	a = &JWTAuthenticator{
+		config:         config,
+		reloadInterval: time.Duration(config.ReloadSeconds) * time.Second,
+		parser: jwt.NewParser(jwt.WithValidMethods([]string{
+			jwt.SigningMethodHS256.Alg(),
+			jwt.SigningMethodRS256.Alg(),
+		})),
+	}
+
+	err = a.reload()
+	if err != nil {
+		err = fmt.Errorf("loading JWT keys: %w", err)
+		return
+	}
+
+	return
+}
+
+// Authenticate implements Authenticator
+func (a *JWTAuthenticator) Authenticate(_ context.Context, credential string) (principal *Principal, err error) {
+	if strings.Count(credential, ".") != 2 {
+		err = errCredentialNotSupported
+		return
+	}
+
+	a.reloadIfStale()
+
+	var claims jwtClaims
+	_, err = a.parser.ParseWithClaims(credential, &claims, a.keyFunc)
+	if err != nil {
+		err = fmt.Errorf("parsing JWT: %w", err)
+		return
+	}
+
+	if a.config.Issuer != "" && !claims.VerifyIssuer(a.config.Issuer, true) {
+		err = fmt.Errorf("unexpected JWT issuer %q", claims.Issuer)
+		return
+	}
+	if a.config.Audience != "" && !claims.VerifyAudience(a.config.Audience, true) {
+		err = fmt.Errorf("unexpected JWT audience %v", claims.Audience)
+		return
+	}
+	if claims.Subject == "" {
+		err = errors.New("JWT has no subject")
+		return
+	}
+
+	principal = &Principal{
+		ID:    claims.Subject,
+		Kind:  PrincipalKindJWT,
+		Roles: claims.Roles,
+	}
+	return
+}
+
+// keyFunc finds verification key by "kid" header.
+//
+// Token without "kid" is accepted only when there's exactly one key for its algorithm.
+func (a *JWTAuthenticator) keyFunc(token *jwt.Token) (key interface{}, err error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid != "" {
+		k, ok := a.key(kid)
+		if !ok {
+			// the key may be just rotated in
+			a.reloadForUnknownKey()
+			k, ok = a.key(kid)
+		}
+		if !ok {
+			err = fmt.Errorf("unknown JWT key id %q", kid)
+			return
+		}
+		if k.method.Alg() != token.Method.Alg() {
+			err = fmt.Errorf("JWT key %q is for %s, got %s", kid, k.method.Alg(), token.Method.Alg())
+			return
+		}
+
+		key = k.key
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var found int
+	for _, k := range a.keys {
+		if k.method.Alg() == token.Method.Alg() {
+			key = k.key
+			found++
+		}
+	}
+	if found != 1 {
+		key = nil
+		err = fmt.Errorf("JWT without key id, %d candidate keys for %s", found, token.Method.Alg())
+		return
+	}
+
+	return
+}
+
+func (a *JWTAuthenticator) key(kid string) (k jwtKey, ok bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	k, ok = a.keys[kid]
+	return
+}
+
+func (a *JWTAuthenticator) reloadIfStale() {
+	a.mu.RLock()
+	stale := time.Since(a.loadedAt) > a.reloadInterval
+	a.mu.RUnlock()
+
+	if stale {
+		// keep the old keys on error, reload happens again on next interval
+		_ = a.reload()
+	}
+}
+
+func (a *JWTAuthenticator) reloadForUnknownKey() {
+	a.mu.RLock()
+	recent := time.Since(a.loadedAt) < jwtKeyReloadMinInterval
+	a.mu.RUnlock()
+
+	if !recent {
+		_ = a.reload()
+	}
+}
+
+// reload loads all keys in KeyDir
+func (a *JWTAuthenticator) reload() (err error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	// bump loadedAt even if failing, so that we don't retry on every request
+	a.loadedAt = time.Now()
+
+	entries, err := os.ReadDir(a.config.KeyDir)
+	if err != nil {
+		err = fmt.Errorf("os.ReadDir: %w", err)
+		return
+	}
+
+	keys := make(map[string]jwtKey, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		var k jwtKey
+		k, err = loadJWTKey(filepath.Join(a.config.KeyDir, entry.Name()))
+		if err != nil {
+			err = fmt.Errorf("loading JWT key %q: %w", entry.Name(), err)
+			return
+		}
+		keys[k.id] = k
+	}
+	if len(keys) == 0 {
+		err = fmt.Errorf("no JWT key found in %q", a.config.KeyDir)
+		return
+	}
+
+	a.keys = keys
+	return
+}
+
+// loadJWTKey loads key from file, key id is the file name without extension.
+func loadJWTKey(filePath string) (k jwtKey, err error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		err = fmt.Errorf("os.ReadFile: %w", err)
+		return
+	}
+
+	ext := filepath.Ext(filePath)
+	k.id = strings.TrimSuffix(filepath.Base(filePath), ext)
+
+	if ext == ".pem" {
+		var publicKey *rsa.PublicKey
+		publicKey, err = jwt.ParseRSAPublicKeyFromPEM(content)
+		if err != nil {
+			err = fmt.Errorf("jwt.ParseRSAPublicKeyFromPEM: %w", err)
+			return
+		}
+		k.method = jwt.SigningMethodRS256
+		k.key = publicKey
+		return
+	}
+
+	secret := []byte(strings.TrimSpace(string(content)))
+	if len(secret) < 32 {
+		err = fmt.Errorf("HS256 secret should be at least 32 bytes, got %d", len(secret))
+		return
+	}
+	k.method = jwt.SigningMethodHS256
+	k.key = secret
+	return
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTAuthenticator(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		secret   = strings.Repeat("s3cr3t", 8)
+		issuer   = "telescope-test"
+		audience = "telescope"
+	)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicKey, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hs-1"), []byte(secret+"\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "rs-1.pem"), pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKey,
+	}), 0600))
+
+	a, err := NewJWTAuthenticator(JWTConfig{
+		KeyDir:   dir,
+		Issuer:   issuer,
+		Audience: audience,
+	})
+	require.NoError(t, err)
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwtClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		require.NoError(t, err)
+		return signed
+	}
+
+	validClaims := func(subject string) jwtClaims {
+		return jwtClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				Subject:   subject,
+				Audience:  jwt.ClaimStrings{audience},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+			},
+			Roles: []string{"admin"},
+		}
+	}
+
+	expired := validClaims("user-3")
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+	wrongAudience := validClaims("user-4")
+	wrongAudience.Audience = jwt.ClaimStrings{"someone-else"}
+
+	tests := []struct {
+		testName    string
+		credential  string
+		wantSubject string
+		wantErr     bool
+	}{
+		{
+			testName:    "HS256",
+			credential:  sign(jwt.SigningMethodHS256, "hs-1", []byte(secret), validClaims("user-1")),
+			wantSubject: "user-1",
+		},
+		{
+			testName:    "HS256 without kid",
+			credential:  sign(jwt.SigningMethodHS256, "", []byte(secret), validClaims("user-1")),
+			wantSubject: "user-1",
+		},
+		{
+			testName:    "RS256",
+			credential:  sign(jwt.SigningMethodRS256, "rs-1", rsaKey, validClaims("user-2")),
+			wantSubject: "user-2",
+		},
+		{
+			testName:   "RS256 token with HS256 key",
+			credential: sign(jwt.SigningMethodRS256, "hs-1", rsaKey, validClaims("user-2")),
+			wantErr:    true,
+		},
+		{
+			testName:   "wrong secret",
+			credential: sign(jwt.SigningMethodHS256, "hs-1", []byte(strings.Repeat("x", 32)), validClaims("user-1")),
+			wantErr:    true,
+		},
+		{
+			testName:   "unknown kid",
+			credential: sign(jwt.SigningMethodHS256, "hs-2", []byte(secret), validClaims("user-1")),
+			wantErr:    true,
+		},
+		{
+			testName:   "expired",
+			credential: sign(jwt.SigningMethodHS256, "hs-1", []byte(secret), expired),
+			wantErr:    true,
+		},
+		{
+			testName:   "wrong audience",
+			credential: sign(jwt.SigningMethodHS256, "hs-1", []byte(secret), wrongAudience),
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			principal, err := a.Authenticate(context.Background(), tt.credential)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantSubject, principal.ID)
+			require.Equal(t, PrincipalKindJWT, principal.Kind)
+			require.Equal(t, []string{"admin"}, principal.Roles)
+		})
+	}
+
+	t.Run("not a JWT", func(t *testing.T) {
+		_, err := a.Authenticate(context.Background(), "some-api-key")
+		require.ErrorIs(t, err, errCredentialNotSupported)
+	})
+
+	t.Run("key rotated in", func(t *testing.T) {
+		newSecret := strings.Repeat("n3w", 12)
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "hs-2"), []byte(newSecret), 0600))
+		// pretend keys were loaded long ago
+		a.mu.Lock()
+		a.loadedAt = time.Now().Add(-time.Minute)
+		a.mu.Unlock()
+
+		principal, err := a.Authenticate(context.Background(), sign(jwt.SigningMethodHS256, "hs-2", []byte(newSecret), validClaims("user-5")))
+		require.NoError(t, err)
+		require.Equal(t, "user-5", principal.ID)
+	})
+}
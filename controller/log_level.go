@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// permissionLogLevel is required to change log level
+const permissionLogLevel = "admin:log-level"
+
+type logLevelRequest struct {
+	Level string `json:"level" binding:"required,oneof=debug info warn error" description:"one of debug, info, warn, error"`
+}
+
+type logLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// GetLogLevel tells current log level
+func (con *Controller) GetLogLevel(c *gin.Context) {
+	ok(c, logLevelResponse{Level: con.LogLevel.Level().String()})
+}
+
+// SetLogLevel changes log level at runtime, which lasts until restarting.
+func (con *Controller) SetLogLevel(c *gin.Context) {
+	var req logLevelRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	var level zapcore.Level
+	err = level.UnmarshalText([]byte(req.Level))
+	if err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	previous := con.LogLevel.Level()
+	con.LogLevel.SetLevel(level)
+	// logged even if the new level is above info
+	con.loggerOf(c).Warn("log level changed",
+		zap.Stringer("from", previous),
+		zap.Stringer("to", level),
+	)
+
+	ok(c, logLevelResponse{Level: level.String()})
+}
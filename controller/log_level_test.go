@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestController_SetLogLevel(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		testName    string
+		permissions PermissionSet
+		body        string
+		wantStatus  int
+		wantLevel   zapcore.Level
+	}{
+		{
+			testName:    "changed",
+			permissions: PermissionSet{"admin:*": {}},
+			body:        `{"level": "debug"}`,
+			wantStatus:  http.StatusOK,
+			wantLevel:   zapcore.DebugLevel,
+		},
+		{
+			testName:    "unknown level",
+			permissions: PermissionSet{permissionLogLevel: {}},
+			body:        `{"level": "verbose"}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantLevel:   zapcore.InfoLevel,
+		},
+		{
+			testName:    "forbidden",
+			permissions: PermissionSet{},
+			body:        `{"level": "debug"}`,
+			wantStatus:  http.StatusForbidden,
+			wantLevel:   zapcore.InfoLevel,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			con := &Controller{
+				Logger:   zap.NewNop(),
+				LogLevel: zap.NewAtomicLevelAt(zapcore.InfoLevel),
+			}
+			g := gin.New()
+			g.Use(con.ErrorMiddleware, func(c *gin.Context) {
+				c.Set(ctxPrincipalKey, &Principal{ID: "alice"})
+				c.Set(ctxPermissionsKey, tt.permissions)
+			})
+			g.PUT("/log-level", con.RequirePermission(permissionLogLevel), con.SetLogLevel)
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPut, "/log-level", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			g.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantLevel, con.LogLevel.Level())
+		})
+	}
+}
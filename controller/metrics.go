@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"telescope/metric"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/stats/v4"
+	"go.uber.org/atomic"
+)
+
+// unmatchedRoute tags requests matching no route,
+// raw paths are never used as tag to keep cardinality low.
+const unmatchedRoute = "unmatched"
+
+// statusClasses status code / 100 to its class
+var statusClasses = [...]string{"0xx", "1xx", "2xx", "3xx", "4xx", "5xx"}
+
+func statusClass(status int) string {
+	class := status / 100
+	if class < 0 || class >= len(statusClasses) {
+		return statusClasses[0]
+	}
+
+	return statusClasses[class]
+}
+
+// MetricMiddleware records requests count, duration, sizes and requests in flight,
+// tagged by method, route template and status class.
+//
+// Use it as the outermost middleware so that it sees the final status and response size.
+func (con *Controller) MetricMiddleware() func(c *gin.Context) {
+	var inFlight atomic.Int64
+
+	return func(c *gin.Context) {
+		startedAt := time.Now()
+		con.Metric.Set(metric.RequestsInFlight, inFlight.Inc())
+
+		defer func() {
+			con.Metric.Set(metric.RequestsInFlight, inFlight.Dec())
+		}()
+
+		c.Next()
+
+		tags := []stats.Tag{
+			stats.T("method", c.Request.Method),
+			stats.T("route", routeOf(c)),
+			stats.T("status", statusClass(c.Writer.Status())),
+		}
+
+		con.Metric.Incr(metric.RequestsTotal, tags...)
+		con.Metric.Observe(metric.RequestDuration, time.Since(startedAt).Seconds(), tags...)
+		if c.Request.ContentLength >= 0 {
+			con.Metric.Observe(metric.RequestSizeBytes, c.Request.ContentLength, tags...)
+		}
+		if size := c.Writer.Size(); size >= 0 {
+			con.Metric.Observe(metric.ResponseSizeBytes, size, tags...)
+		}
+	}
+}
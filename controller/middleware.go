@@ -1,11 +1,12 @@
 package controller
 
 import (
-	"fmt"
 	"io"
 	"net/http"
 	"runtime/debug"
+	"telescope/database"
 	"telescope/errorcode"
+	"telescope/logging"
 	"time"
 
 	"github.com/valyala/bytebufferpool"
@@ -20,17 +21,13 @@ import (
 	"go.uber.org/zap"
 )
 
-const (
-	maxRequestBodySize = 256 << 10
-)
-
 // RecoveryMiddleware recover from panic and log
 func (con *Controller) RecoveryMiddleware(c *gin.Context) {
 	defer func() {
 		if err := recover(); err != nil {
 			stack := string(debug.Stack())
 
-			con.Logger.Error("panic recovered!",
+			con.loggerOf(c).Error("panic recovered!",
 				zap.Any("panic", err),
 				zap.String("stack", stack),
 				zap.String("method", c.Request.Method),
@@ -62,6 +59,10 @@ func (con *Controller) ErrorMiddleware(c *gin.Context) {
 	if err == nil {
 		return
 	}
+	// body cut by LimitReaderMiddleware fails whoever reads it
+	if errors.Is(err.Err, errBodyTooLarge) {
+		err = &gin.Error{Err: errPayloadTooLarge(c.GetInt(ctxBodyLimitKey)), Type: gin.ErrorTypePrivate}
+	}
 	// abort if there's already a response body
 	if c.Writer.Written() {
 		return
@@ -73,19 +74,42 @@ func (con *Controller) ErrorMiddleware(c *gin.Context) {
 		apiErr     *errorcode.Error
 	)
 
+	tag := errorcode.DefaultCatalog.Negotiate(c.GetHeader("Accept-Language"))
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	c.Writer.Header().Set("Content-Language", tag.String())
+
 	switch true {
 	case err.IsType(gin.ErrorTypeBind):
-		resp.Code = errorcode.CodeBadBinding
-		statusCode = http.StatusNotAcceptable
+		statusCode, resp = bindingErrorResponse(tag, err.Err)
 	case errors.As(err.Err, &apiErr):
 		resp.Code = apiErr.Code()
+		resp.Msg = errorcode.DefaultCatalog.Localize(tag, apiErr)
+		if details := apiErr.Details(); len(details) > 0 {
+			resp.Details = details
+		}
 		statusCode = apiErr.StatusCode()
+
+		// cause is kept from API users, but not from us
+		if cause := apiErr.Unwrap(); cause != nil {
+			con.loggerOf(c).Warn("API error caused by",
+				zap.Int("code", apiErr.Code()),
+				zap.String("method", c.Request.Method),
+				zap.String("path", c.Request.URL.Path),
+				zap.Error(cause),
+			)
+		}
 	default:
 		resp.Code = errorcode.CodeGeneralError
+		resp.Msg = err.Error()
 		statusCode = http.StatusOK
+
+		con.loggerOf(c).Error("unclassified API error",
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Error(err.Err),
+		)
 	}
 
-	resp.Msg = err.Error()
 	c.PureJSON(statusCode, resp)
 }
 
@@ -101,16 +125,28 @@ func (con *Controller) LogMiddleware(c *gin.Context) {
 	}
 
 	latency := time.Since(startedAt)
+	if con.AuditSink != nil {
+		con.AuditSink.Write(con.auditRecordOf(c, startedAt, latency))
+	}
 
-	logger := con.Logger
+	logger := con.loggerOf(c)
 	if reqBody, ok := c.Get(ctxRequestAuditKey); ok {
 		logger = logger.With(zap.Stringp("requestBody", reqBody.(*string)))
 	}
 	if respBody, ok := c.Get(ctxResponseAuditKey); ok {
 		logger = logger.With(zap.Stringp("responseBody", respBody.(*string)))
 	}
+	if reqHeaders, ok := c.Get(ctxRequestHeadersAuditKey); ok {
+		logger = logger.With(zap.Any("requestHeaders", reqHeaders))
+	}
+	if respHeaders, ok := c.Get(ctxResponseHeadersAuditKey); ok {
+		logger = logger.With(zap.Any("responseHeaders", respHeaders))
+	}
+	if principal, ok := principalOf(c); ok {
+		logger = logger.With(zap.String("principal", principal.ID))
+	}
 
-	logger.Info("APIAuditLog",
+	logger.Info(logging.AuditMessage,
 		zap.String("method", c.Request.Method),
 		zap.String("host", c.Request.Host),
 		zap.String("origin", c.Request.Header.Get("Origin")),
@@ -126,39 +162,33 @@ func (con *Controller) LogMiddleware(c *gin.Context) {
 	)
 }
 
-// CORSMiddleware allows CORS request
-func CORSMiddleware(c *gin.Context) {
-	header := c.Writer.Header()
-	header.Set("Access-Control-Allow-Origin", "*")
-	header.Set("Access-Control-Max-Age", "43200")
-	header.Set("Access-Control-Allow-Methods", "POST")
-	header.Set("Access-Control-Allow-Headers", "Content-Type, Token")
-
-	if c.Request.Method == http.MethodOptions {
-		c.AbortWithStatus(http.StatusNoContent)
-		return
+// auditRecordOf c for AuditSink, bodies are the ones audited by PayloadAuditLogMiddleware.
+func (con *Controller) auditRecordOf(c *gin.Context, startedAt time.Time, latency time.Duration) (record *database.AuditRecord) {
+	record = &database.AuditRecord{
+		RequestID: logging.RequestIDFromContext(c.Request.Context()),
+		Method:    c.Request.Method,
+		Route:     c.FullPath(),
+		Path:      c.Request.URL.Path,
+		Status:    c.Writer.Status(),
+		LatencyMs: float64(latency) / float64(time.Millisecond),
+		ClientIP:  c.ClientIP(),
+		CreatedAt: startedAt,
 	}
-
-	c.Next()
-}
-
-// LimitReaderMiddleware limits the request size
-func (con *Controller) LimitReaderMiddleware(maxRequestBodyBytes int) func(c *gin.Context) {
-	return func(c *gin.Context) {
-		if c.Request.ContentLength > int64(maxRequestBodyBytes) {
-			_ = c.Error(fmt.Errorf("oversized payload by content length, got %d bytes, limit %d bytes", c.Request.ContentLength, maxRequestBodyBytes))
-
-			c.Abort()
-			return
-		}
-
-		c.Request.Body = limitio.NewReadCloser(c.Request.Body, maxRequestBodyBytes, false)
-
-		c.Next()
+	if principal, ok := principalOf(c); ok {
+		record.Principal = principal.ID
 	}
+	if reqBody, ok := c.Get(ctxRequestAuditKey); ok {
+		record.RequestBody = *reqBody.(*string)
+	}
+	if respBody, ok := c.Get(ctxResponseAuditKey); ok {
+		record.ResponseBody = *respBody.(*string)
+	}
+
+	return
 }
 
-// PayloadAuditLogMiddleware audits text request and response then logs them.
+// PayloadAuditLogMiddleware audits text request and response then logs them,
+// secrets in bodies and headers are redacted.
 // This middleware replies on LogMiddleware to output,
 // use it inside LogMiddleware so that LogMiddleware can see this one's product.
 //
@@ -166,11 +196,6 @@ func (con *Controller) LimitReaderMiddleware(maxRequestBodyBytes int) func(c *gi
 //
 // If there's a gzip middleware, use it outside this one so this one can see response before compressing.
 func (con *Controller) PayloadAuditLogMiddleware() func(c *gin.Context) {
-	const (
-		RequestBodyMaxLength  = 512
-		ResponseBodyMaxLength = 512
-	)
-
 	var textPayloadMIME = []string{
 		"application/json", "text/xml", "application/xml", "text/html",
 		"text/richtext", "text/plain", "text/css", "text/x-script",
@@ -178,15 +203,35 @@ func (con *Controller) PayloadAuditLogMiddleware() func(c *gin.Context) {
 	}
 	MIMEChecker := acascii.MustCompileString(textPayloadMIME)
 
+	auditor := con.payloadAuditor
+	if auditor == nil {
+		// default config always compiles
+		auditor, _ = newPayloadAuditor(PayloadAuditConfig{})
+	}
+	// bodies are buffered longer than logged for redacting
+	requestBufferBytes := auditor.config.RequestBodyMaxBytes
+	if requestBufferBytes < redactionBufferBytes {
+		requestBufferBytes = redactionBufferBytes
+	}
+	responseBufferBytes := auditor.config.ResponseBodyMaxBytes
+	if responseBufferBytes < redactionBufferBytes {
+		responseBufferBytes = redactionBufferBytes
+	}
+
 	return func(c *gin.Context) {
 		if c.Request.Method == http.MethodHead ||
 			c.Request.Method == http.MethodOptions {
 			return
 		}
 
+		c.Set(ctxRequestHeadersAuditKey, auditor.redactHeaders(c.Request.Header))
+		if auditor.skips(c.FullPath()) {
+			return
+		}
+
 		var reqBuf = bytebufferpool.Get()
 		defer bytebufferpool.Put(reqBuf)
-		limitedReqBuf := limitio.NewWriter(reqBuf, RequestBodyMaxLength, true)
+		limitedReqBuf := limitio.NewWriter(reqBuf, requestBufferBytes, true)
 
 		c.Request.Body = &readCloser{
 			Reader: io.TeeReader(c.Request.Body, limitedReqBuf),
@@ -197,7 +242,7 @@ func (con *Controller) PayloadAuditLogMiddleware() func(c *gin.Context) {
 		if con.AuditResponse {
 			respBuf = bytebufferpool.Get()
 			defer bytebufferpool.Put(respBuf)
-			limitedRespBuf := limitio.NewWriter(respBuf, ResponseBodyMaxLength, true)
+			limitedRespBuf := limitio.NewWriter(respBuf, responseBufferBytes, true)
 
 			c.Writer = &logWriter{
 				ResponseWriter: c.Writer,
@@ -223,18 +268,22 @@ func (con *Controller) PayloadAuditLogMiddleware() func(c *gin.Context) {
 				reqContentType = http.DetectContentType(reqBuf.Bytes())
 			}
 			if reqContentType != "" && MIMEChecker.MatchString(reqContentType) {
-				reqBody = reqBuf.String()
+				reqBody = auditor.redactBody(reqBuf.Bytes(), reqContentType, auditor.config.RequestBodyMaxBytes)
 			} else {
 				reqBody = "unsupported content type: " + reqContentType
 			}
 			c.Set(ctxRequestAuditKey, &reqBody)
 		}
 
+		if con.AuditResponse {
+			c.Set(ctxResponseHeadersAuditKey, auditor.redactHeaders(c.Writer.Header()))
+		}
+
 		//goland:noinspection ALL
 		if con.AuditResponse && respBuf.Len() > 0 {
 			if respContentType := c.Writer.Header().Get("Content-Type"); respContentType != "" && MIMEChecker.MatchString(respContentType) {
 				//goland:noinspection ALL
-				respBody = respBuf.String()
+				respBody = auditor.redactBody(respBuf.Bytes(), respContentType, auditor.config.ResponseBodyMaxBytes)
 			} else {
 				respBody = "unsupported content type: " + respContentType
 			}
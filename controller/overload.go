@@ -0,0 +1,310 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"telescope/errorcode"
+	"telescope/metric"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/stats/v4"
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultTimeoutSeconds       = 30
+	defaultTargetLatencyMs      = 500
+	defaultRetryAfterSeconds    = 1
+	adaptiveDecreaseFactor      = 0.9
+	adaptiveDecreaseMinInterval = 100 * time.Millisecond
+)
+
+var (
+	defaultShedExemptRoutes = []string{"/healthz", "/readyz"}
+
+	// streamHandlers serve long-lived connections,
+	// which have no deadline and never take a seat of load shedding.
+	streamHandlers = map[string]bool{
+		handlerName((*Controller).Events):    true,
+		handlerName((*Controller).WebSocket): true,
+	}
+)
+
+// TimeoutConfig sets deadline of requests by route
+type TimeoutConfig struct {
+	// DefaultSeconds is deadline of routes without a rule, defaults to 30, negative means no deadline
+	DefaultSeconds int
+	// Routes override DefaultSeconds for groups of routes
+	Routes []TimeoutRule
+}
+
+// TimeoutRule sets deadline of routes under Prefix
+type TimeoutRule struct {
+	// Prefix of route templates like "/api/uploads", matching whole segments.
+	// The longest matching prefix wins.
+	Prefix string
+	// Seconds of deadline, negative means no deadline
+	Seconds int
+}
+
+// LoadSheddingConfig caps requests in flight
+type LoadSheddingConfig struct {
+	// MaxInFlight requests are served at once, more are rejected with 503 right away.
+	// 0 disables load shedding.
+	MaxInFlight int
+	// Adaptive starts limit at MaxInFlight and adjusts it by latency in [MinInFlight, MaxInFlight]:
+	// limit grows while requests finish within TargetLatencyMilliseconds, and shrinks when they don't.
+	Adaptive bool
+	// MinInFlight is the lower bound of adaptive limit, defaults to 1/10 of MaxInFlight
+	MinInFlight int
+	// TargetLatencyMilliseconds of adaptive limit, defaults to 500
+	TargetLatencyMilliseconds int
+	// RetryAfterSeconds told to rejected clients, defaults to 1
+	RetryAfterSeconds int
+	// ExemptRoutes are route templates never shed, defaults to health probes
+	ExemptRoutes []string
+}
+
+func (l LoadSheddingConfig) withDefaults() LoadSheddingConfig {
+	if l.MinInFlight <= 0 {
+		l.MinInFlight = l.MaxInFlight / 10
+	}
+	if l.MinInFlight < 1 {
+		l.MinInFlight = 1
+	}
+	if l.MinInFlight > l.MaxInFlight {
+		l.MinInFlight = l.MaxInFlight
+	}
+	if l.TargetLatencyMilliseconds <= 0 {
+		l.TargetLatencyMilliseconds = defaultTargetLatencyMs
+	}
+	if l.RetryAfterSeconds <= 0 {
+		l.RetryAfterSeconds = defaultRetryAfterSeconds
+	}
+	if l.ExemptRoutes == nil {
+		l.ExemptRoutes = defaultShedExemptRoutes
+	}
+
+	return l
+}
+
+func (l LoadSheddingConfig) targetLatency() time.Duration {
+	return time.Duration(l.TargetLatencyMilliseconds) * time.Millisecond
+}
+
+// routeTimeouts tells deadline of routes, use newRouteTimeouts to create one.
+type routeTimeouts struct {
+	defaultTimeout time.Duration
+	// rules with longer prefix first
+	rules []TimeoutRule
+}
+
+func newRouteTimeouts(config TimeoutConfig) (timeouts *routeTimeouts, err error) {
+	if config.DefaultSeconds == 0 {
+		config.DefaultSeconds = defaultTimeoutSeconds
+	}
+	timeouts = &routeTimeouts{
+		defaultTimeout: time.Duration(config.DefaultSeconds) * time.Second,
+		rules:          make([]TimeoutRule, 0, len(config.Routes)),
+	}
+
+	for _, rule := range config.Routes {
+		rule.Prefix, err = normalizeRoutePrefix(rule.Prefix)
+		if err != nil {
+			timeouts = nil
+			err = fmt.Errorf("timeout: %w", err)
+			return
+		}
+		if rule.Seconds == 0 {
+			timeouts = nil
+			err = fmt.Errorf("timeout of prefix %q must not be 0, use negative for no deadline", rule.Prefix)
+			return
+		}
+
+		timeouts.rules = append(timeouts.rules, rule)
+	}
+	sort.SliceStable(timeouts.rules, func(i, j int) bool {
+		return len(timeouts.rules[i].Prefix) > len(timeouts.rules[j].Prefix)
+	})
+
+	return
+}
+
+// timeoutOf route template, not positive means no deadline
+func (t *routeTimeouts) timeoutOf(route string) time.Duration {
+	for _, rule := range t.rules {
+		if matchRoutePrefix(route, rule.Prefix) {
+			return time.Duration(rule.Seconds) * time.Second
+		}
+	}
+
+	return t.defaultTimeout
+}
+
+// concurrencyLimiter admits requests while in-flight ones are under limit,
+// use newConcurrencyLimiter to create one.
+type concurrencyLimiter struct {
+	config   LoadSheddingConfig
+	inFlight atomic.Int64
+	limit    atomic.Int64
+
+	// mu guards adjusting limit
+	mu           sync.Mutex
+	lastDecrease time.Time
+}
+
+func newConcurrencyLimiter(config LoadSheddingConfig) *concurrencyLimiter {
+	config = config.withDefaults()
+	limiter := &concurrencyLimiter{config: config}
+	limiter.limit.Store(int64(config.MaxInFlight))
+
+	return limiter
+}
+
+// acquire takes a seat, call release after the request if ok.
+func (l *concurrencyLimiter) acquire() (ok bool) {
+	if l.inFlight.Inc() > l.limit.Load() {
+		l.inFlight.Dec()
+		return false
+	}
+
+	return true
+}
+
+// release frees the seat of a request finished in latency,
+// changed tells whether adaptive limit is adjusted.
+func (l *concurrencyLimiter) release(latency time.Duration, now time.Time) (changed bool) {
+	inFlight := l.inFlight.Dec()
+	if !l.config.Adaptive {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := l.limit.Load()
+	next := limit
+	if latency > l.config.targetLatency() {
+		// backs off multiplicatively, but only once for a burst of slow requests
+		if now.Sub(l.lastDecrease) < adaptiveDecreaseMinInterval {
+			return
+		}
+		l.lastDecrease = now
+		next = int64(float64(limit) * adaptiveDecreaseFactor)
+		if next < int64(l.config.MinInFlight) {
+			next = int64(l.config.MinInFlight)
+		}
+	} else if (inFlight+1)*2 >= limit && limit < int64(l.config.MaxInFlight) {
+		// probes for more only when the limit is actually in use
+		next = limit + 1
+	}
+
+	if next == limit {
+		return
+	}
+	l.limit.Store(next)
+	changed = true
+	return
+}
+
+// isStream tells whether c is served by a handler of long-lived connection
+func isStream(c *gin.Context) bool {
+	return streamHandlers[normalizeHandlerName(c.HandlerName())]
+}
+
+// routeOf c for metric tags
+func routeOf(c *gin.Context) string {
+	route := c.FullPath()
+	if route == "" {
+		route = unmatchedRoute
+	}
+
+	return route
+}
+
+// LoadSheddingMiddleware rejects requests with 503 and Retry-After
+// once requests in flight reach the limit, so that accepted ones are still served in time.
+// Streams and exempt routes are never rejected nor counted.
+//
+// Use it inside ErrorMiddleware.
+func (con *Controller) LoadSheddingMiddleware() func(c *gin.Context) {
+	limiter := con.concurrencyLimiter
+	if limiter == nil {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+
+	exemptRoutes := make(map[string]bool, len(limiter.config.ExemptRoutes))
+	for _, route := range limiter.config.ExemptRoutes {
+		exemptRoutes[route] = true
+	}
+	retryAfter := strconv.Itoa(limiter.config.RetryAfterSeconds)
+	con.Metric.Set(metric.ConcurrencyLimit, limiter.limit.Load())
+
+	return func(c *gin.Context) {
+		if exemptRoutes[c.FullPath()] || isStream(c) {
+			c.Next()
+			return
+		}
+
+		if !limiter.acquire() {
+			con.Metric.Incr(metric.RequestsShedTotal, stats.T("route", routeOf(c)))
+			c.Header("Retry-After", retryAfter)
+			_ = c.Error(errorcode.ErrServiceOverloaded)
+			c.Abort()
+			return
+		}
+
+		startedAt := time.Now()
+		defer func() {
+			if limiter.release(time.Since(startedAt), time.Now()) {
+				con.Metric.Set(metric.ConcurrencyLimit, limiter.limit.Load())
+			}
+		}()
+
+		c.Next()
+	}
+}
+
+// TimeoutMiddleware sets deadline on request context by route,
+// requests not finished in time get 504 unless they have been responded.
+//
+// Deadline takes effect only if handlers pass request context downstream,
+// e.g. to database and cache. Streams have no deadline.
+//
+// Use it inside ErrorMiddleware.
+func (con *Controller) TimeoutMiddleware() func(c *gin.Context) {
+	timeouts := con.timeouts
+	if timeouts == nil {
+		// default config always works
+		timeouts, _ = newRouteTimeouts(TimeoutConfig{})
+	}
+
+	return func(c *gin.Context) {
+		timeout := timeouts.timeoutOf(c.FullPath())
+		if timeout <= 0 || isStream(c) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return
+		}
+		con.Metric.Incr(metric.RequestsTimedOutTotal, stats.T("route", routeOf(c)))
+		if !c.Writer.Written() {
+			_ = c.Error(errorcode.ErrRequestTimeout)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"telescope/errorcode"
+	"telescope/metric"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func Test_routeTimeouts_timeoutOf(t *testing.T) {
+	timeouts, err := newRouteTimeouts(TimeoutConfig{
+		Routes: []TimeoutRule{
+			{Prefix: "/api/uploads", Seconds: 300},
+			{Prefix: "/api/admin/", Seconds: -1},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		route string
+		want  time.Duration
+	}{
+		{route: "/api/uploads", want: 300 * time.Second},
+		{route: "/api/admin/log-level", want: -time.Second},
+		{route: "/api/whoami", want: defaultTimeoutSeconds * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			assert.Equal(t, tt.want, timeouts.timeoutOf(tt.route))
+		})
+	}
+
+	_, err = newRouteTimeouts(TimeoutConfig{Routes: []TimeoutRule{{Prefix: "/api"}}})
+	assert.Error(t, err)
+}
+
+func Test_concurrencyLimiter_adaptive(t *testing.T) {
+	config := LoadSheddingConfig{
+		MaxInFlight:               10,
+		Adaptive:                  true,
+		MinInFlight:               5,
+		TargetLatencyMilliseconds: 100,
+	}
+	now := time.Now()
+
+	t.Run("shrink once in a burst", func(t *testing.T) {
+		limiter := newConcurrencyLimiter(config)
+		for i := 0; i < 10; i++ {
+			require.True(t, limiter.acquire())
+		}
+		assert.False(t, limiter.acquire())
+
+		assert.True(t, limiter.release(time.Second, now))
+		assert.False(t, limiter.release(time.Second, now.Add(time.Millisecond)))
+		assert.Equal(t, int64(9), limiter.limit.Load())
+	})
+
+	t.Run("never below MinInFlight", func(t *testing.T) {
+		limiter := newConcurrencyLimiter(config)
+		for i := 1; i <= 10; i++ {
+			require.True(t, limiter.acquire())
+			limiter.release(time.Second, now.Add(time.Duration(i)*time.Second))
+		}
+		assert.Equal(t, int64(5), limiter.limit.Load())
+	})
+
+	t.Run("grow while in use", func(t *testing.T) {
+		limiter := newConcurrencyLimiter(config)
+		limiter.limit.Store(6)
+
+		require.True(t, limiter.acquire())
+		assert.False(t, limiter.release(time.Millisecond, now))
+
+		for limiter.acquire() {
+		}
+		assert.True(t, limiter.release(time.Millisecond, now))
+		assert.Equal(t, int64(7), limiter.limit.Load())
+	})
+}
+
+func TestController_LoadSheddingMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	con := &Controller{
+		Logger:             zap.NewNop(),
+		Metric:             metric.NewNopCollector(),
+		concurrencyLimiter: newConcurrencyLimiter(LoadSheddingConfig{MaxInFlight: 1, RetryAfterSeconds: 3}),
+	}
+
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	g := gin.New()
+	g.Use(con.ErrorMiddleware, con.LoadSheddingMiddleware())
+	g.GET("/slow", func(c *gin.Context) {
+		close(entered)
+		<-release
+		c.Status(http.StatusNoContent)
+	})
+	g.GET("/healthz", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/slow", nil))
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "3", w.Header().Get("Retry-After"))
+	var resp R
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, errorcode.CodeServiceOverloaded, resp.Code)
+
+	// health probes are exempt
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	close(release)
+	<-done
+	assert.Equal(t, int64(0), con.concurrencyLimiter.inFlight.Load())
+}
+
+func TestController_TimeoutMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	timeouts, err := newRouteTimeouts(TimeoutConfig{
+		DefaultSeconds: 1,
+		Routes:         []TimeoutRule{{Prefix: "/forever", Seconds: -1}},
+	})
+	require.NoError(t, err)
+	// sub-second deadline for testing
+	timeouts.defaultTimeout = 20 * time.Millisecond
+	con := &Controller{
+		Logger:   zap.NewNop(),
+		Metric:   metric.NewNopCollector(),
+		timeouts: timeouts,
+	}
+
+	g := gin.New()
+	g.Use(con.ErrorMiddleware, con.TimeoutMiddleware())
+	waitForDeadline := func(c *gin.Context) {
+		_, hasDeadline := c.Request.Context().Deadline()
+		if !hasDeadline {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		<-c.Request.Context().Done()
+		_ = c.Error(c.Request.Context().Err())
+	}
+	g.GET("/slow", waitForDeadline)
+	g.GET("/forever", waitForDeadline)
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{path: "/slow", wantStatus: http.StatusGatewayTimeout},
+		{path: "/forever", wantStatus: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func Test_isStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	con := &Controller{Logger: zap.NewNop()}
+	var got bool
+	g := gin.New()
+	g.Use(func(c *gin.Context) {
+		got = isStream(c)
+		c.AbortWithStatus(http.StatusNoContent)
+	})
+	g.GET("/events", con.Events)
+	g.GET("/ws", con.WebSocket)
+	g.GET("/hello", con.Hello)
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{path: "/events", want: true},
+		{path: "/ws", want: true},
+		{path: "/hello", want: false},
+		{path: "/unmatched", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -14,6 +14,8 @@ type R struct {
 	Code int         `json:"code"`
 	Msg  string      `json:"msg"`
 	Data interface{} `json:"data"`
+	// Details on the error, e.g. []FieldError telling what's wrong with request fields
+	Details interface{} `json:"details,omitempty"`
 }
 
 func ok(c *gin.Context, data interface{}) {
@@ -0,0 +1,230 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"telescope/cache"
+	"telescope/database"
+	"telescope/errorcode"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	ctxPermissionsKey = "permissions"
+
+	// permissionWildcard grants everything, or everything under a prefix like "audit:*"
+	permissionWildcard = "*"
+	// rolePermissionsCachePrefix role permissions loaded from Postgres are cached under this prefix,
+	// add pattern "role-permissions:*" on table "role_permissions" in CacheInvalidation
+	// to revoke them on change.
+	rolePermissionsCachePrefix = "role-permissions:"
+	defaultPermissionCache     = 60
+)
+
+// PermissionConfig config on role-based authorization
+type PermissionConfig struct {
+	// Roles maps role to its permissions, e.g. admin = ["*"], auditor = ["audit:*"]
+	Roles map[string][]string
+	// FromDatabase also grants permissions stored in Postgres table role_permissions
+	FromDatabase bool
+	// CacheSeconds is how long permissions from Postgres are cached in Redis, defaults to 60
+	CacheSeconds int
+}
+
+// PermissionResolver tells which permissions roles have
+type PermissionResolver struct {
+	static       map[string][]string
+	fromDatabase bool
+	cacheTTL     time.Duration
+	db           *database.DB
+	cache        *cache.Cache
+}
+
+// NewPermissionResolver creates a PermissionResolver,
+// db and cache are only used when config.FromDatabase is true.
+func NewPermissionResolver(config PermissionConfig, db *database.DB, cache *cache.Cache) *PermissionResolver {
+	if config.CacheSeconds <= 0 {
+		config.CacheSeconds = defaultPermissionCache
+	}
+
+	return &PermissionResolver{
+		static:       config.Roles,
+		fromDatabase: config.FromDatabase,
+		cacheTTL:     time.Duration(config.CacheSeconds) * time.Second,
+		db:           db,
+		cache:        cache,
+	}
+}
+
+// Permissions returns all permissions granted to roles
+func (r *PermissionResolver) Permissions(ctx context.Context, roles []string) (set PermissionSet, err error) {
+	set = make(PermissionSet)
+	for _, role := range roles {
+		for _, permission := range r.static[role] {
+			set[permission] = struct{}{}
+		}
+
+		if !r.fromDatabase {
+			continue
+		}
+
+		var permissions []string
+		permissions, err = r.permissionsFromDatabase(ctx, role)
+		if err != nil {
+			err = fmt.Errorf("loading permissions of role %q: %w", role, err)
+			return
+		}
+		for _, permission := range permissions {
+			set[permission] = struct{}{}
+		}
+	}
+
+	return
+}
+
+// permissionsFromDatabase cache aside
+func (r *PermissionResolver) permissionsFromDatabase(ctx context.Context, role string) (permissions []string, err error) {
+	key := rolePermissionsCachePrefix + role
+
+	err = r.cache.Read(ctx, key, &permissions)
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, redis.Nil) {
+		err = fmt.Errorf("reading cache: %w", err)
+		return
+	}
+
+	permissions, err = r.db.PermissionsOfRole(ctx, role)
+	if err != nil {
+		err = fmt.Errorf("PermissionsOfRole: %w", err)
+		return
+	}
+
+	// cache empty result as well, so that roles without permission don't hit database
+	if permissions == nil {
+		permissions = []string{}
+	}
+	err = r.cache.Update(ctx, key, permissions, r.cacheTTL)
+	if err != nil {
+		err = fmt.Errorf("updating cache: %w", err)
+		return
+	}
+
+	return
+}
+
+// PermissionSet a set of permissions
+type PermissionSet map[string]struct{}
+
+// Allows tells whether permission is granted,
+// either directly, by "*", or by a wildcard like "audit:*" for "audit:read".
+func (s PermissionSet) Allows(permission string) bool {
+	if _, ok := s[permission]; ok {
+		return true
+	}
+	if _, ok := s[permissionWildcard]; ok {
+		return true
+	}
+
+	for i := len(permission) - 1; i > 0; i-- {
+		if permission[i] != ':' {
+			continue
+		}
+		if _, ok := s[permission[:i+1]+permissionWildcard]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sorted lists permissions in order
+func (s PermissionSet) Sorted() (permissions []string) {
+	permissions = make([]string, 0, len(s))
+	for permission := range s {
+		permissions = append(permissions, permission)
+	}
+	sort.Strings(permissions)
+
+	return
+}
+
+// RequirePermission guards routes so that only callers
+// having all of permissions can get through.
+//
+// Anonymous callers get ErrUnauthorized, while those lacking permission get ErrForbidden.
+func (con *Controller) RequirePermission(permissions ...string) func(c *gin.Context) {
+	return func(c *gin.Context) {
+		allowed, err := con.can(c, permissions...)
+		if err != nil {
+			_ = c.Error(err)
+			c.Abort()
+			return
+		}
+		if !allowed {
+			_ = c.Error(errorcode.ErrForbidden)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// can tells whether the caller has all of permissions,
+// err is ErrUnauthorized if the caller is anonymous.
+func (con *Controller) can(c *gin.Context, permissions ...string) (allowed bool, err error) {
+	set, err := con.permissionsOf(c)
+	if err != nil {
+		return
+	}
+
+	for _, permission := range permissions {
+		if !set.Allows(permission) {
+			return
+		}
+	}
+
+	allowed = true
+	return
+}
+
+// permissionsOf resolves permissions of the caller once per request
+func (con *Controller) permissionsOf(c *gin.Context) (set PermissionSet, err error) {
+	if value, ok := c.Get(ctxPermissionsKey); ok {
+		set = value.(PermissionSet)
+		return
+	}
+
+	principal, ok := principalOf(c)
+	if !ok {
+		err = errorcode.ErrUnauthorized
+		return
+	}
+
+	set, err = con.Permissions.Permissions(c.Request.Context(), principal.Roles)
+	if err != nil {
+		err = fmt.Errorf("resolving permissions: %w", err)
+		return
+	}
+
+	c.Set(ctxPermissionsKey, set)
+	return
+}
+
+// MyPermissions lists permissions of the caller
+func (con *Controller) MyPermissions(c *gin.Context) {
+	set, err := con.permissionsOf(c)
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	ok(c, set.Sorted())
+}
@@ -0,0 +1,68 @@
+package controller
+
+import "testing"
+
+func TestPermissionSet_Allows(t *testing.T) {
+	tests := []struct {
+		testName   string
+		set        PermissionSet
+		permission string
+		want       bool
+	}{
+		{
+			testName:   "empty",
+			set:        PermissionSet{},
+			permission: "audit:read",
+			want:       false,
+		},
+		{
+			testName:   "exact",
+			set:        PermissionSet{"audit:read": {}},
+			permission: "audit:read",
+			want:       true,
+		},
+		{
+			testName:   "other",
+			set:        PermissionSet{"audit:read": {}},
+			permission: "audit:write",
+			want:       false,
+		},
+		{
+			testName:   "everything",
+			set:        PermissionSet{"*": {}},
+			permission: "audit:read",
+			want:       true,
+		},
+		{
+			testName:   "prefix wildcard",
+			set:        PermissionSet{"audit:*": {}},
+			permission: "audit:read",
+			want:       true,
+		},
+		{
+			testName:   "nested prefix wildcard",
+			set:        PermissionSet{"audit:*": {}},
+			permission: "audit:record:delete",
+			want:       true,
+		},
+		{
+			testName:   "prefix wildcard does not leak",
+			set:        PermissionSet{"audit:*": {}},
+			permission: "auditor:read",
+			want:       false,
+		},
+		{
+			testName:   "wildcard is not a prefix of itself",
+			set:        PermissionSet{"audit:*": {}},
+			permission: "audit",
+			want:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			if got := tt.set.Allows(tt.permission); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
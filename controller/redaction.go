@@ -0,0 +1,226 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	defaultAuditBodyMaxBytes = 512
+	// redactionBufferBytes of body are buffered for redacting, which is cut to max bytes afterwards,
+	// so that JSON bodies longer than max bytes can be parsed.
+	redactionBufferBytes = 64 << 10
+	redactedValue        = "[REDACTED]"
+)
+
+var (
+	defaultRedactFields = []string{"password", "secret", "token", "accessToken", "refreshToken", "apiKey", "credential"}
+	defaultLogHeaders   = []string{"Accept", "Accept-Language", "Content-Length", "Content-Type", "User-Agent", "X-Request-ID"}
+)
+
+// PayloadAuditConfig config on payloads in API audit log
+type PayloadAuditConfig struct {
+	// RequestBodyMaxBytes of request body logged, defaults to 512
+	RequestBodyMaxBytes int
+	// ResponseBodyMaxBytes of response body logged when AuditResponse is on, defaults to 512
+	ResponseBodyMaxBytes int
+	// RedactFields are masked in JSON bodies, case-insensitive.
+	// A name like "password" matches at any depth, while a path like "card.number" matches from root.
+	// Defaults to names of common secrets.
+	RedactFields []string
+	// RedactPatterns are regular expressions whose matches are masked in bodies, e.g. `\b\d{13,19}\b` for card numbers
+	RedactPatterns []string
+	// LogHeaders are request and response headers logged as they are, others are logged masked.
+	// Defaults to a few harmless ones.
+	LogHeaders []string
+	// SkipRoutes are route templates like "/api/session" whose bodies are never logged
+	SkipRoutes []string
+}
+
+func (p PayloadAuditConfig) withDefaults() PayloadAuditConfig {
+	if p.RequestBodyMaxBytes <= 0 {
+		p.RequestBodyMaxBytes = defaultAuditBodyMaxBytes
+	}
+	if p.ResponseBodyMaxBytes <= 0 {
+		p.ResponseBodyMaxBytes = defaultAuditBodyMaxBytes
+	}
+	if p.RedactFields == nil {
+		p.RedactFields = defaultRedactFields
+	}
+	if p.LogHeaders == nil {
+		p.LogHeaders = defaultLogHeaders
+	}
+
+	return p
+}
+
+// payloadAuditor redacts payloads for audit log, use newPayloadAuditor to create one.
+type payloadAuditor struct {
+	config PayloadAuditConfig
+	// names match fields at any depth, in lower case
+	names map[string]bool
+	// paths match fields from root, in lower case
+	paths map[string]bool
+	// rawFields matches fields in bodies which are not valid JSON, e.g. truncated ones
+	rawFields *regexp.Regexp
+	patterns  []*regexp.Regexp
+	// headers logged as they are, in canonical form
+	headers    map[string]bool
+	skipRoutes map[string]bool
+}
+
+func newPayloadAuditor(config PayloadAuditConfig) (auditor *payloadAuditor, err error) {
+	config = config.withDefaults()
+	auditor = &payloadAuditor{
+		config:     config,
+		names:      make(map[string]bool),
+		paths:      make(map[string]bool),
+		headers:    make(map[string]bool, len(config.LogHeaders)),
+		skipRoutes: make(map[string]bool, len(config.SkipRoutes)),
+	}
+
+	var rawNames []string
+	for _, field := range config.RedactFields {
+		field = strings.ToLower(field)
+		if strings.Contains(field, ".") {
+			auditor.paths[field] = true
+			field = field[strings.LastIndexByte(field, '.')+1:]
+		} else {
+			auditor.names[field] = true
+		}
+		rawNames = append(rawNames, regexp.QuoteMeta(field))
+	}
+	if len(rawNames) > 0 {
+		// string values may be cut short without closing quote
+		auditor.rawFields = regexp.MustCompile(`(?i)"(` + strings.Join(rawNames, "|") + `)"\s*:\s*("(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`)
+	}
+
+	for _, pattern := range config.RedactPatterns {
+		var compiled *regexp.Regexp
+		compiled, err = regexp.Compile(pattern)
+		if err != nil {
+			auditor = nil
+			err = fmt.Errorf("compiling redact pattern %q: %w", pattern, err)
+			return
+		}
+		auditor.patterns = append(auditor.patterns, compiled)
+	}
+
+	for _, header := range config.LogHeaders {
+		auditor.headers[http.CanonicalHeaderKey(header)] = true
+	}
+	for _, route := range config.SkipRoutes {
+		auditor.skipRoutes[route] = true
+	}
+
+	return
+}
+
+// skips tells whether bodies of route are not logged
+func (a *payloadAuditor) skips(route string) bool {
+	return a.skipRoutes[route]
+}
+
+// redactBody masks secrets in body then cuts it to maxBytes
+func (a *payloadAuditor) redactBody(body []byte, contentType string, maxBytes int) string {
+	if isJSONContentType(contentType) {
+		if redacted, ok := a.redactJSON(body); ok {
+			body = redacted
+		} else if a.rawFields != nil {
+			body = a.rawFields.ReplaceAll(body, []byte(`"${1}":"`+redactedValue+`"`))
+		}
+	}
+
+	for _, pattern := range a.patterns {
+		body = pattern.ReplaceAll(body, []byte(redactedValue))
+	}
+
+	if len(body) > maxBytes {
+		body = body[:maxBytes]
+	}
+
+	return string(body)
+}
+
+// redactJSON ok is false if body is not valid JSON
+func (a *payloadAuditor) redactJSON(body []byte) (redacted []byte, ok bool) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	// keeps numbers as they are
+	decoder.UseNumber()
+
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(a.redactValue(value, ""))
+	if err != nil {
+		return
+	}
+
+	redacted = bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	ok = true
+	return
+}
+
+// redactValue path is the dotted path of value from root, array indexes are left out.
+func (a *payloadAuditor) redactValue(value interface{}, path string) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			lowerKey := strings.ToLower(key)
+			childPath := lowerKey
+			if path != "" {
+				childPath = path + "." + lowerKey
+			}
+
+			if a.names[lowerKey] || a.paths[childPath] {
+				value[key] = redactedValue
+				continue
+			}
+			value[key] = a.redactValue(child, childPath)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = a.redactValue(child, path)
+		}
+	}
+
+	return value
+}
+
+// redactHeaders masks values of headers not allowed to be logged
+func (a *payloadAuditor) redactHeaders(header http.Header) (logged map[string]string) {
+	if len(header) == 0 {
+		return
+	}
+
+	logged = make(map[string]string, len(header))
+	for name, values := range header {
+		if a.headers[name] {
+			logged[name] = strings.Join(values, ", ")
+		} else {
+			logged[name] = redactedValue
+		}
+	}
+
+	return
+}
+
+func isJSONContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
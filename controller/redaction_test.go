@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_payloadAuditor_redactBody(t *testing.T) {
+	auditor, err := newPayloadAuditor(PayloadAuditConfig{
+		RedactFields:   []string{"password", "card.number"},
+		RedactPatterns: []string{`\b\d{16}\b`},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		testName    string
+		body        string
+		contentType string
+		maxBytes    int
+		want        string
+	}{
+		{
+			testName:    "field at any depth",
+			body:        `{"username":"alice","Password":"123456","profile":{"password":"abc"}}`,
+			contentType: "application/json; charset=utf-8",
+			maxBytes:    512,
+			want:        `{"Password":"[REDACTED]","profile":{"password":"[REDACTED]"},"username":"alice"}`,
+		},
+		{
+			testName:    "path from root",
+			body:        `{"card":{"number":"4111"},"items":[{"number":7}],"order":{"card":{"number":"4111"}}}`,
+			contentType: "application/json",
+			maxBytes:    512,
+			want:        `{"card":{"number":"[REDACTED]"},"items":[{"number":7}],"order":{"card":{"number":"4111"}}}`,
+		},
+		{
+			testName:    "truncated JSON",
+			body:        `{"username":"alice","password":"1234`,
+			contentType: "application/json",
+			maxBytes:    512,
+			want:        `{"username":"alice","password":"[REDACTED]"`,
+		},
+		{
+			testName:    "pattern",
+			body:        "paid by 4111111111111111 today",
+			contentType: "text/plain",
+			maxBytes:    512,
+			want:        "paid by [REDACTED] today",
+		},
+		{
+			testName:    "cut after redacting",
+			body:        `{"password":"a very long password which is longer than max bytes"}`,
+			contentType: "application/json",
+			maxBytes:    16,
+			want:        `{"password":"[RE`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			got := auditor.redactBody([]byte(tt.body), tt.contentType, tt.maxBytes)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_newPayloadAuditor_badPattern(t *testing.T) {
+	_, err := newPayloadAuditor(PayloadAuditConfig{RedactPatterns: []string{`(`}})
+	assert.Error(t, err)
+}
+
+func TestController_PayloadAuditLogMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	auditor, err := newPayloadAuditor(PayloadAuditConfig{
+		SkipRoutes: []string{"/secret/:id"},
+	})
+	require.NoError(t, err)
+	con := &Controller{
+		Logger:         zap.New(core),
+		AuditResponse:  true,
+		payloadAuditor: auditor,
+	}
+
+	g := gin.New()
+	g.Use(con.LogMiddleware, con.PayloadAuditLogMiddleware())
+	echo := func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/json", body)
+	}
+	g.POST("/login", echo)
+	g.POST("/secret/:id", echo)
+
+	tests := []struct {
+		path       string
+		wantBody   string
+		wantLogged bool
+	}{
+		{path: "/login", wantBody: `{"password":"[REDACTED]","username":"alice"}`, wantLogged: true},
+		{path: "/secret/42", wantLogged: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			logs.TakeAll()
+
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(`{"username":"alice","password":"123456"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Authorization", "Bearer secret")
+			g.ServeHTTP(httptest.NewRecorder(), req)
+
+			entries := logs.TakeAll()
+			require.Len(t, entries, 1)
+			fields := entries[0].ContextMap()
+
+			headers, ok := fields["requestHeaders"].(map[string]string)
+			require.True(t, ok)
+			assert.Equal(t, redactedValue, headers["Authorization"])
+			assert.Equal(t, "application/json", headers["Content-Type"])
+
+			_, logged := fields["requestBody"]
+			assert.Equal(t, tt.wantLogged, logged)
+			if tt.wantLogged {
+				assert.Equal(t, tt.wantBody, fields["requestBody"])
+				assert.Equal(t, tt.wantBody, fields["responseBody"])
+			}
+		})
+	}
+}
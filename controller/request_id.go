@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"telescope/logging"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	ctxLoggerKey = "logger"
+
+	requestIDHeader = "X-Request-ID"
+	// requestIDMaxLength longer incoming request ID is replaced
+	requestIDMaxLength = 128
+	requestIDLength    = 24
+)
+
+// RequestIDMiddleware accepts X-Request-ID from upstream or generates one,
+// echoes it in response, and attaches a logger carrying it to both gin.Context and context.Context,
+// so that one ID threads through logs of controller, database and cache.
+//
+// Use it as the outermost middleware.
+func (con *Controller) RequestIDMiddleware(c *gin.Context) {
+	requestID := c.GetHeader(requestIDHeader)
+	if !validRequestID(requestID) {
+		var err error
+		requestID, err = secureToken(requestIDLength)
+		if err != nil {
+			// should never happen, just go on without request ID
+			con.Logger.Error("generating request ID", zap.Error(err))
+			c.Next()
+			return
+		}
+	}
+
+	c.Writer.Header().Set(requestIDHeader, requestID)
+
+	logger := con.Logger.With(zap.String("requestID", requestID))
+	c.Set(ctxLoggerKey, logger)
+
+	ctx := logging.WithRequestID(c.Request.Context(), requestID)
+	ctx = logging.WithLogger(ctx, logger)
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+}
+
+// loggerOf returns request-scoped logger, or the controller's if there's none.
+func (con *Controller) loggerOf(c *gin.Context) *zap.Logger {
+	if value, ok := c.Get(ctxLoggerKey); ok {
+		if logger, ok := value.(*zap.Logger); ok {
+			return logger
+		}
+	}
+
+	return con.Logger
+}
+
+// validRequestID accepts reasonably short IDs made of URL-safe characters,
+// which keeps log injection out.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > requestIDMaxLength {
+		return false
+	}
+
+	for i := 0; i < len(requestID); i++ {
+		b := requestID[i]
+		switch {
+		case 'a' <= b && b <= 'z',
+			'A' <= b && b <= 'Z',
+			'0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == ':', b == '=':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telescope/logging"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func Test_validRequestID(t *testing.T) {
+	tests := []struct {
+		testName  string
+		requestID string
+		want      bool
+	}{
+		{testName: "uuid", requestID: "6f1c2b1e-8d6b-4b0e-9a51-6d2f0c8e7a11", want: true},
+		{testName: "url-safe symbols", requestID: "trace:1=a_b.c", want: true},
+		{testName: "longest", requestID: strings.Repeat("a", requestIDMaxLength), want: true},
+		{testName: "empty", requestID: "", want: false},
+		{testName: "too long", requestID: strings.Repeat("a", requestIDMaxLength+1), want: false},
+		{testName: "line break", requestID: "abc\nlevel=error", want: false},
+		{testName: "space", requestID: "abc def", want: false},
+		{testName: "non-ASCII", requestID: "请求", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			assert.Equal(t, tt.want, validRequestID(tt.requestID))
+		})
+	}
+}
+
+func TestController_RequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	core, logs := observer.New(zap.InfoLevel)
+	con := &Controller{Logger: zap.New(core)}
+
+	var requestIDInContext string
+	g := gin.New()
+	g.Use(con.RequestIDMiddleware)
+	g.GET("/hello", func(c *gin.Context) {
+		requestIDInContext = logging.RequestIDFromContext(c.Request.Context())
+		logging.FromContext(c.Request.Context()).Info("from context")
+		con.loggerOf(c).Info("from gin")
+		c.Status(http.StatusNoContent)
+	})
+
+	tests := []struct {
+		testName     string
+		incoming     string
+		wantAccepted bool
+	}{
+		{testName: "valid", incoming: "upstream-id-1", wantAccepted: true},
+		{testName: "missing", incoming: ""},
+		{testName: "invalid", incoming: "bad id\n"},
+		{testName: "oversized", incoming: strings.Repeat("a", requestIDMaxLength+1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			logs.TakeAll()
+
+			req := httptest.NewRequest(http.MethodGet, "/hello", nil)
+			if tt.incoming != "" {
+				req.Header.Set(requestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, req)
+
+			requestID := w.Header().Get(requestIDHeader)
+			require.True(t, validRequestID(requestID), requestID)
+			if tt.wantAccepted {
+				assert.Equal(t, tt.incoming, requestID)
+			} else {
+				assert.NotEqual(t, tt.incoming, requestID)
+			}
+			assert.Equal(t, requestID, requestIDInContext)
+
+			entries := logs.TakeAll()
+			require.Len(t, entries, 2)
+			for _, entry := range entries {
+				assert.Equal(t, requestID, entry.ContextMap()["requestID"], entry.Message)
+			}
+		})
+	}
+}
@@ -2,14 +2,17 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
-	"os"
-	"os/signal"
-	"syscall"
+	"telescope/audit"
 	"telescope/cache"
 	"telescope/database"
-	"time"
+	"telescope/health"
+	"telescope/lifecycle"
+	"telescope/metric"
+	"telescope/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/nanmu42/gzip"
@@ -18,44 +21,180 @@ import (
 
 // ServerOpt options to start a new server
 type ServerOpt struct {
-	Port          int
-	Logger        *zap.Logger
+	Port   int
+	Logger *zap.Logger
+	// LogLevel of Logger, a fixed one is used if it's zero value
+	LogLevel      zap.AtomicLevel
 	Database      *database.DB
 	Redis         *cache.Cache
 	AuditResponse bool
+	PayloadAudit  PayloadAuditConfig
+	// AuditSink saves audit records besides log, nil means log only
+	AuditSink  audit.Sink
+	Auth       AuthConfig
+	Session    SessionConfig
+	Permission PermissionConfig
+	CORS       CORSConfig
+	// Metric collects HTTP metrics, nil means no collecting
+	Metric       *metric.Collector
+	Health       health.Config
+	Idempotency  IdempotencyConfig
+	SSE          SSEConfig
+	WebSocket    WebSocketConfig
+	Server       ServerConfig
+	BodyLimit    BodyLimitConfig
+	Upload       UploadConfig
+	Timeout      TimeoutConfig
+	LoadShedding LoadSheddingConfig
 }
 
 // NewServer fires a new server
-func NewServer(opt ServerOpt) (server *GracefulServer) {
+func NewServer(opt ServerOpt) (server *GracefulServer, err error) {
+	authenticators, err := newAuthenticators(opt.Auth, opt.Database)
+	if err != nil {
+		err = fmt.Errorf("newAuthenticators: %w", err)
+		return
+	}
+
+	if opt.Metric == nil {
+		opt.Metric = metric.NewNopCollector()
+	}
+	if opt.LogLevel == (zap.AtomicLevel{}) {
+		opt.LogLevel = zap.NewAtomicLevel()
+	}
+
 	control := &Controller{
-		Logger:        opt.Logger,
-		DB:            opt.Database,
-		Cache:         opt.Redis,
-		AuditResponse: opt.AuditResponse,
+		Logger:          opt.Logger,
+		LogLevel:        opt.LogLevel,
+		DB:              opt.Database,
+		Cache:           opt.Redis,
+		AuditResponse:   opt.AuditResponse,
+		AuditSink:       opt.AuditSink,
+		Authenticators:  authenticators,
+		Session:         opt.Session.withDefaults(),
+		Permissions:     NewPermissionResolver(opt.Permission, opt.Database, opt.Redis),
+		Metric:          opt.Metric,
+		Health:          health.NewRegistry(opt.Health),
+		Idempotency:     opt.Idempotency.withDefaults(),
+		SSE:             opt.SSE.withDefaults(),
+		SSEHub:          NewSSEHub(opt.SSE, opt.Logger),
+		WebSocketConfig: opt.WebSocket.withDefaults(),
+		WebSocketHub:    NewWebSocketHub(opt.Redis, opt.Metric, opt.Logger),
+	}
+	control.registerHealthChecks()
+
+	if topics := control.SSE.topicNames(); len(topics) > 0 {
+		err = opt.Database.Watch(context.Background(), control.SSEHub.Publish, topics...)
+		if err != nil {
+			err = fmt.Errorf("watching SSE topics: %w", err)
+			return
+		}
 	}
-	handler := newGin(control)
 
-	// register API route
+	var handler *gin.Engine
+	cors, err := NewCORS(opt.CORS, func() gin.RoutesInfo {
+		return handler.Routes()
+	})
+	if err != nil {
+		err = fmt.Errorf("NewCORS: %w", err)
+		return
+	}
 
+	control.cors = cors
+	control.payloadAuditor, err = newPayloadAuditor(opt.PayloadAudit)
+	if err != nil {
+		err = fmt.Errorf("newPayloadAuditor: %w", err)
+		return
+	}
+	control.bodyLimiter, err = newBodyLimiter(opt.BodyLimit)
+	if err != nil {
+		err = fmt.Errorf("newBodyLimiter: %w", err)
+		return
+	}
+	control.timeouts, err = newRouteTimeouts(opt.Timeout)
+	if err != nil {
+		err = fmt.Errorf("newRouteTimeouts: %w", err)
+		return
+	}
+	if opt.LoadShedding.MaxInFlight > 0 {
+		control.concurrencyLimiter = newConcurrencyLimiter(opt.LoadShedding)
+	}
+	if opt.Upload.Dir != "" {
+		control.Storage, err = storage.NewLocal(storage.LocalConfig{Dir: opt.Upload.Dir})
+		if err != nil {
+			err = fmt.Errorf("storage.NewLocal: %w", err)
+			return
+		}
+	}
+	handler = newGin(control, cors)
+	registerRoutes(handler, control)
+	control.routes = handler.Routes
+
+	server, err = newServer(opt, handler, control.Health.Shutdown, func() {
+		control.SSEHub.Close()
+		control.WebSocketHub.Close()
+	})
+	if err != nil {
+		err = fmt.Errorf("newServer: %w", err)
+		return
+	}
+
+	return
+}
+
+// registerRoutes registers API routes on g
+func registerRoutes(g *gin.Engine, control *Controller) {
 	// index page
-	handler.HEAD("/", control.IndexPage)
-	handler.GET("/", control.IndexPage)
+	g.HEAD("/", control.IndexPage)
+	g.GET("/", control.IndexPage)
 
 	// robots.txt
-	handler.HEAD("/robots.txt", control.RobotsTXT)
-	handler.GET("/robots.txt", control.RobotsTXT)
+	g.HEAD("/robots.txt", control.RobotsTXT)
+	g.GET("/robots.txt", control.RobotsTXT)
 
-	// health
-	group := handler.Group("/api")
+	// liveness and readiness probes
+	g.HEAD("/healthz", control.Healthz)
+	g.GET("/healthz", control.Healthz)
+	g.HEAD("/readyz", control.Readyz)
+	g.GET("/readyz", control.Readyz)
+
+	// API document
+	g.GET("/api/openapi.json", control.OpenAPI)
+	g.GET("/api/docs", control.APIDocPage)
+
+	// hello
+	group := g.Group("/api")
 	group.HEAD("/hello", control.Hello)
 	group.GET("/hello", control.Hello)
 
-	server = newServer(opt, handler)
-	return
+	// cookie session
+	group.POST("/session", control.Login)
+
+	// authenticated
+	authed := group.Group("", control.RequireAuth, control.IdempotencyMiddleware)
+	authed.GET("/whoami", control.Whoami)
+	authed.GET("/permissions", control.MyPermissions)
+	authed.GET("/session", control.CurrentSession)
+	authed.DELETE("/session", control.Logout)
+	authed.DELETE("/session/all", control.LogoutEverywhere)
+	authed.GET("/events", control.Events)
+	authed.GET("/ws", control.WebSocket)
+
+	// authenticated streaming, kept out of idempotency replaying which buffers whole bodies
+	streamed := group.Group("", control.RequireAuth)
+	streamed.POST("/uploads", control.RequirePermission(permissionUpload), control.Upload)
+
+	// administration
+	admin := authed.Group("/admin")
+	admin.GET("/log-level", control.RequirePermission(permissionLogLevel), control.GetLogLevel)
+	admin.PUT("/log-level", control.RequirePermission(permissionLogLevel), control.SetLogLevel)
+	admin.GET("/audit-records", control.RequirePermission(permissionAudit), control.AuditRecords)
+	admin.GET("/users/:id/roles", control.RequirePermission(permissionUserRoles), control.GetUserRoles)
+	admin.PUT("/users/:id/roles", control.RequirePermission(permissionUserRoles), control.UpdateUserRoles)
 }
 
 // newGin get you a glass of gin, flavored
-func newGin(con *Controller) (g *gin.Engine) {
+func newGin(con *Controller, cors *CORS) (g *gin.Engine) {
 	g = gin.New()
 
 	g.ForwardedByClientIP = true
@@ -64,83 +203,161 @@ func newGin(con *Controller) (g *gin.Engine) {
 	g.NoRoute(con.NotFound)
 
 	g.Use(
+		con.RequestIDMiddleware,
+		con.TracingMiddleware,
+		con.MetricMiddleware(),
 		con.RecoveryMiddleware,
+		cors.Middleware,
 		gzip.DefaultHandler().Gin,
-		con.LimitReaderMiddleware(maxRequestBodySize),
 		con.LogMiddleware,
 		con.PayloadAuditLogMiddleware(),
 		con.ErrorMiddleware,
+		con.LoadSheddingMiddleware(),
+		con.TimeoutMiddleware(),
+		con.LimitReaderMiddleware(),
+		con.ConditionalMiddleware,
+		con.AuthMiddleware,
+		con.SessionMiddleware,
 	)
 
 	return
 }
 
+// GracefulServer is the API server driven by lifecycle.Manager, use Register to hook it on.
 type GracefulServer struct {
 	server *http.Server
-	logger *zap.Logger
-	closed chan struct{}
+	config ServerConfig
+	// certs is nil if TLS is off
+	certs    *certReloader
+	logger   *zap.Logger
+	listener net.Listener
+	// stopped is closed on shutting down
+	stopped chan struct{}
+	// markUnready makes readiness probes fail
+	markUnready func()
+	// endStreams ends SSE and WebSocket connections,
+	// which server shutdown waits forever or doesn't wait at all.
+	endStreams func()
 }
 
-func (s *GracefulServer) watchSignal() {
-	const gracefulStopTimeout = 10 * time.Second
+// Register hooks server on lc.
+//
+// Readiness fails first so that load balancers stop sending new requests,
+// then streams are ended for clients to reconnect elsewhere, and in-flight requests are finished.
+// SIGHUP or SIGUSR2 hands off listener to a new process before shutting down.
+func (s *GracefulServer) Register(lc *lifecycle.Manager) {
+	lc.Append(lifecycle.Hook{
+		Name:     "readiness",
+		Priority: lifecycle.PriorityReadiness,
+		// started last, when everything else is up
+		Start: func(context.Context) error {
+			return notifyParentReady()
+		},
+		Stop: func(context.Context) error {
+			s.markUnready()
+			return nil
+		},
+	})
+	lc.Append(lifecycle.Hook{
+		Name:     "API server",
+		Priority: lifecycle.PriorityServer,
+		Start: func(context.Context) (err error) {
+			err = s.Listen()
+			if err != nil {
+				return
+			}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGTERM, syscall.SIGINT)
+			lc.Go("API server", s.Serve)
+			go s.watchRestart(lc)
+			return
+		},
+		Stop: s.Shutdown,
+	})
+}
 
-	received := <-quit
-	s.logger.Info("received signal, exiting...",
-		zap.String("signal", received.String()),
-		zap.String("addr", s.server.Addr),
-	)
+// Listen takes listener handed off by parent or passed by systemd if any, otherwise binds one,
+// so that errors like port in use are found before serving.
+func (s *GracefulServer) Listen() (err error) {
+	s.listener, err = inheritedListener()
+	if err != nil {
+		err = fmt.Errorf("inheriting listener: %w", err)
+		return
+	}
+	if s.listener != nil {
+		s.logger.Info("serving on inherited listener", zap.String("addr", s.listener.Addr().String()))
+		return
+	}
+
+	s.listener, err = listen(s.config, s.server.Addr)
+	return
+}
+
+// Serve serves on listener until Shutdown, err is nil if it's shut down.
+func (s *GracefulServer) Serve() (err error) {
+	if s.certs != nil {
+		go s.certs.watch(s.stopped)
+		// certificate comes from TLSConfig
+		err = s.server.ServeTLS(s.listener, "", "")
+	} else {
+		err = s.server.Serve(s.listener)
+	}
+	// Serve always returns a non-nil error.
+	// After Shutdown or Close, the returned error is ErrServerClosed.
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+		return
+	}
 
-	defer close(s.closed)
+	err = fmt.Errorf("server stopped unexpectedly: %w", err)
+	return
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), gracefulStopTimeout)
-	defer cancel()
+// Shutdown ends streams, then waits for in-flight requests until ctx is done.
+func (s *GracefulServer) Shutdown(ctx context.Context) (err error) {
+	close(s.stopped)
+	s.endStreams()
 
-	err := s.server.Shutdown(ctx)
+	err = s.server.Shutdown(ctx)
 	if err != nil {
 		err = fmt.Errorf("server.Shutdown: %w", err)
-		s.logger.Error("graceful shutdown failed.",
-			zap.Error(err),
-			zap.String("addr", s.server.Addr),
-		)
 		return
 	}
 
 	s.logger.Info("API service exited successfully.",
 		zap.String("addr", s.server.Addr),
 	)
+	return
 }
 
-func (s *GracefulServer) ListenAndServe() (err error) {
-	err = s.server.ListenAndServe()
-	if err != http.ErrServerClosed {
-		err = fmt.Errorf("server stopped unexpectedly: %w", err)
-		return
-	}
+// newServer returns a server with graceful shutdown,
+// markUnready and endStreams are called on shutting down.
+func newServer(opt ServerOpt, handler http.Handler, markUnready, endStreams func()) (server *GracefulServer, err error) {
+	config := opt.Server.withDefaults()
+	httpServer := newHTTPServer(config, fmt.Sprintf(":%d", opt.Port), handler)
 
-	// ListenAndServe always returns a non-nil error.
-	// After Shutdown or Close, the returned error is ErrServerClosed.
-	err = nil
-
-	<-s.closed
-
-	return
-}
+	var certs *certReloader
+	if config.TLS.enabled() {
+		certs, err = newCertReloader(config.TLS, opt.Logger)
+		if err != nil {
+			err = fmt.Errorf("newCertReloader: %w", err)
+			return
+		}
+		httpServer.TLSConfig, err = certs.tlsConfig()
+		if err != nil {
+			err = fmt.Errorf("building TLS config: %w", err)
+			return
+		}
+	}
 
-// newServer returns a server with graceful shutdown
-func newServer(opt ServerOpt, handler http.Handler) (server *GracefulServer) {
 	server = &GracefulServer{
-		server: &http.Server{
-			Addr:    fmt.Sprintf(":%d", opt.Port),
-			Handler: handler,
-		},
-		logger: opt.Logger,
-		closed: make(chan struct{}),
+		server:      httpServer,
+		config:      config,
+		certs:       certs,
+		logger:      opt.Logger,
+		stopped:     make(chan struct{}),
+		markUnready: markUnready,
+		endStreams:  endStreams,
 	}
 
-	go server.watchSignal()
-
 	return
 }
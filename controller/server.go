@@ -0,0 +1,333 @@
+package controller
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+const (
+	defaultReadHeaderTimeout = 10
+	defaultIdleTimeout       = 120
+	defaultTLSReloadInterval = 60
+)
+
+// client certificate verification modes
+const (
+	ClientAuthRequire       = "require"
+	ClientAuthVerifyIfGiven = "verify-if-given"
+)
+
+// ServerConfig config on HTTP server
+type ServerConfig struct {
+	// ReadHeaderTimeoutSeconds bounds reading request headers, defaults to 10 seconds
+	ReadHeaderTimeoutSeconds int
+	// ReadTimeoutSeconds bounds reading the whole request including body, 0 means no limit
+	ReadTimeoutSeconds int
+	// WriteTimeoutSeconds bounds writing response, 0 means no limit.
+	// Keep it 0 if SSE or WebSocket is in use, since streams last longer.
+	WriteTimeoutSeconds int
+	// IdleTimeoutSeconds keep-alive connections are closed after being idle for this long, defaults to 120 seconds
+	IdleTimeoutSeconds int
+	// MaxHeaderBytes of request headers, 0 means 1 MiB
+	MaxHeaderBytes int
+	// UnixSocket is the path of Unix socket to listen on instead of TCP port.
+	// A stale socket at the path is removed, while any other file there fails starting.
+	UnixSocket string
+	// H2C serves HTTP/2 without TLS, for internal traffic from trusted proxies,
+	// it's ignored when TLS is on, which negotiates HTTP/2 anyway.
+	H2C bool
+	// RestartReadyTimeoutSeconds on SIGHUP or SIGUSR2, the listener is handed off to a new process,
+	// which must be ready in this long, defaults to 30 seconds.
+	RestartReadyTimeoutSeconds int
+	TLS                        TLSConfig
+}
+
+// TLSConfig config on TLS, which is on when both CertFile and KeyFile are set
+type TLSConfig struct {
+	// CertFile and KeyFile are PEM files, which are reloaded on change without restarting
+	CertFile string
+	KeyFile  string
+	// ReloadIntervalSeconds files are checked for change this often, defaults to 60 seconds
+	ReloadIntervalSeconds int
+	// ClientCAFile is a PEM file of CAs to verify client certificates, which turns on mutual TLS
+	ClientCAFile string
+	// ClientAuth is "require"(default) or "verify-if-given" when ClientCAFile is set
+	ClientAuth string
+	// MinVersion is "1.2"(default) or "1.3"
+	MinVersion string
+}
+
+func (s ServerConfig) withDefaults() ServerConfig {
+	if s.ReadHeaderTimeoutSeconds <= 0 {
+		s.ReadHeaderTimeoutSeconds = defaultReadHeaderTimeout
+	}
+	if s.IdleTimeoutSeconds <= 0 {
+		s.IdleTimeoutSeconds = defaultIdleTimeout
+	}
+	if s.RestartReadyTimeoutSeconds <= 0 {
+		s.RestartReadyTimeoutSeconds = defaultRestartReadyTimeout
+	}
+	if s.TLS.ReloadIntervalSeconds <= 0 {
+		s.TLS.ReloadIntervalSeconds = defaultTLSReloadInterval
+	}
+
+	return s
+}
+
+func (s ServerConfig) restartReadyTimeout() time.Duration {
+	return time.Duration(s.RestartReadyTimeoutSeconds) * time.Second
+}
+
+func (t TLSConfig) enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// newHTTPServer applies config on an http.Server
+func newHTTPServer(config ServerConfig, addr string, handler http.Handler) (server *http.Server) {
+	idleTimeout := time.Duration(config.IdleTimeoutSeconds) * time.Second
+	if config.H2C && !config.TLS.enabled() {
+		handler = h2c.NewHandler(handler, &http2.Server{
+			IdleTimeout: idleTimeout,
+		})
+	}
+
+	server = &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(config.ReadHeaderTimeoutSeconds) * time.Second,
+		ReadTimeout:       time.Duration(config.ReadTimeoutSeconds) * time.Second,
+		WriteTimeout:      time.Duration(config.WriteTimeoutSeconds) * time.Second,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+
+	return
+}
+
+// listen on Unix socket if configured, otherwise on TCP addr
+func listen(config ServerConfig, addr string) (listener net.Listener, err error) {
+	if config.UnixSocket == "" {
+		listener, err = net.Listen("tcp", addr)
+		if err != nil {
+			err = fmt.Errorf("listening on %s: %w", addr, err)
+			return
+		}
+
+		return
+	}
+
+	// socket file left by a crashed process refuses binding,
+	// while anything else at the path is never ours to remove.
+	info, err := os.Lstat(config.UnixSocket)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+	case err != nil:
+		err = fmt.Errorf("checking Unix socket path: %w", err)
+		return
+	case info.Mode()&os.ModeSocket == 0:
+		err = fmt.Errorf("%s exists and is not a Unix socket, refusing to remove it", config.UnixSocket)
+		return
+	default:
+		err = os.Remove(config.UnixSocket)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			err = fmt.Errorf("removing stale Unix socket: %w", err)
+			return
+		}
+	}
+
+	listener, err = net.Listen("unix", config.UnixSocket)
+	if err != nil {
+		err = fmt.Errorf("listening on %s: %w", config.UnixSocket, err)
+		return
+	}
+
+	return
+}
+
+// certReloader serves certificate and client CAs from files,
+// reloading them when files change.
+type certReloader struct {
+	config TLSConfig
+	logger *zap.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	// stamp of files loaded, to tell changes
+	stamp string
+}
+
+// newCertReloader loads files, which must be valid at start.
+func newCertReloader(config TLSConfig, logger *zap.Logger) (reloader *certReloader, err error) {
+	reloader = &certReloader{
+		config: config,
+		logger: logger,
+	}
+
+	stamp, err := reloader.filesStamp()
+	if err != nil {
+		reloader = nil
+		return
+	}
+	err = reloader.load(stamp)
+	if err != nil {
+		reloader = nil
+		return
+	}
+
+	return
+}
+
+// filesStamp changes when any of the files changes
+func (r *certReloader) filesStamp() (stamp string, err error) {
+	var b strings.Builder
+	for _, name := range []string{r.config.CertFile, r.config.KeyFile, r.config.ClientCAFile} {
+		if name == "" {
+			continue
+		}
+
+		// following symbolic links, which are swapped by certificate renewing tools
+		var info os.FileInfo
+		info, err = os.Stat(name)
+		if err != nil {
+			err = fmt.Errorf("stat: %w", err)
+			return
+		}
+		_, _ = fmt.Fprintf(&b, "%s:%d:%d;", name, info.ModTime().UnixNano(), info.Size())
+	}
+
+	stamp = b.String()
+	return
+}
+
+func (r *certReloader) load(stamp string) (err error) {
+	cert, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		err = fmt.Errorf("loading certificate: %w", err)
+		return
+	}
+
+	var clientCAs *x509.CertPool
+	if r.config.ClientCAFile != "" {
+		var pem []byte
+		pem, err = os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			err = fmt.Errorf("reading client CA file: %w", err)
+			return
+		}
+
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			err = fmt.Errorf("no certificate found in client CA file %s", r.config.ClientCAFile)
+			return
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.stamp = stamp
+	return
+}
+
+// reloadIfChanged keeps serving old ones if new files are broken,
+// which may be in the middle of being written.
+func (r *certReloader) reloadIfChanged() {
+	stamp, err := r.filesStamp()
+	if err == nil {
+		r.mu.RLock()
+		unchanged := stamp == r.stamp
+		r.mu.RUnlock()
+		if unchanged {
+			return
+		}
+
+		err = r.load(stamp)
+	}
+	if err != nil {
+		r.logger.Error("reloading TLS files failed, keep serving loaded ones", zap.Error(err))
+		return
+	}
+
+	r.logger.Info("TLS files reloaded", zap.String("certFile", r.config.CertFile))
+}
+
+// watch reloads files on change until done is closed
+func (r *certReloader) watch(done <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(r.config.ReloadIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			r.reloadIfChanged()
+		}
+	}
+}
+
+// tlsConfig picks up reloaded files on each handshake
+func (r *certReloader) tlsConfig() (config *tls.Config, err error) {
+	config = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// HTTP/2 is negotiated by ALPN
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+
+	switch r.config.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		config.MinVersion = tls.VersionTLS13
+	default:
+		err = fmt.Errorf("unsupported TLS MinVersion %q", r.config.MinVersion)
+		return
+	}
+
+	if r.config.ClientCAFile != "" {
+		switch r.config.ClientAuth {
+		case "", ClientAuthRequire:
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		case ClientAuthVerifyIfGiven:
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+		default:
+			err = fmt.Errorf("unsupported ClientAuth %q", r.config.ClientAuth)
+			return
+		}
+	}
+
+	config.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		return r.cert, nil
+	}
+
+	base := config.Clone()
+	config.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		current := base.Clone()
+		current.Certificates = []tls.Certificate{*r.cert}
+		current.ClientCAs = r.clientCAs
+		return current, nil
+	}
+
+	return
+}
@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+// issue returns PEM of certificate and key for commonName
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return
+}
+
+func writeFile(t *testing.T, name string, content []byte) {
+	require.NoError(t, os.WriteFile(name, content, 0o600))
+}
+
+func Test_certReloader_reloadIfChanged(t *testing.T) {
+	dir := t.TempDir()
+	config := TLSConfig{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+	ca := newTestCA(t)
+
+	certPEM, keyPEM := ca.issue(t, "first", x509.ExtKeyUsageServerAuth)
+	writeFile(t, config.CertFile, certPEM)
+	writeFile(t, config.KeyFile, keyPEM)
+
+	reloader, err := newCertReloader(config, zap.NewNop())
+	require.NoError(t, err)
+	tlsConfig, err := reloader.tlsConfig()
+	require.NoError(t, err)
+
+	servedName := func() string {
+		cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{})
+		require.NoError(t, err)
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		require.NoError(t, err)
+		return leaf.Subject.CommonName
+	}
+	assert.Equal(t, "first", servedName())
+
+	// unchanged files are not reloaded
+	reloader.reloadIfChanged()
+	assert.Equal(t, "first", servedName())
+
+	certPEM, keyPEM = ca.issue(t, "second", x509.ExtKeyUsageServerAuth)
+	writeFile(t, config.CertFile, certPEM)
+	writeFile(t, config.KeyFile, keyPEM)
+	reloader.reloadIfChanged()
+	assert.Equal(t, "second", servedName())
+
+	// broken files keep the loaded one serving
+	writeFile(t, config.CertFile, []byte("renewing..."))
+	reloader.reloadIfChanged()
+	assert.Equal(t, "second", servedName())
+}
+
+func Test_mutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	config := ServerConfig{
+		TLS: TLSConfig{
+			CertFile:     filepath.Join(dir, "cert.pem"),
+			KeyFile:      filepath.Join(dir, "key.pem"),
+			ClientCAFile: filepath.Join(dir, "ca.pem"),
+		},
+	}.withDefaults()
+	certPEM, keyPEM := ca.issue(t, "127.0.0.1", x509.ExtKeyUsageServerAuth)
+	writeFile(t, config.TLS.CertFile, certPEM)
+	writeFile(t, config.TLS.KeyFile, keyPEM)
+	writeFile(t, config.TLS.ClientCAFile, ca.pem)
+
+	reloader, err := newCertReloader(config.TLS, zap.NewNop())
+	require.NoError(t, err)
+	server := newHTTPServer(config, "127.0.0.1:0", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	server.TLSConfig, err = reloader.tlsConfig()
+	require.NoError(t, err)
+
+	listener, err := listen(config, server.Addr)
+	require.NoError(t, err)
+	go func() {
+		_ = server.ServeTLS(listener, "", "")
+	}()
+	defer server.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(ca.cert)
+	clientCertPEM, clientKeyPEM := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	clientCert, err := tls.X509KeyPair(clientCertPEM, clientKeyPEM)
+	require.NoError(t, err)
+
+	tests := []struct {
+		testName     string
+		certificates []tls.Certificate
+		wantErr      bool
+	}{
+		{testName: "with client certificate", certificates: []tls.Certificate{clientCert}},
+		{testName: "without client certificate", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			client := &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{
+						RootCAs:      rootCAs,
+						Certificates: tt.certificates,
+					},
+					ForceAttemptHTTP2: true,
+				},
+			}
+			defer client.CloseIdleConnections()
+
+			resp, err := client.Get("https://" + listener.Addr().String())
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			assert.Equal(t, "client", string(body))
+			assert.Equal(t, 2, resp.ProtoMajor)
+		})
+	}
+}
+
+func Test_listen_unixSocket(t *testing.T) {
+	config := ServerConfig{
+		UnixSocket: filepath.Join(t.TempDir(), "telescope.sock"),
+	}.withDefaults()
+	// left by a crashed process
+	stale, err := net.Listen("unix", config.UnixSocket)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	listener, err := listen(config, "")
+	require.NoError(t, err)
+	server := newHTTPServer(config, "", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var dialer net.Dialer
+				return dialer.DialContext(ctx, "unix", config.UnixSocket)
+			},
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("http://telescope/")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(body))
+}
+
+func Test_listen_notUnixSocket(t *testing.T) {
+	config := ServerConfig{
+		UnixSocket: filepath.Join(t.TempDir(), "telescope.sock"),
+	}.withDefaults()
+	writeFile(t, config.UnixSocket, []byte("not a socket"))
+
+	_, err := listen(config, "")
+	assert.Error(t, err)
+
+	// never removed
+	content, err := os.ReadFile(config.UnixSocket)
+	require.NoError(t, err)
+	assert.Equal(t, "not a socket", string(content))
+}
@@ -0,0 +1,379 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"telescope/cache"
+	"telescope/database"
+	"telescope/errorcode"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	ctxSessionKey          = "session"
+	ctxCSRFRejectedKey     = "csrfRejected"
+	csrfTokenHeader        = "X-CSRF-Token"
+	sessionIDLength        = 44
+	csrfTokenLength        = 32
+	defaultSessionCookie   = "telescope_session"
+	defaultSessionIdle     = 30 * 60
+	defaultSessionAbsolute = 12 * 60 * 60
+)
+
+// PrincipalKindSession principal authenticated by cookie session
+const PrincipalKindSession = "session"
+
+// dummyPasswordHash is compared against when user does not exist,
+// so that response time does not tell whether a username exists.
+const dummyPasswordHash = "$2a$10$jnck7tWDvUQ/RFnadna8C.MZ7I60ppQUN5XJ1mHvdIiD4a7KaW3Ey"
+
+// SessionConfig config on cookie session
+type SessionConfig struct {
+	// CookieName defaults to "telescope_session"
+	CookieName string
+	// Domain of cookie, empty means current host only
+	Domain string
+	// Path of cookie, defaults to "/"
+	Path string
+	// Secure cookie is only sent over HTTPS, turn it on in production
+	Secure bool
+	// ScriptAccessible disables HttpOnly so that JavaScript can read the cookie,
+	// keep it false unless you know what you are doing.
+	ScriptAccessible bool
+	// SameSite is one of "Lax"(default), "Strict" and "None"
+	SameSite string
+	// IdleTimeoutSeconds sessions expire after being idle for this long, defaults to 30 minutes
+	IdleTimeoutSeconds int
+	// AbsoluteTimeoutSeconds sessions expire after this long anyway, defaults to 12 hours
+	AbsoluteTimeoutSeconds int
+}
+
+func (s SessionConfig) withDefaults() SessionConfig {
+	if s.CookieName == "" {
+		s.CookieName = defaultSessionCookie
+	}
+	if s.Path == "" {
+		s.Path = "/"
+	}
+	if s.IdleTimeoutSeconds <= 0 {
+		s.IdleTimeoutSeconds = defaultSessionIdle
+	}
+	if s.AbsoluteTimeoutSeconds <= 0 {
+		s.AbsoluteTimeoutSeconds = defaultSessionAbsolute
+	}
+
+	return s
+}
+
+func (s SessionConfig) idleTimeout() time.Duration {
+	return time.Duration(s.IdleTimeoutSeconds) * time.Second
+}
+
+func (s SessionConfig) absoluteTimeout() time.Duration {
+	return time.Duration(s.AbsoluteTimeoutSeconds) * time.Second
+}
+
+func (s SessionConfig) sameSite() http.SameSite {
+	switch strings.ToLower(s.SameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// SessionMiddleware loads session by cookie and attaches it to gin.Context.
+//
+// When there's no principal yet, the session's user becomes the principal,
+// except that unsafe requests must present the CSRF token of the session.
+func (con *Controller) SessionMiddleware(c *gin.Context) {
+	sessionID, err := c.Cookie(con.Session.CookieName)
+	if err != nil || sessionID == "" {
+		c.Next()
+		return
+	}
+
+	session, err := con.Cache.ReadSession(c.Request.Context(), sessionID, con.Session.idleTimeout())
+	if errors.Is(err, cache.ErrSessionNotFound) {
+		con.clearSessionCookie(c)
+		c.Next()
+		return
+	}
+	if err != nil {
+		// degrade to anonymous
+		con.loggerOf(c).Error("reading session",
+			zap.String("path", c.Request.URL.Path),
+			zap.Error(err),
+		)
+		c.Next()
+		return
+	}
+
+	if time.Since(session.CreatedAt) > con.Session.absoluteTimeout() {
+		err = con.Cache.DeleteSession(c.Request.Context(), session)
+		if err != nil {
+			con.loggerOf(c).Error("deleting expired session", zap.Error(err))
+		}
+		con.clearSessionCookie(c)
+		c.Next()
+		return
+	}
+
+	c.Set(ctxSessionKey, session)
+
+	if _, ok := principalOf(c); ok || session.UserID == "" {
+		c.Next()
+		return
+	}
+
+	if !isSafeMethod(c.Request.Method) && !csrfTokenMatches(c.GetHeader(csrfTokenHeader), session.CSRFToken) {
+		c.Set(ctxCSRFRejectedKey, true)
+		c.Next()
+		return
+	}
+
+	c.Set(ctxPrincipalKey, &Principal{
+		ID:    session.UserID,
+		Kind:  PrincipalKindSession,
+		Roles: session.Roles,
+	})
+
+	c.Next()
+}
+
+// sessionOf returns the session attached by SessionMiddleware
+func sessionOf(c *gin.Context) (session *cache.Session, ok bool) {
+	value, ok := c.Get(ctxSessionKey)
+	if !ok {
+		return
+	}
+
+	session, ok = value.(*cache.Session)
+	return
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+func csrfTokenMatches(got, want string) bool {
+	if got == "" || want == "" {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+type loginRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type sessionResponse struct {
+	UserID    string   `json:"userID"`
+	Roles     []string `json:"roles"`
+	CSRFToken string   `json:"csrfToken"`
+}
+
+func newSessionResponse(session *cache.Session) sessionResponse {
+	return sessionResponse{
+		UserID:    session.UserID,
+		Roles:     session.Roles,
+		CSRFToken: session.CSRFToken,
+	}
+}
+
+// Login verifies username and password and starts a new session
+func (con *Controller) Login(c *gin.Context) {
+	var req loginRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	user, err := con.DB.UserByUsername(c.Request.Context(), req.Username)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("UserByUsername: %w", err))
+		return
+	}
+	if !passwordMatches(user, req.Password) {
+		_ = c.Error(errorcode.ErrUnauthorized)
+		return
+	}
+
+	// never reuse a session across login, which defeats session fixation
+	if previous, found := sessionOf(c); found {
+		err = con.Cache.DeleteSession(c.Request.Context(), previous)
+		if err != nil {
+			_ = c.Error(fmt.Errorf("deleting previous session: %w", err))
+			return
+		}
+	}
+
+	session := &cache.Session{
+		UserID:    strconv.FormatInt(user.ID, 10),
+		Roles:     user.Roles,
+		CreatedAt: time.Now(),
+	}
+	err = con.issueSession(c, session)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("issueSession: %w", err))
+		return
+	}
+
+	ok(c, newSessionResponse(session))
+}
+
+// passwordMatches user may be nil
+func passwordMatches(user *database.User, password string) bool {
+	if user == nil || !user.DisabledAt.IsZero() {
+		// spend the same time as a real comparison
+		_ = bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		return false
+	}
+
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil
+}
+
+// CurrentSession returns the current session along with its CSRF token
+func (con *Controller) CurrentSession(c *gin.Context) {
+	session, found := sessionOf(c)
+	if !found {
+		_ = c.Error(errorcode.ErrUnauthorized)
+		return
+	}
+
+	ok(c, newSessionResponse(session))
+}
+
+// Logout ends the current session
+func (con *Controller) Logout(c *gin.Context) {
+	session, found := sessionOf(c)
+	if !found {
+		_ = c.Error(errorcode.ErrUnauthorized)
+		return
+	}
+
+	err := con.Cache.DeleteSession(c.Request.Context(), session)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("DeleteSession: %w", err))
+		return
+	}
+	con.clearSessionCookie(c)
+
+	ok(c, nil)
+}
+
+// LogoutEverywhere ends all sessions of the current user
+func (con *Controller) LogoutEverywhere(c *gin.Context) {
+	session, found := sessionOf(c)
+	if !found {
+		_ = c.Error(errorcode.ErrUnauthorized)
+		return
+	}
+
+	err := con.Cache.DeleteUserSessions(c.Request.Context(), session.UserID)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("DeleteUserSessions: %w", err))
+		return
+	}
+	con.clearSessionCookie(c)
+
+	ok(c, nil)
+}
+
+// issueSession assigns fresh session ID and CSRF token to session,
+// saves it and sets the cookie.
+func (con *Controller) issueSession(c *gin.Context, session *cache.Session) (err error) {
+	session.ID, err = secureToken(sessionIDLength)
+	if err != nil {
+		err = fmt.Errorf("generating session ID: %w", err)
+		return
+	}
+	session.CSRFToken, err = secureToken(csrfTokenLength)
+	if err != nil {
+		err = fmt.Errorf("generating CSRF token: %w", err)
+		return
+	}
+
+	err = con.Cache.SaveSession(c.Request.Context(), session, con.Session.idleTimeout())
+	if err != nil {
+		err = fmt.Errorf("SaveSession: %w", err)
+		return
+	}
+
+	con.setSessionCookie(c, session.ID)
+	return
+}
+
+// rotateSession moves the current session to a new ID and CSRF token,
+// call it whenever privilege of the session changes, e.g. roles are updated.
+func (con *Controller) rotateSession(c *gin.Context, roles []string) (err error) {
+	session, found := sessionOf(c)
+	if !found {
+		err = errors.New("no session to rotate")
+		return
+	}
+
+	newID, err := secureToken(sessionIDLength)
+	if err != nil {
+		err = fmt.Errorf("generating session ID: %w", err)
+		return
+	}
+	session.CSRFToken, err = secureToken(csrfTokenLength)
+	if err != nil {
+		err = fmt.Errorf("generating CSRF token: %w", err)
+		return
+	}
+	session.Roles = roles
+
+	err = con.Cache.RotateSession(c.Request.Context(), session, newID, con.Session.idleTimeout())
+	if err != nil {
+		err = fmt.Errorf("RotateSession: %w", err)
+		return
+	}
+
+	con.setSessionCookie(c, session.ID)
+	return
+}
+
+func (con *Controller) setSessionCookie(c *gin.Context, sessionID string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     con.Session.CookieName,
+		Value:    sessionID,
+		Path:     con.Session.Path,
+		Domain:   con.Session.Domain,
+		Secure:   con.Session.Secure,
+		HttpOnly: !con.Session.ScriptAccessible,
+		SameSite: con.Session.sameSite(),
+	})
+}
+
+func (con *Controller) clearSessionCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     con.Session.CookieName,
+		Value:    "",
+		Path:     con.Session.Path,
+		Domain:   con.Session.Domain,
+		MaxAge:   -1,
+		Secure:   con.Session.Secure,
+		HttpOnly: !con.Session.ScriptAccessible,
+		SameSite: con.Session.sameSite(),
+	})
+}
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"telescope/cache"
+	"telescope/database"
+	"testing"
+	"time"
+
+	"github.com/ory/dockertest/v3"
+	"github.com/ory/dockertest/v3/docker"
+)
+
+// Redis and Postgres are started on demand by tests needing them, and purged after all tests.
+// TEST_REDIS_HOST and TEST_DB_HOST point to existing ones instead of docker.
+var (
+	dockerOnce sync.Once
+	dockerPool *dockertest.Pool
+	dockerErr  error
+
+	containersMu sync.Mutex
+	containers   []*dockertest.Resource
+
+	redisOnce  sync.Once
+	redisCache *cache.Cache
+	redisErr   error
+
+	postgresOnce sync.Once
+	postgresDB   *database.DB
+	postgresErr  error
+)
+
+func TestMain(m *testing.M) { // nolint: staticcheck
+	defer func() {
+		containersMu.Lock()
+		defer containersMu.Unlock()
+
+		for _, container := range containers {
+			if purgeErr := dockerPool.Purge(container); purgeErr != nil {
+				log.Printf("[resource leaked] could not purge %s: %s", container.Container.Name, purgeErr)
+			}
+		}
+	}()
+
+	// m.Run will return an exit code that may be passed to os.Exit.
+	// If TestMain returns, the test wrapper will pass the result of m.Run to os.Exit itself.
+	m.Run()
+}
+
+// runContainer starts a container which expires in 2 minutes anyway
+func runContainer(options *dockertest.RunOptions) (resource *dockertest.Resource, err error) {
+	dockerOnce.Do(func() {
+		// uses a sensible default on windows (tcp/http) and linux/osx (socket)
+		dockerPool, dockerErr = dockertest.NewPool("")
+		if dockerErr == nil {
+			dockerErr = dockerPool.Client.Ping()
+		}
+	})
+	if dockerErr != nil {
+		err = fmt.Errorf("could not connect to docker: %w", dockerErr)
+		return
+	}
+
+	resource, err = dockerPool.RunWithOptions(options, func(config *docker.HostConfig) {
+		config.AutoRemove = true
+		config.RestartPolicy = docker.RestartPolicy{
+			Name: "no",
+		}
+	})
+	if err != nil {
+		err = fmt.Errorf("could not start %s: %w", options.Repository, err)
+		return
+	}
+
+	containersMu.Lock()
+	containers = append(containers, resource)
+	containersMu.Unlock()
+
+	err = resource.Expire(2 * 60)
+	if err != nil {
+		err = fmt.Errorf("[resource leaking] failed to set container expire: %w", err)
+		return
+	}
+
+	return
+}
+
+// testCache connects to Redis, the test is skipped if there's none.
+func testCache(t *testing.T) *cache.Cache {
+	redisOnce.Do(func() {
+		redisCache, redisErr = connectRedis()
+	})
+	if redisErr != nil {
+		t.Skipf("Redis is unavailable: %s", redisErr)
+	}
+
+	return redisCache
+}
+
+func connectRedis() (red *cache.Cache, err error) {
+	redisHost := os.Getenv("TEST_REDIS_HOST")
+	if redisHost != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		red, err = cache.NewRedisClient(ctx, cache.RedisConfig{
+			Addr: fmt.Sprintf("%s:6379", redisHost),
+		})
+		if err != nil {
+			err = fmt.Errorf("connecting existing Redis at %q: %w", redisHost, err)
+			return
+		}
+
+		return
+	}
+
+	redis, err := runContainer(&dockertest.RunOptions{
+		Repository: "redis",
+		Tag:        "6",
+	})
+	if err != nil {
+		return
+	}
+
+	// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
+	err = dockerPool.Retry(func() (pingErr error) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		red, pingErr = cache.NewRedisClient(ctx, cache.RedisConfig{
+			Addr: fmt.Sprintf(":%s", redis.GetPort("6379/tcp")),
+		})
+		return
+	})
+	if err != nil {
+		err = fmt.Errorf("could not connect to Redis in docker: %w", err)
+		return
+	}
+
+	return
+}
+
+// testDB connects to Postgres with tables created, the test is skipped if there's none.
+func testDB(t *testing.T) *database.DB {
+	postgresOnce.Do(func() {
+		postgresDB, postgresErr = connectPostgres()
+	})
+	if postgresErr != nil {
+		t.Skipf("Postgres is unavailable: %s", postgresErr)
+	}
+
+	return postgresDB
+}
+
+func connectPostgres() (db *database.DB, err error) {
+	config := database.PostgresConfig{
+		User:         "telescope",
+		Password:     "telescope",
+		DatabaseName: "telescope",
+	}
+
+	postgresHost := os.Getenv("TEST_DB_HOST")
+	if postgresHost != "" {
+		config.Host = fmt.Sprintf("%s:5432", postgresHost)
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		db, err = database.NewPostgres(ctx, config)
+		if err != nil {
+			err = fmt.Errorf("connecting existing DB at %q: %w", postgresHost, err)
+			return
+		}
+	} else {
+		var postgres *dockertest.Resource
+		postgres, err = runContainer(&dockertest.RunOptions{
+			Repository: "postgres",
+			Tag:        "11",
+			Env: []string{
+				"POSTGRES_USER=telescope",
+				"POSTGRES_PASSWORD=telescope",
+				"listen_addresses = '*'",
+			},
+		})
+		if err != nil {
+			return
+		}
+
+		config.Host = fmt.Sprintf(":%s", postgres.GetPort("5432/tcp"))
+		// exponential backoff-retry, because the application in the container might not be ready to accept connections yet
+		err = dockerPool.Retry(func() (pingErr error) {
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			db, pingErr = database.NewPostgres(ctx, config)
+			return
+		})
+		if err != nil {
+			err = fmt.Errorf("could not connect to Postgres in docker: %w", err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err = db.RunInTransaction(ctx, func(tx database.Operator) error {
+		return tx.CreateTables(ctx)
+	})
+	if err != nil {
+		err = fmt.Errorf("creating tables: %w", err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"telescope/errorcode"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultSSEHeartbeat        = 15
+	defaultSSEClientBufferSize = 64
+	defaultSSEReplaySize       = 256
+	sseContentType             = "text/event-stream"
+	// sseRetryMilliseconds tells clients how long to wait before reconnecting
+	sseRetryMilliseconds = 3000
+)
+
+// SSEConfig config on server-sent events
+type SSEConfig struct {
+	// Topics clients may subscribe to, none means the endpoint is off
+	Topics []SSETopic
+	// HeartbeatSeconds comments are sent this often to keep connections alive, defaults to 15 seconds
+	HeartbeatSeconds int
+	// ClientBufferSize events are buffered for each client,
+	// clients falling further behind are disconnected, defaults to 64.
+	ClientBufferSize int
+	// ReplaySize recent events are kept for resuming by Last-Event-ID, defaults to 256
+	ReplaySize int
+}
+
+// SSETopic is a Postgres channel exposed to clients
+type SSETopic struct {
+	// Name of Postgres channel
+	Name string
+	// Permission required to subscribe, empty means any authenticated caller
+	Permission string
+}
+
+func (s SSEConfig) withDefaults() SSEConfig {
+	if s.HeartbeatSeconds <= 0 {
+		s.HeartbeatSeconds = defaultSSEHeartbeat
+	}
+	if s.ClientBufferSize <= 0 {
+		s.ClientBufferSize = defaultSSEClientBufferSize
+	}
+	if s.ReplaySize <= 0 {
+		s.ReplaySize = defaultSSEReplaySize
+	}
+
+	return s
+}
+
+func (s SSEConfig) heartbeat() time.Duration {
+	return time.Duration(s.HeartbeatSeconds) * time.Second
+}
+
+// topicNames are the Postgres channels to LISTEN
+func (s SSEConfig) topicNames() (names []string) {
+	for _, topic := range s.Topics {
+		names = append(names, topic.Name)
+	}
+
+	return
+}
+
+func (s SSEConfig) topic(name string) (topic SSETopic, found bool) {
+	for _, topic = range s.Topics {
+		if topic.Name == name {
+			found = true
+			return
+		}
+	}
+
+	return
+}
+
+type eventsQuery struct {
+	Topics []string `form:"topic" binding:"required,min=1,dive,required" description:"topics to subscribe, repeat for more"`
+}
+
+// Events streams notifications of topics as server-sent events,
+// event name is the topic while data is the notification payload.
+//
+// Reconnecting clients resume by Last-Event-ID,
+// they get a "resync" event if some events are gone in between.
+func (con *Controller) Events(c *gin.Context) {
+	var query eventsQuery
+	err := c.ShouldBindQuery(&query)
+	if err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	for _, name := range query.Topics {
+		topic, found := con.SSE.topic(name)
+		if !found {
+			_ = c.Error(errorcode.ErrUnknownTopic.WithParams(map[string]string{"topic": name}))
+			return
+		}
+		if topic.Permission == "" {
+			continue
+		}
+
+		allowed, err := con.can(c, topic.Permission)
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		if !allowed {
+			_ = c.Error(errorcode.ErrForbidden)
+			return
+		}
+	}
+
+	client, replay, resumed, err := con.SSEHub.Subscribe(query.Topics, c.GetHeader("Last-Event-ID"))
+	if err != nil {
+		c.PureJSON(http.StatusServiceUnavailable, R{
+			Code: http.StatusServiceUnavailable,
+			Msg:  http.StatusText(http.StatusServiceUnavailable),
+		})
+		return
+	}
+	defer con.SSEHub.Unsubscribe(client)
+
+	header := c.Writer.Header()
+	header.Set("Content-Type", sseContentType)
+	header.Set("Cache-Control", "no-cache")
+	// tells nginx not to buffer
+	header.Set("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	_, err = fmt.Fprintf(c.Writer, "retry: %d\n\n", sseRetryMilliseconds)
+	if err != nil {
+		return
+	}
+	if !resumed {
+		_, err = io.WriteString(c.Writer, "event: resync\ndata: resync\n\n")
+		if err != nil {
+			return
+		}
+	}
+	for _, event := range replay {
+		err = writeSSEEvent(c.Writer, event)
+		if err != nil {
+			return
+		}
+	}
+	// flushing also tells buffering middlewares that it's a stream
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(con.SSE.heartbeat())
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-client.dropped:
+			return
+		case event := <-client.events:
+			err = writeSSEEvent(c.Writer, event)
+		case <-heartbeat.C:
+			_, err = io.WriteString(c.Writer, ": heartbeat\n\n")
+		}
+		if err != nil {
+			return
+		}
+
+		c.Writer.Flush()
+	}
+}
+
+// writeSSEEvent writes event in text/event-stream format
+func writeSSEEvent(w io.Writer, event *sseEvent) (err error) {
+	var b strings.Builder
+	b.WriteString("id: ")
+	b.WriteString(event.ID)
+	b.WriteString("\nevent: ")
+	b.WriteString(event.Topic)
+	b.WriteByte('\n')
+	for _, line := range strings.Split(strings.ReplaceAll(event.Data, "\r\n", "\n"), "\n") {
+		b.WriteString("data: ")
+		b.WriteString(line)
+		b.WriteByte('\n')
+	}
+	b.WriteByte('\n')
+
+	_, err = io.WriteString(w, b.String())
+	return
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.uber.org/zap"
+)
+
+// errSSEHubClosed hub is closed for shutting down
+var errSSEHubClosed = errors.New("SSE hub is closed")
+
+// sseEvent is a notification to be sent to clients
+type sseEvent struct {
+	// ID is made of hub epoch and seq, which clients send back in Last-Event-ID
+	ID    string
+	seq   uint64
+	Topic string
+	Data  string
+}
+
+// sseClient is a connected subscriber
+type sseClient struct {
+	topics map[string]bool
+	events chan *sseEvent
+	// dropped is closed once the client is removed from hub,
+	// either by unsubscribing, by falling behind, or by hub closing.
+	dropped chan struct{}
+}
+
+// SSEHub fans out Postgres notifications to SSE clients.
+//
+// Each client has a buffer, clients falling behind are disconnected
+// rather than slowing down others, they can resume from replay buffer by Last-Event-ID.
+type SSEHub struct {
+	logger           *zap.Logger
+	clientBufferSize int
+	replaySize       int
+	// epoch tells event IDs from previous processes, which can not be resumed
+	epoch string
+
+	mu      sync.Mutex
+	seq     uint64
+	replay  []*sseEvent
+	clients map[*sseClient]struct{}
+	closed  bool
+}
+
+// NewSSEHub creates a hub, feed it by passing Publish to database.DB.Watch
+func NewSSEHub(config SSEConfig, logger *zap.Logger) *SSEHub {
+	config = config.withDefaults()
+
+	return &SSEHub{
+		logger:           logger,
+		clientBufferSize: config.ClientBufferSize,
+		replaySize:       config.ReplaySize,
+		epoch:            strconv.FormatInt(time.Now().UnixNano(), 36),
+		replay:           make([]*sseEvent, 0, config.ReplaySize),
+		clients:          make(map[*sseClient]struct{}),
+	}
+}
+
+// Publish sends notification to clients subscribing its channel
+func (h *SSEHub) Publish(_ context.Context, notify pg.Notification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		return
+	}
+
+	h.seq++
+	event := &sseEvent{
+		ID:    h.epoch + "-" + strconv.FormatUint(h.seq, 10),
+		seq:   h.seq,
+		Topic: notify.Channel,
+		Data:  notify.Payload,
+	}
+
+	if len(h.replay) == h.replaySize {
+		copy(h.replay, h.replay[1:])
+		h.replay = h.replay[:len(h.replay)-1]
+	}
+	h.replay = append(h.replay, event)
+
+	for client := range h.clients {
+		if !client.topics[event.Topic] {
+			continue
+		}
+
+		select {
+		case client.events <- event:
+		default:
+			h.logger.Warn("SSE client falls behind, disconnecting",
+				zap.String("topic", event.Topic),
+				zap.Int("bufferSize", h.clientBufferSize),
+			)
+			h.drop(client)
+		}
+	}
+}
+
+// Subscribe registers a client on topics.
+//
+// When lastEventID is not empty, events after it are returned in replay,
+// resumed is false if they are no longer in replay buffer, so that the client must resync.
+func (h *SSEHub) Subscribe(topics []string, lastEventID string) (client *sseClient, replay []*sseEvent, resumed bool, err error) {
+	client = &sseClient{
+		topics:  make(map[string]bool, len(topics)),
+		events:  make(chan *sseEvent, h.clientBufferSize),
+		dropped: make(chan struct{}),
+	}
+	for _, topic := range topics {
+		client.topics[topic] = true
+	}
+
+	// replaying and registering in one critical section, so that no event is missed in between.
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		client = nil
+		err = errSSEHubClosed
+		return
+	}
+	h.clients[client] = struct{}{}
+
+	if lastEventID == "" {
+		resumed = true
+		return
+	}
+
+	lastSeq, ok := h.parseEventID(lastEventID)
+	if !ok {
+		return
+	}
+	if len(h.replay) > 0 && h.replay[0].seq > lastSeq+1 {
+		// some are gone
+		return
+	}
+
+	resumed = true
+	for _, event := range h.replay {
+		if event.seq > lastSeq && client.topics[event.Topic] {
+			replay = append(replay, event)
+		}
+	}
+
+	return
+}
+
+// parseEventID extracts seq from event ID of this hub
+func (h *SSEHub) parseEventID(id string) (seq uint64, ok bool) {
+	epoch, seqStr := id, ""
+	if dash := strings.LastIndexByte(id, '-'); dash >= 0 {
+		epoch, seqStr = id[:dash], id[dash+1:]
+	}
+	if epoch != h.epoch {
+		return
+	}
+
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if err != nil || seq > h.seq {
+		return
+	}
+
+	ok = true
+	return
+}
+
+// Unsubscribe removes client, it's fine if the client is already dropped.
+func (h *SSEHub) Unsubscribe(client *sseClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.drop(client)
+}
+
+// Close disconnects all clients and rejects new ones,
+// call it before shutting down the server, which otherwise waits for streams to end.
+func (h *SSEHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for client := range h.clients {
+		h.drop(client)
+	}
+}
+
+// drop must be called with mu held
+func (h *SSEHub) drop(client *sseClient) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+
+	delete(h.clients, client)
+	close(client.dropped)
+}
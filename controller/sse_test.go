@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/nanmu42/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestSSEHub(t *testing.T) {
+	hub := NewSSEHub(SSEConfig{ClientBufferSize: 2, ReplaySize: 3}, zap.NewNop())
+	publish := func(topic, payload string) {
+		hub.Publish(context.Background(), pg.Notification{Channel: topic, Payload: payload})
+	}
+
+	client, replay, resumed, err := hub.Subscribe([]string{"a"}, "")
+	require.NoError(t, err)
+	assert.Empty(t, replay)
+	assert.True(t, resumed)
+
+	publish("a", "1")
+	publish("b", "2")
+	publish("a", "3")
+	first := <-client.events
+	assert.Equal(t, "1", first.Data)
+	assert.Equal(t, "3", (<-client.events).Data)
+
+	t.Run("resume", func(t *testing.T) {
+		resuming, replay, resumed, err := hub.Subscribe([]string{"a"}, first.ID)
+		require.NoError(t, err)
+		defer hub.Unsubscribe(resuming)
+		assert.True(t, resumed)
+		require.Len(t, replay, 1)
+		assert.Equal(t, "3", replay[0].Data)
+	})
+
+	t.Run("events are gone", func(t *testing.T) {
+		publish("a", "4")
+		publish("a", "5")
+
+		resuming, replay, resumed, err := hub.Subscribe([]string{"a"}, first.ID)
+		require.NoError(t, err)
+		defer hub.Unsubscribe(resuming)
+		assert.False(t, resumed)
+		assert.Empty(t, replay)
+	})
+
+	t.Run("unknown ID", func(t *testing.T) {
+		resuming, _, resumed, err := hub.Subscribe([]string{"a"}, "previous-process-1")
+		require.NoError(t, err)
+		defer hub.Unsubscribe(resuming)
+		assert.False(t, resumed)
+	})
+
+	t.Run("slow client is dropped", func(t *testing.T) {
+		// "4" and "5" fill the buffer
+		publish("a", "6")
+		select {
+		case <-client.dropped:
+		default:
+			t.Fatal("slow client is not dropped")
+		}
+		// dropping twice is fine
+		hub.Unsubscribe(client)
+	})
+
+	t.Run("close", func(t *testing.T) {
+		other, _, _, err := hub.Subscribe([]string{"b"}, "")
+		require.NoError(t, err)
+
+		hub.Close()
+		<-other.dropped
+
+		_, _, _, err = hub.Subscribe([]string{"b"}, "")
+		assert.ErrorIs(t, err, errSSEHubClosed)
+	})
+}
+
+func TestController_Events(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	config := SSEConfig{
+		Topics:           []SSETopic{{Name: "announcement"}},
+		HeartbeatSeconds: 1,
+	}.withDefaults()
+	con := &Controller{
+		Logger:        zap.NewNop(),
+		AuditResponse: true,
+		SSE:           config,
+		SSEHub:        NewSSEHub(config, zap.NewNop()),
+	}
+	g := gin.New()
+	// middlewares buffering responses must let the stream through
+	g.Use(gzip.DefaultHandler().Gin, con.PayloadAuditLogMiddleware(), con.ErrorMiddleware, con.ConditionalMiddleware)
+	g.GET("/api/events", con.Events)
+	server := httptest.NewServer(g)
+	defer server.Close()
+
+	get := func(query string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/api/events"+query, nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := server.Client().Do(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	t.Run("unknown topic", func(t *testing.T) {
+		resp := get("?topic=secret")
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	resp := get("?topic=announcement")
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, sseContentType, resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Empty(t, resp.Header.Get("ETag"))
+
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+	// reads until a blank line ends the message
+	next := func() (message []string) {
+		for {
+			select {
+			case line, ok := <-lines:
+				if !ok || line == "" {
+					return
+				}
+				message = append(message, line)
+			case <-time.After(3 * time.Second):
+				t.Fatal("stream is buffered")
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"retry: 3000"}, next())
+
+	con.SSEHub.Publish(context.Background(), pg.Notification{Channel: "announcement", Payload: "hello\nworld"})
+	message := next()
+	require.Len(t, message, 4)
+	assert.True(t, strings.HasPrefix(message[0], "id: "))
+	assert.Equal(t, []string{"event: announcement", "data: hello", "data: world"}, message[1:])
+
+	assert.Equal(t, []string{": heartbeat"}, next())
+
+	// shutting down ends the stream
+	con.SSEHub.Close()
+	next()
+	_, open := <-lines
+	assert.False(t, open)
+}
@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"telescope/logging"
+	"telescope/tracing"
+	"telescope/version"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("telescope/controller")
+
+// TracingMiddleware starts a server span per request,
+// continuing the trace from W3C traceparent header if there's one.
+// Trace ID and span ID are added to request logger.
+//
+// Use it right after RequestIDMiddleware.
+func (con *Controller) TracingMiddleware(c *gin.Context) {
+	ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+	route := c.FullPath()
+	spanName := route
+	if spanName == "" {
+		spanName = "HTTP " + c.Request.Method
+	}
+
+	ctx, span := tracer.Start(ctx, spanName,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest(version.Name, route, c.Request)...),
+	)
+	defer span.End()
+
+	if fields := tracing.LogFields(ctx); len(fields) > 0 {
+		logger := con.loggerOf(c).With(fields...)
+		c.Set(ctxLoggerKey, logger)
+		ctx = logging.WithLogger(ctx, logger)
+	}
+	c.Request = c.Request.WithContext(ctx)
+
+	c.Next()
+
+	status := c.Writer.Status()
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+	spanStatus, description := semconv.SpanStatusFromHTTPStatusCodeAndSpanKind(status, trace.SpanKindServer)
+	span.SetStatus(spanStatus, description)
+	if spanStatus == codes.Error {
+		for _, err := range c.Errors {
+			span.RecordError(err.Err)
+		}
+	}
+}
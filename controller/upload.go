@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"telescope/errorcode"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	// permissionUpload is required to upload files
+	permissionUpload = "upload:write"
+
+	uploadKeyLength = 24
+	// maxUploadExtLength longer extensions are dropped from storage keys
+	maxUploadExtLength = 10
+)
+
+// UploadConfig of file uploading, size of uploads is capped by BodyLimitConfig on route /api/uploads.
+type UploadConfig struct {
+	// Dir where uploaded files are kept on local disk, empty disables uploading
+	Dir string
+}
+
+type uploadQuery struct {
+	Filename string `form:"filename" description:"name of the file when body is not multipart/form-data"`
+}
+
+// UploadedFile is a file saved in storage
+type UploadedFile struct {
+	// Key locates the file in storage
+	Key string `json:"key"`
+	// Field of multipart form, empty for non-multipart uploads
+	Field       string `json:"field,omitempty"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+}
+
+type uploadResponse struct {
+	Files []UploadedFile `json:"files"`
+}
+
+// Upload saves files in request to storage.
+//
+// multipart/form-data requests may carry several files, in which non-file fields are ignored,
+// while any other body is saved as a single file.
+func (con *Controller) Upload(c *gin.Context) {
+	if con.Storage == nil {
+		con.NotFound(c)
+		return
+	}
+
+	var (
+		files []UploadedFile
+		err   error
+	)
+	if mediaType, _, _ := mime.ParseMediaType(c.ContentType()); mediaType == "multipart/form-data" {
+		files, err = con.saveMultipart(c)
+	} else {
+		var query uploadQuery
+		err = c.ShouldBindQuery(&query)
+		if err != nil {
+			_ = c.Error(err).SetType(gin.ErrorTypeBind)
+			return
+		}
+
+		var file UploadedFile
+		file, err = con.saveFile(c.Request.Context(), query.Filename, c.ContentType(), c.Request.Body)
+		files = []UploadedFile{file}
+	}
+	if err != nil {
+		_ = c.Error(err)
+		return
+	}
+
+	ok(c, uploadResponse{Files: files})
+}
+
+// saveMultipart streams file parts of multipart request into storage one by one,
+// so that files are never buffered in memory as a whole.
+// Files saved are removed if any of them fails.
+func (con *Controller) saveMultipart(c *gin.Context) (files []UploadedFile, err error) {
+	ctx := c.Request.Context()
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, file := range files {
+			if deleteErr := con.Storage.Delete(context.Background(), file.Key); deleteErr != nil {
+				con.loggerOf(c).Error("removing uploaded file", zap.String("key", file.Key), zap.Error(deleteErr))
+			}
+		}
+		files = nil
+	}()
+
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		err = errorcode.ErrBadBinding.Wrap(err)
+		return
+	}
+
+	for {
+		part, partErr := reader.NextPart()
+		if errors.Is(partErr, io.EOF) {
+			break
+		}
+		if partErr != nil {
+			err = errorcode.ErrBadBinding.Wrap(partErr)
+			return
+		}
+		if part.FileName() == "" {
+			_ = part.Close()
+			continue
+		}
+
+		var file UploadedFile
+		file, err = con.saveFile(ctx, part.FileName(), part.Header.Get("Content-Type"), part)
+		_ = part.Close()
+		if err != nil {
+			return
+		}
+		file.Field = part.FormName()
+		files = append(files, file)
+	}
+
+	if len(files) == 0 {
+		err = errorcode.ErrBadBinding.Wrap(errors.New("no file in multipart form"))
+		return
+	}
+
+	return
+}
+
+// saveFile streams r into storage under a random key, keeping extension of filename.
+func (con *Controller) saveFile(ctx context.Context, filename, contentType string, r io.Reader) (file UploadedFile, err error) {
+	token, err := secureToken(uploadKeyLength)
+	if err != nil {
+		err = fmt.Errorf("generating upload key: %w", err)
+		return
+	}
+
+	// some browsers send full path
+	filename = path.Base(strings.ReplaceAll(filename, "\\", "/"))
+	if filename == "." || filename == "/" {
+		filename = ""
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	file = UploadedFile{
+		Key:         time.Now().UTC().Format("2006/01/02") + "/" + token + uploadExt(filename),
+		Filename:    filename,
+		ContentType: contentType,
+	}
+	file.Size, err = con.Storage.Put(ctx, file.Key, r)
+	if err != nil {
+		err = fmt.Errorf("saving upload: %w", err)
+		return
+	}
+
+	return
+}
+
+// uploadExt is extension of filename if it's short and alphanumeric, otherwise empty
+func uploadExt(filename string) string {
+	ext := path.Ext(filename)
+	if len(ext) < 2 || len(ext) > maxUploadExtLength {
+		return ""
+	}
+	for _, r := range ext[1:] {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return ""
+		}
+	}
+
+	return strings.ToLower(ext)
+}
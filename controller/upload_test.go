@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telescope/cache"
+	"telescope/storage"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestController_Upload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	local, err := storage.NewLocal(storage.LocalConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+	limiter, err := newBodyLimiter(BodyLimitConfig{DefaultBytes: 1 << 20})
+	require.NoError(t, err)
+	con := &Controller{
+		Logger:      zap.NewNop(),
+		Storage:     local,
+		bodyLimiter: limiter,
+	}
+
+	g := gin.New()
+	g.Use(con.ErrorMiddleware, con.LimitReaderMiddleware())
+	g.POST("/uploads", con.Upload)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	require.NoError(t, form.WriteField("note", "ignored"))
+	part, err := form.CreateFormFile("avatar", `C:\photos\me.PNG`)
+	require.NoError(t, err)
+	_, err = part.Write([]byte("png content"))
+	require.NoError(t, err)
+	part, err = form.CreateFormFile("doc", "readme.txt")
+	require.NoError(t, err)
+	_, err = part.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, form.Close())
+
+	tests := []struct {
+		testName    string
+		path        string
+		contentType string
+		body        io.Reader
+		want        map[string]string
+		wantStatus  int
+	}{
+		{
+			testName:    "multipart",
+			path:        "/uploads",
+			contentType: form.FormDataContentType(),
+			body:        &body,
+			want:        map[string]string{"me.PNG": "png content", "readme.txt": "hello"},
+			wantStatus:  http.StatusOK,
+		},
+		{
+			testName:    "raw body",
+			path:        "/uploads?filename=data.json",
+			contentType: "application/json",
+			body:        strings.NewReader(`{"a":1}`),
+			want:        map[string]string{"data.json": `{"a":1}`},
+			wantStatus:  http.StatusOK,
+		},
+		{
+			testName:    "multipart without file",
+			path:        "/uploads",
+			contentType: "multipart/form-data; boundary=x",
+			body:        strings.NewReader("--x\r\nContent-Disposition: form-data; name=\"note\"\r\n\r\nhi\r\n--x--\r\n"),
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, tt.body)
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, req)
+
+			require.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var resp struct {
+				Data uploadResponse `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Len(t, resp.Data.Files, len(tt.want))
+			for _, file := range resp.Data.Files {
+				want, ok := tt.want[file.Filename]
+				require.True(t, ok, file.Filename)
+				assert.Equal(t, int64(len(want)), file.Size)
+
+				saved, err := local.Open(context.Background(), file.Key)
+				require.NoError(t, err)
+				content, err := io.ReadAll(saved)
+				require.NoError(t, err)
+				require.NoError(t, saved.Close())
+				assert.Equal(t, want, string(content))
+			}
+		})
+	}
+}
+
+func Test_uploadExt(t *testing.T) {
+	tests := []struct {
+		filename string
+		want     string
+	}{
+		{filename: "me.PNG", want: ".png"},
+		{filename: "archive.tar.gz", want: ".gz"},
+		{filename: "noext", want: ""},
+		{filename: "evil.p/hp", want: ""},
+		{filename: "weird.ext-ension", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			assert.Equal(t, tt.want, uploadExt(tt.filename))
+		})
+	}
+}
+
+// countingReader counts bytes read from it
+type countingReader struct {
+	io.Reader
+	read int
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.Reader.Read(p)
+	r.read += n
+	return
+}
+
+// peekingStorage tells how much of body was consumed before Put
+type peekingStorage struct {
+	storage.Storage
+	body          *countingReader
+	readBeforePut int
+}
+
+func (s *peekingStorage) Put(_ context.Context, _ string, r io.Reader) (int64, error) {
+	s.readBeforePut = s.body.read
+	return io.Copy(io.Discard, r)
+}
+
+func Test_registerRoutes_uploadNotBuffered(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	body := &countingReader{Reader: strings.NewReader(strings.Repeat("a", 1<<20))}
+	store := &peekingStorage{body: body}
+	con := &Controller{
+		Logger: zap.NewNop(),
+		// idempotency replaying would kick in if it's on the route
+		Cache:   &cache.Cache{},
+		Storage: store,
+	}
+
+	g := gin.New()
+	g.Use(con.ErrorMiddleware, func(c *gin.Context) {
+		c.Set(ctxPrincipalKey, &Principal{ID: "alice", Kind: "user"})
+		c.Set(ctxPermissionsKey, PermissionSet{permissionUpload: {}})
+	})
+	registerRoutes(g, con)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/uploads?filename=big.bin", body)
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set(idempotencyKeyHeader, "upload-1")
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 0, store.readBeforePut)
+	assert.Equal(t, 1<<20, body.read)
+}
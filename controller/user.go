@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"fmt"
+	"strconv"
+	"telescope/cache"
+	"telescope/database"
+	"telescope/errorcode"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// permissionUserRoles is required to change roles of users
+const permissionUserRoles = "admin:user-roles"
+
+type userRolesRequest struct {
+	Roles []string `json:"roles" binding:"required,dive,required" description:"replaces all roles of the user"`
+}
+
+type userRolesResponse struct {
+	UserID string   `json:"userID"`
+	Roles  []string `json:"roles"`
+	// Session is the rotated session of the caller, when the caller changes roles of itself
+	Session *sessionResponse `json:"session,omitempty"`
+}
+
+// GetUserRoles tells roles of a user, along with ETag of the user's version for If-Match.
+func (con *Controller) GetUserRoles(c *gin.Context) {
+	user, found := con.userOfParam(c)
+	if !found {
+		return
+	}
+
+	if notModified(c, userETag(user), time.Time{}) {
+		return
+	}
+
+	ok(c, userRolesResponse{
+		UserID: strconv.FormatInt(user.ID, 10),
+		Roles:  user.Roles,
+	})
+}
+
+// UpdateUserRoles replaces roles of a user,
+// If-Match guards it from overwriting changes made by others.
+//
+// Sessions of the user carry roles as of login, so they are ended to take effect,
+// except that the caller's own session is rotated.
+func (con *Controller) UpdateUserRoles(c *gin.Context) {
+	var req userRolesRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		_ = c.Error(err).SetType(gin.ErrorTypeBind)
+		return
+	}
+
+	user, found := con.userOfParam(c)
+	if !found {
+		return
+	}
+	if !preconditionsMet(c, userETag(user), time.Time{}) {
+		return
+	}
+
+	updated, err := con.DB.UpdateUserRoles(c.Request.Context(), user.ID, user.Version, req.Roles)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("UpdateUserRoles: %w", err))
+		return
+	}
+	if !updated {
+		// changed by others since we read it
+		_ = c.Error(errorcode.ErrPreconditionFailed)
+		return
+	}
+	user.Version++
+	user.Roles = req.Roles
+	c.Header("ETag", userETag(user))
+
+	resp := userRolesResponse{
+		UserID: strconv.FormatInt(user.ID, 10),
+		Roles:  user.Roles,
+	}
+	session, err := con.applyUserRoles(c, resp.UserID, req.Roles)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("applyUserRoles: %w", err))
+		return
+	}
+	if session != nil {
+		sessionResp := newSessionResponse(session)
+		resp.Session = &sessionResp
+	}
+
+	ok(c, resp)
+}
+
+// userOfParam finds user by path parameter id, responding ErrUserNotFound if not found.
+func (con *Controller) userOfParam(c *gin.Context) (user *database.User, found bool) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		_ = c.Error(errorcode.ErrUserNotFound)
+		return
+	}
+
+	user, err = con.DB.UserByID(c.Request.Context(), userID)
+	if err != nil {
+		_ = c.Error(fmt.Errorf("UserByID: %w", err))
+		return
+	}
+	if user == nil {
+		_ = c.Error(errorcode.ErrUserNotFound)
+		return
+	}
+
+	found = true
+	return
+}
+
+// userETag is version-based ETag of user
+func userETag(user *database.User) string {
+	return quoteETag(strconv.FormatInt(user.Version, 10))
+}
+
+// applyUserRoles ends sessions of user whose roles are changed.
+// If the current session belongs to the user, it's rotated with roles instead,
+// and returned as session.
+func (con *Controller) applyUserRoles(c *gin.Context, userID string, roles []string) (session *cache.Session, err error) {
+	err = con.Cache.DeleteUserSessions(c.Request.Context(), userID)
+	if err != nil {
+		err = fmt.Errorf("DeleteUserSessions: %w", err)
+		return
+	}
+
+	current, found := sessionOf(c)
+	if !found || current.UserID != userID {
+		return
+	}
+
+	// privilege changes, never keep the session ID
+	err = con.rotateSession(c, roles)
+	if err != nil {
+		err = fmt.Errorf("rotateSession: %w", err)
+		return
+	}
+
+	session = current
+	return
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"telescope/cache"
+	"telescope/database"
+	"telescope/errorcode"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestController_applyUserRoles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	red := testCache(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// unique across runs against a long-lived Redis
+	suffix, err := secureToken(8)
+	require.NoError(t, err)
+	var (
+		alice       = "alice-" + suffix
+		bob         = "bob-" + suffix
+		aliceLaptop = "alice-laptop-" + suffix
+		alicePhone  = "alice-phone-" + suffix
+		bobLaptop   = "bob-laptop-" + suffix
+	)
+	for _, session := range []*cache.Session{
+		{ID: aliceLaptop, UserID: alice, Roles: []string{"viewer"}, CSRFToken: "alice-csrf", CreatedAt: time.Now()},
+		{ID: alicePhone, UserID: alice, Roles: []string{"viewer"}, CSRFToken: "phone-csrf", CreatedAt: time.Now()},
+		{ID: bobLaptop, UserID: bob, Roles: []string{"viewer"}, CSRFToken: "bob-csrf", CreatedAt: time.Now()},
+	} {
+		require.NoError(t, red.SaveSession(ctx, session, time.Minute))
+	}
+	con := &Controller{
+		Logger:  zap.NewNop(),
+		Cache:   red,
+		Session: SessionConfig{}.withDefaults(),
+	}
+
+	g := gin.New()
+	g.Use(con.ErrorMiddleware, con.SessionMiddleware)
+	g.PUT("/users/:id/roles", func(c *gin.Context) {
+		session, err := con.applyUserRoles(c, c.Param("id"), []string{"admin"})
+		if err != nil {
+			_ = c.Error(err)
+			return
+		}
+		if session == nil {
+			ok(c, nil)
+			return
+		}
+		ok(c, newSessionResponse(session))
+	})
+	g.GET("/session", con.CurrentSession)
+
+	do := func(method, path, sessionID, csrfToken string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: con.Session.CookieName, Value: sessionID})
+		req.Header.Set(csrfTokenHeader, csrfToken)
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		return w
+	}
+
+	// alice changes roles of bob, whose sessions are ended
+	w := do(http.MethodPut, "/users/"+bob+"/roles", aliceLaptop, "alice-csrf")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, w.Result().Cookies())
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/session", bobLaptop, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/session", aliceLaptop, "").Code)
+
+	// alice changes roles of herself, her session is rotated and others are ended
+	w = do(http.MethodPut, "/users/"+alice+"/roles", aliceLaptop, "alice-csrf")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data sessionResponse `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"admin"}, resp.Data.Roles)
+	assert.NotEmpty(t, resp.Data.CSRFToken)
+	assert.NotEqual(t, "alice-csrf", resp.Data.CSRFToken)
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	newID := cookies[0].Value
+	assert.NotEmpty(t, newID)
+	assert.NotEqual(t, aliceLaptop, newID)
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/session", aliceLaptop, "").Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodGet, "/session", alicePhone, "").Code)
+
+	w = do(http.MethodGet, "/session", newID, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, []string{"admin"}, resp.Data.Roles)
+	assert.Equal(t, alice, resp.Data.UserID)
+}
+
+func TestController_UpdateUserRoles_ifMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	db := testDB(t)
+	red := testCache(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	suffix, err := secureToken(8)
+	require.NoError(t, err)
+	user := &database.User{
+		Username:     "roles-" + suffix,
+		PasswordHash: dummyPasswordHash,
+		Roles:        []string{"viewer"},
+	}
+	require.NoError(t, db.CreateUser(ctx, user))
+	path := "/api/admin/users/" + strconv.FormatInt(user.ID, 10) + "/roles"
+
+	con := &Controller{
+		Logger:  zap.NewNop(),
+		DB:      db,
+		Cache:   red,
+		Session: SessionConfig{}.withDefaults(),
+	}
+	g := gin.New()
+	g.Use(con.ErrorMiddleware, func(c *gin.Context) {
+		c.Set(ctxPrincipalKey, &Principal{ID: "admin", Kind: "user"})
+		c.Set(ctxPermissionsKey, PermissionSet{permissionUserRoles: {}})
+	})
+	registerRoutes(g, con)
+
+	do := func(method, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		g.ServeHTTP(w, req)
+		return w
+	}
+	rolesOf := func(w *httptest.ResponseRecorder) []string {
+		var resp struct {
+			Data userRolesResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		return resp.Data.Roles
+	}
+
+	w := do(http.MethodGet, "", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	etag := w.Header().Get("ETag")
+	assert.Equal(t, `"1"`, etag)
+	assert.Equal(t, []string{"viewer"}, rolesOf(w))
+
+	w = do(http.MethodPut, etag, `{"roles":["editor"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Equal(t, []string{"editor"}, rolesOf(w))
+
+	// stale ETag is not applied
+	w = do(http.MethodPut, etag, `{"roles":["admin"]}`)
+	require.Equal(t, http.StatusPreconditionFailed, w.Code, w.Body.String())
+	var resp R
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, errorcode.CodePreconditionFailed, resp.Code)
+
+	w = do(http.MethodGet, "", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	assert.Equal(t, []string{"editor"}, rolesOf(w))
+
+	// no If-Match, no precondition
+	w = do(http.MethodPut, "", `{"roles":["admin"]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+}
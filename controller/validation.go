@@ -0,0 +1,136 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"telescope/errorcode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+)
+
+// FieldError tells what's wrong with a request field
+type FieldError struct {
+	// Field is the JSON path of the field, e.g. "items[0].name"
+	Field string `json:"field"`
+	// Rule is the failed validation rule, e.g. "required", "max"
+	Rule string `json:"rule"`
+	// Param of the rule, e.g. "32" of "max=32"
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// defaultValidationRule names message for rules without their own
+const defaultValidationRule = "invalid"
+
+// SetValidationMessage customizes message of a validation rule in fallback language,
+// "{field}" and "{param}" in message are replaced, e.g.
+//
+//	SetValidationMessage("required", "{field} can not be empty")
+//
+// Use errorcode.DefaultCatalog.Set for other languages.
+func SetValidationMessage(rule, message string) {
+	catalog := errorcode.DefaultCatalog
+	catalog.Set(catalog.Fallback(), errorcode.ValidationMessagePrefix+rule, message)
+}
+
+func validationMessage(tag language.Tag, field, rule, param string) string {
+	params := map[string]string{
+		"field": field,
+		"param": param,
+	}
+
+	message, found := errorcode.DefaultCatalog.Message(tag, errorcode.ValidationMessagePrefix+rule, params)
+	if !found {
+		message, _ = errorcode.DefaultCatalog.Message(tag, errorcode.ValidationMessagePrefix+defaultValidationRule, params)
+	}
+
+	return message
+}
+
+func init() {
+	// report field names as clients see them
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(fieldNameOf)
+	}
+}
+
+// fieldNameOf prefers name in json tag, then form tag, then Go field name.
+func fieldNameOf(field reflect.StructField) string {
+	for _, key := range [...]string{"json", "form"} {
+		name := strings.SplitN(field.Tag.Get(key), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+// bindingErrorResponse translates errors from binding into R in language tag,
+// with 422 and field details for validation failures,
+// and 400 for bodies which can not be decoded at all.
+func bindingErrorResponse(tag language.Tag, err error) (statusCode int, resp R) {
+	var (
+		validationErrs validator.ValidationErrors
+		typeErr        *json.UnmarshalTypeError
+		syntaxErr      *json.SyntaxError
+	)
+
+	switch {
+	case errors.As(err, &validationErrs):
+		statusCode = http.StatusUnprocessableEntity
+		resp.Code = errorcode.CodeValidationFailed
+		resp.Msg = errorcode.DefaultCatalog.Localize(tag, errorcode.ErrValidationFailed)
+		details := make([]FieldError, 0, len(validationErrs))
+		for _, fieldErr := range validationErrs {
+			field := fieldPath(fieldErr.Namespace())
+			details = append(details, FieldError{
+				Field:   field,
+				Rule:    fieldErr.Tag(),
+				Param:   fieldErr.Param(),
+				Message: validationMessage(tag, field, fieldErr.Tag(), fieldErr.Param()),
+			})
+		}
+		resp.Details = details
+	case errors.As(err, &typeErr):
+		statusCode = http.StatusUnprocessableEntity
+		resp.Code = errorcode.CodeValidationFailed
+		resp.Msg = errorcode.DefaultCatalog.Localize(tag, errorcode.ErrValidationFailed)
+		param := typeErr.Type.Kind().String()
+		resp.Details = []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   param,
+			Message: validationMessage(tag, typeErr.Field, "type", param),
+		}}
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		statusCode = http.StatusBadRequest
+		resp.Code = errorcode.CodeBadBinding
+		resp.Msg = errorcode.DefaultCatalog.Localize(tag, errorcode.ErrBadBinding)
+	default:
+		statusCode = http.StatusBadRequest
+		resp.Code = errorcode.CodeBadBinding
+		resp.Msg = err.Error()
+	}
+
+	return
+}
+
+// fieldPath strips struct name from validator namespace,
+// "loginRequest.items[0].name" becomes "items[0].name".
+func fieldPath(namespace string) string {
+	if dot := strings.IndexByte(namespace, '.'); dot >= 0 {
+		return namespace[dot+1:]
+	}
+
+	return namespace
+}
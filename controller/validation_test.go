@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telescope/errorcode"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type validationTestItem struct {
+	Name  string `json:"name" binding:"required"`
+	Count int    `json:"count" binding:"gte=1"`
+}
+
+type validationTestRequest struct {
+	Username string               `json:"username" binding:"required,max=8"`
+	Role     string               `json:"role" binding:"oneof=admin user"`
+	Items    []validationTestItem `json:"items" binding:"dive"`
+}
+
+func TestController_ErrorMiddleware_binding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	con := &Controller{Logger: zap.NewNop()}
+	g := gin.New()
+	g.Use(con.ErrorMiddleware)
+	g.POST("/", func(c *gin.Context) {
+		var req validationTestRequest
+		err := c.ShouldBindJSON(&req)
+		if err != nil {
+			_ = c.Error(err).SetType(gin.ErrorTypeBind)
+			return
+		}
+		ok(c, nil)
+	})
+
+	tests := []struct {
+		testName       string
+		acceptLanguage string
+		body           string
+		wantStatus     int
+		wantCode       int
+		wantDetails    []FieldError
+	}{
+		{
+			testName:   "valid",
+			body:       `{"username": "alice", "role": "admin", "items": [{"name": "a", "count": 1}]}`,
+			wantStatus: http.StatusOK,
+			wantCode:   0,
+		},
+		{
+			testName:   "fields",
+			body:       `{"username": "longer than eight", "role": "root", "items": [{"name": "a", "count": 1}, {"count": 0}]}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   errorcode.CodeValidationFailed,
+			wantDetails: []FieldError{
+				{Field: "username", Rule: "max", Param: "8", Message: "username must be at most 8"},
+				{Field: "role", Rule: "oneof", Param: "admin user", Message: "role must be one of [admin user]"},
+				{Field: "items[1].name", Rule: "required", Message: "items[1].name is required"},
+				{Field: "items[1].count", Rule: "gte", Param: "1", Message: "items[1].count must be greater than or equal to 1"},
+			},
+		},
+		{
+			testName:       "localized",
+			acceptLanguage: "zh-CN,zh;q=0.9",
+			body:           `{"username": "alice", "role": "root"}`,
+			wantStatus:     http.StatusUnprocessableEntity,
+			wantCode:       errorcode.CodeValidationFailed,
+			wantDetails: []FieldError{
+				{Field: "role", Rule: "oneof", Param: "admin user", Message: "role 必须是 [admin user] 之一"},
+			},
+		},
+		{
+			testName:   "wrong type",
+			body:       `{"username": 42}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantCode:   errorcode.CodeValidationFailed,
+			wantDetails: []FieldError{
+				{Field: "username", Rule: "type", Param: "string", Message: "username must be string"},
+			},
+		},
+		{
+			testName:   "malformed",
+			body:       `{"username": `,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   errorcode.CodeBadBinding,
+		},
+		{
+			testName:   "empty",
+			body:       ``,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   errorcode.CodeBadBinding,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+			w := httptest.NewRecorder()
+			g.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			var resp struct {
+				Code    int          `json:"code"`
+				Details []FieldError `json:"details"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Equal(t, tt.wantDetails, resp.Details)
+		})
+	}
+}
@@ -0,0 +1,366 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"telescope/errorcode"
+	"telescope/metric"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/stats/v4"
+	"go.uber.org/zap"
+	"golang.org/x/text/language"
+)
+
+const (
+	// wsSubprotocol is selected when clients offer it,
+	// browsers passing credential by wsTokenProtocolPrefix must offer it as well.
+	wsSubprotocol         = "telescope"
+	wsTokenProtocolPrefix = "access_token."
+	maxWSRoomNameLength   = 128
+
+	defaultWSPing            = 30
+	defaultWSPongTimeout     = 60
+	defaultWSWriteTimeout    = 10
+	defaultWSSendQueueSize   = 64
+	defaultWSMaxMessageBytes = 64 << 10
+)
+
+// types of WebSocket message
+const (
+	// from clients
+	wsTypeJoin    = "join"
+	wsTypeLeave   = "leave"
+	wsTypePublish = "publish"
+	// from server
+	wsTypeJoined  = "joined"
+	wsTypeLeft    = "left"
+	wsTypeMessage = "message"
+	wsTypeError   = "error"
+)
+
+// WebSocketConfig config on WebSocket gateway
+type WebSocketConfig struct {
+	// Rooms clients may join, none means the endpoint is off
+	Rooms []WebSocketRoom
+	// PingSeconds pings are sent this often, defaults to 30 seconds
+	PingSeconds int
+	// PongTimeoutSeconds connections are closed without hearing from clients for this long, defaults to 60 seconds
+	PongTimeoutSeconds int
+	// WriteTimeoutSeconds bounds each write, defaults to 10 seconds
+	WriteTimeoutSeconds int
+	// SendQueueSize messages are queued for each connection,
+	// connections falling further behind are closed, defaults to 64.
+	SendQueueSize int
+	// MaxMessageBytes larger messages from clients close the connection, defaults to 64 KiB
+	MaxMessageBytes int
+}
+
+// WebSocketRoom is a room clients may join and publish to
+type WebSocketRoom struct {
+	// Name of room, a name ending with "*" matches rooms by prefix, e.g. "chat:*"
+	Name string
+	// Permission required to join, empty means any authenticated caller
+	Permission string
+}
+
+func (w WebSocketConfig) withDefaults() WebSocketConfig {
+	if w.PingSeconds <= 0 {
+		w.PingSeconds = defaultWSPing
+	}
+	if w.PongTimeoutSeconds <= 0 {
+		w.PongTimeoutSeconds = defaultWSPongTimeout
+	}
+	if w.WriteTimeoutSeconds <= 0 {
+		w.WriteTimeoutSeconds = defaultWSWriteTimeout
+	}
+	if w.SendQueueSize <= 0 {
+		w.SendQueueSize = defaultWSSendQueueSize
+	}
+	if w.MaxMessageBytes <= 0 {
+		w.MaxMessageBytes = defaultWSMaxMessageBytes
+	}
+
+	return w
+}
+
+func (w WebSocketConfig) ping() time.Duration {
+	return time.Duration(w.PingSeconds) * time.Second
+}
+
+func (w WebSocketConfig) pongTimeout() time.Duration {
+	return time.Duration(w.PongTimeoutSeconds) * time.Second
+}
+
+func (w WebSocketConfig) writeTimeout() time.Duration {
+	return time.Duration(w.WriteTimeoutSeconds) * time.Second
+}
+
+// room finds the first room matching name
+func (w WebSocketConfig) room(name string) (room WebSocketRoom, found bool) {
+	for _, room = range w.Rooms {
+		if prefix := strings.TrimSuffix(room.Name, "*"); prefix != room.Name {
+			found = strings.HasPrefix(name, prefix) && len(name) > len(prefix)
+		} else {
+			found = room.Name == name
+		}
+		if found {
+			return
+		}
+	}
+
+	return
+}
+
+// wsMessage is the JSON message on WebSocket
+type wsMessage struct {
+	Type string          `json:"type"`
+	Room string          `json:"room,omitempty"`
+	Data json.RawMessage `json:"data,omitempty"`
+	// From is the principal ID of publisher
+	From string `json:"from,omitempty"`
+	// Code, Msg and Details tell what's wrong in error messages
+	Code    int         `json:"code,omitempty"`
+	Msg     string      `json:"msg,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// WebSocket upgrades the connection, on which clients join rooms and publish messages to them.
+//
+// Clients send {"type": "join"|"leave", "room": "..."} and {"type": "publish", "room": "...", "data": ...},
+// and receive "joined", "left", "message" and "error" in the same shape.
+// Messages reach members of the room on every instance.
+func (con *Controller) WebSocket(c *gin.Context) {
+	principal, _ := principalOf(c)
+	config := con.WebSocketConfig
+
+	upgrader := websocket.Upgrader{
+		Subprotocols: []string{wsSubprotocol},
+		CheckOrigin:  con.checkWebSocketOrigin,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			c.PureJSON(status, R{
+				Code: status,
+				Msg:  reason.Error(),
+			})
+		},
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// responded by upgrader
+		return
+	}
+
+	client := &wsConn{
+		conn:      conn,
+		principal: principal,
+		send:      make(chan []byte, config.SendQueueSize),
+		closed:    make(chan struct{}),
+	}
+	err = con.WebSocketHub.register(client)
+	if err != nil {
+		_ = conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is shutting down"),
+			time.Now().Add(config.writeTimeout()))
+		_ = conn.Close()
+		return
+	}
+	defer con.WebSocketHub.unregister(client)
+
+	go con.writeWebSocket(client)
+
+	tag := errorcode.DefaultCatalog.Negotiate(c.GetHeader("Accept-Language"))
+	con.readWebSocket(c, client, tag)
+}
+
+// readWebSocket handles messages from client until the connection breaks
+func (con *Controller) readWebSocket(c *gin.Context, client *wsConn, tag language.Tag) {
+	config := con.WebSocketConfig
+	conn := client.conn
+	defer client.close(websocket.CloseNormalClosure, "")
+
+	conn.SetReadLimit(int64(config.MaxMessageBytes))
+	_ = conn.SetReadDeadline(time.Now().Add(config.pongTimeout()))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(config.pongTimeout()))
+	})
+
+	for {
+		_, payload, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				con.loggerOf(c).Debug("WebSocket connection broke", zap.Error(err))
+			}
+			return
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(config.pongTimeout()))
+		con.Metric.Incr(metric.WebSocketMessagesTotal, stats.T("direction", "in"))
+
+		var message wsMessage
+		err = json.Unmarshal(payload, &message)
+		if err != nil {
+			con.replyWebSocket(client, &wsMessage{Type: wsTypeError}, tag, errorcode.ErrBadBinding)
+			continue
+		}
+
+		reply, err := con.handleWebSocketMessage(c, client, &message)
+		var apiErr *errorcode.Error
+		if errors.As(err, &apiErr) {
+			con.replyWebSocket(client, &wsMessage{Type: wsTypeError, Room: message.Room}, tag, apiErr)
+			continue
+		}
+		if err != nil {
+			con.loggerOf(c).Error("handling WebSocket message",
+				zap.String("type", message.Type),
+				zap.String("room", message.Room),
+				zap.Error(err),
+			)
+			con.replyWebSocket(client, &wsMessage{Type: wsTypeError, Room: message.Room}, tag, errorcode.ErrGeneral)
+			continue
+		}
+		if reply != nil {
+			con.replyWebSocket(client, reply, tag, nil)
+		}
+	}
+}
+
+// handleWebSocketMessage handles message from client, err is an *errorcode.Error if client is wrong.
+func (con *Controller) handleWebSocketMessage(c *gin.Context, client *wsConn, message *wsMessage) (reply *wsMessage, err error) {
+	switch message.Type {
+	case wsTypeJoin, wsTypeLeave, wsTypePublish:
+	default:
+		err = errorcode.ErrValidationFailed.WithDetails(FieldError{
+			Field:   "type",
+			Rule:    "oneof",
+			Param:   strings.Join([]string{wsTypeJoin, wsTypeLeave, wsTypePublish}, " "),
+			Message: "unknown message type",
+		})
+		return
+	}
+	if message.Room == "" || len(message.Room) > maxWSRoomNameLength {
+		err = errorcode.ErrValidationFailed.WithDetails(FieldError{
+			Field:   "room",
+			Rule:    "required",
+			Message: "room is required and at most 128 characters",
+		})
+		return
+	}
+
+	switch message.Type {
+	case wsTypeJoin:
+		room, found := con.WebSocketConfig.room(message.Room)
+		if !found {
+			err = errorcode.ErrUnknownTopic.WithParams(map[string]string{"topic": message.Room})
+			return
+		}
+		if room.Permission != "" {
+			var allowed bool
+			allowed, err = con.can(c, room.Permission)
+			if err != nil {
+				return
+			}
+			if !allowed {
+				err = errorcode.ErrForbidden
+				return
+			}
+		}
+
+		con.WebSocketHub.join(client, message.Room)
+		reply = &wsMessage{Type: wsTypeJoined, Room: message.Room}
+	case wsTypeLeave:
+		con.WebSocketHub.leave(client, message.Room)
+		reply = &wsMessage{Type: wsTypeLeft, Room: message.Room}
+	case wsTypePublish:
+		if !con.WebSocketHub.joined(client, message.Room) {
+			err = errorcode.ErrForbidden
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), con.WebSocketConfig.writeTimeout())
+		defer cancel()
+		err = con.WebSocketHub.publish(ctx, message.Room, &wsMessage{
+			Type: wsTypeMessage,
+			Room: message.Room,
+			Data: message.Data,
+			From: client.principal.ID,
+		})
+	}
+
+	return
+}
+
+// replyWebSocket queues reply to client, apiErr is localized into reply if not nil.
+func (con *Controller) replyWebSocket(client *wsConn, reply *wsMessage, tag language.Tag, apiErr *errorcode.Error) {
+	if apiErr != nil {
+		reply.Code = apiErr.Code()
+		reply.Msg = errorcode.DefaultCatalog.Localize(tag, apiErr)
+		if details := apiErr.Details(); len(details) > 0 {
+			reply.Details = details
+		}
+	}
+
+	payload, err := json.Marshal(reply)
+	if err != nil {
+		return
+	}
+
+	select {
+	case client.send <- payload:
+	default:
+		client.close(websocket.CloseTryAgainLater, "too slow to keep up")
+	}
+}
+
+// writeWebSocket sends queued messages and pings until the connection is closed
+func (con *Controller) writeWebSocket(client *wsConn) {
+	config := con.WebSocketConfig
+	conn := client.conn
+	ping := time.NewTicker(config.ping())
+	defer func() {
+		ping.Stop()
+		_ = conn.Close()
+	}()
+
+	for {
+		var err error
+		select {
+		case payload := <-client.send:
+			_ = conn.SetWriteDeadline(time.Now().Add(config.writeTimeout()))
+			err = conn.WriteMessage(websocket.TextMessage, payload)
+		case <-ping.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(config.writeTimeout()))
+		case <-client.closed:
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(client.closeCode, client.closeReason),
+				time.Now().Add(config.writeTimeout()))
+			return
+		}
+		if err != nil {
+			// reading fails as well then
+			return
+		}
+	}
+}
+
+// checkWebSocketOrigin accepts same origin and origins allowed by CORS policy,
+// which keeps other sites from riding on cookie session.
+func (con *Controller) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if strings.EqualFold(strings.TrimPrefix(strings.TrimPrefix(origin, "https://"), "http://"), r.Host) {
+		return true
+	}
+
+	if con.cors == nil {
+		return false
+	}
+	policy := con.cors.policyFor(r.URL.Path)
+	return policy.enabled() && policy.allows(origin)
+}
@@ -0,0 +1,280 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"telescope/cache"
+	"telescope/metric"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/websocket"
+	"github.com/segmentio/stats/v4"
+	"go.uber.org/zap"
+)
+
+// wsRoomChannelPrefix prefixes Redis channels of rooms
+const wsRoomChannelPrefix = "ws-room:"
+
+// errWebSocketHubClosed hub is closed for shutting down
+var errWebSocketHubClosed = errors.New("WebSocket hub is closed")
+
+// wsConn is a WebSocket connection managed by hub
+type wsConn struct {
+	conn      *websocket.Conn
+	principal *Principal
+	// send queues messages for the writing goroutine
+	send chan []byte
+
+	closeOnce   sync.Once
+	closed      chan struct{}
+	closeCode   int
+	closeReason string
+}
+
+// close asks the writing goroutine to send close frame then close the connection,
+// it's safe to call it many times, only the first one counts.
+func (c *wsConn) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		c.closeCode = code
+		c.closeReason = reason
+		close(c.closed)
+	})
+}
+
+// WebSocketHub manages WebSocket connections in rooms.
+//
+// Messages published to a room reach its members on every instance through Redis pub/sub,
+// each instance subscribes channels of rooms having local members only.
+// Without Redis, messages reach local members only.
+type WebSocketHub struct {
+	logger *zap.Logger
+	metric *metric.Collector
+	redis  *redis.Client
+
+	mu     sync.Mutex
+	conns  map[*wsConn]map[string]bool
+	rooms  map[string]map[*wsConn]struct{}
+	closed bool
+
+	// subMu serializes Redis subscription changes
+	subMu      sync.Mutex
+	pubsub     *redis.PubSub
+	subscribed map[string]bool
+}
+
+// NewWebSocketHub creates a hub, red and collector can be nil.
+func NewWebSocketHub(red *cache.Cache, collector *metric.Collector, logger *zap.Logger) (hub *WebSocketHub) {
+	if collector == nil {
+		collector = metric.NewNopCollector()
+	}
+
+	hub = &WebSocketHub{
+		logger:     logger,
+		metric:     collector,
+		conns:      make(map[*wsConn]map[string]bool),
+		rooms:      make(map[string]map[*wsConn]struct{}),
+		subscribed: make(map[string]bool),
+	}
+
+	if red != nil {
+		hub.redis = red.Redis
+		// channels are subscribed on demand
+		hub.pubsub = red.Redis.Subscribe(context.Background())
+		go hub.receive(hub.pubsub.Channel())
+	}
+
+	return
+}
+
+// register adds conn to hub
+func (h *WebSocketHub) register(conn *wsConn) (err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.closed {
+		err = errWebSocketHubClosed
+		return
+	}
+
+	h.conns[conn] = make(map[string]bool)
+	h.metric.Set(metric.WebSocketConnections, len(h.conns))
+	return
+}
+
+// unregister removes conn from hub and its rooms
+func (h *WebSocketHub) unregister(conn *wsConn) {
+	h.mu.Lock()
+	rooms := h.conns[conn]
+	delete(h.conns, conn)
+	for room := range rooms {
+		h.removeMember(room, conn)
+	}
+	h.metric.Set(metric.WebSocketConnections, len(h.conns))
+	h.mu.Unlock()
+
+	for room := range rooms {
+		h.syncSubscription(room)
+	}
+}
+
+// join adds conn to room
+func (h *WebSocketHub) join(conn *wsConn, room string) {
+	h.mu.Lock()
+	rooms, ok := h.conns[conn]
+	if ok {
+		rooms[room] = true
+		if h.rooms[room] == nil {
+			h.rooms[room] = make(map[*wsConn]struct{})
+		}
+		h.rooms[room][conn] = struct{}{}
+	}
+	h.mu.Unlock()
+
+	h.syncSubscription(room)
+}
+
+// leave removes conn from room
+func (h *WebSocketHub) leave(conn *wsConn, room string) {
+	h.mu.Lock()
+	if rooms, ok := h.conns[conn]; ok {
+		delete(rooms, room)
+	}
+	h.removeMember(room, conn)
+	h.mu.Unlock()
+
+	h.syncSubscription(room)
+}
+
+// joined tells whether conn is a member of room
+func (h *WebSocketHub) joined(conn *wsConn, room string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.conns[conn][room]
+}
+
+// removeMember must be called with mu held
+func (h *WebSocketHub) removeMember(room string, conn *wsConn) {
+	members := h.rooms[room]
+	delete(members, conn)
+	if len(members) == 0 {
+		delete(h.rooms, room)
+	}
+}
+
+// syncSubscription subscribes or unsubscribes Redis channel of room by whether it has local members
+func (h *WebSocketHub) syncSubscription(room string) {
+	if h.pubsub == nil {
+		return
+	}
+
+	h.subMu.Lock()
+	defer h.subMu.Unlock()
+
+	h.mu.Lock()
+	want := len(h.rooms[room]) > 0 && !h.closed
+	h.mu.Unlock()
+	if want == h.subscribed[room] {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var err error
+	if want {
+		err = h.pubsub.Subscribe(ctx, wsRoomChannelPrefix+room)
+	} else {
+		err = h.pubsub.Unsubscribe(ctx, wsRoomChannelPrefix+room)
+	}
+	if err != nil {
+		h.logger.Error("changing WebSocket room subscription",
+			zap.String("room", room),
+			zap.Bool("subscribe", want),
+			zap.Error(err),
+		)
+		return
+	}
+
+	if want {
+		h.subscribed[room] = true
+	} else {
+		delete(h.subscribed, room)
+	}
+}
+
+// publish sends message to room members on every instance
+func (h *WebSocketHub) publish(ctx context.Context, room string, message *wsMessage) (err error) {
+	payload, err := json.Marshal(message)
+	if err != nil {
+		err = fmt.Errorf("json.Marshal: %w", err)
+		return
+	}
+
+	if h.redis == nil {
+		h.deliver(room, payload)
+		return
+	}
+
+	err = h.redis.Publish(ctx, wsRoomChannelPrefix+room, payload).Err()
+	if err != nil {
+		err = fmt.Errorf("redis PUBLISH: %w", err)
+		return
+	}
+
+	return
+}
+
+// receive delivers messages from Redis until pubsub is closed
+func (h *WebSocketHub) receive(messages <-chan *redis.Message) {
+	for message := range messages {
+		h.deliver(strings.TrimPrefix(message.Channel, wsRoomChannelPrefix), []byte(message.Payload))
+	}
+}
+
+// deliver queues payload to local members of room,
+// members whose queue is full are disconnected rather than slowing down others.
+func (h *WebSocketHub) deliver(room string, payload []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for conn := range h.rooms[room] {
+		select {
+		case conn.send <- payload:
+			h.metric.Incr(metric.WebSocketMessagesTotal, stats.T("direction", "out"))
+		default:
+			h.logger.Warn("WebSocket connection falls behind, disconnecting",
+				zap.String("room", room),
+				zap.String("principal", conn.principal.ID),
+			)
+			conn.close(websocket.CloseTryAgainLater, "too slow to keep up")
+		}
+	}
+}
+
+// Close disconnects all connections and rejects new ones,
+// hijacked connections are not waited by server shutdown, so call it before shutting down.
+func (h *WebSocketHub) Close() {
+	h.mu.Lock()
+	h.closed = true
+	for conn := range h.conns {
+		conn.close(websocket.CloseGoingAway, "server is shutting down")
+	}
+	h.mu.Unlock()
+
+	if h.pubsub != nil {
+		h.subMu.Lock()
+		defer h.subMu.Unlock()
+
+		if err := h.pubsub.Close(); err != nil {
+			h.logger.Warn("closing WebSocket pubsub", zap.Error(err))
+		}
+		// nothing is subscribed on a closed pubsub
+		h.subscribed = make(map[string]bool)
+	}
+}
@@ -0,0 +1,179 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"telescope/errorcode"
+	"telescope/metric"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestController_WebSocket(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	con := &Controller{
+		Logger: zap.NewNop(),
+		Metric: metric.NewNopCollector(),
+		WebSocketConfig: WebSocketConfig{
+			Rooms:         []WebSocketRoom{{Name: "chat:*"}, {Name: "admin", Permission: "admin:chat"}},
+			SendQueueSize: 4,
+		}.withDefaults(),
+		// messages reach local members only without Redis
+		WebSocketHub: NewWebSocketHub(nil, nil, zap.NewNop()),
+	}
+	g := gin.New()
+	g.Use(func(c *gin.Context) {
+		c.Set(ctxPrincipalKey, &Principal{ID: c.Query("user")})
+		// no permission
+		c.Set(ctxPermissionsKey, PermissionSet{})
+	})
+	g.GET("/ws", con.WebSocket)
+	server := httptest.NewServer(g)
+	defer server.Close()
+
+	dial := func(user string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws?user=" + user
+		dialer := websocket.Dialer{Subprotocols: []string{wsSubprotocol}}
+		conn, resp, err := dialer.Dial(url, nil)
+		require.NoError(t, err)
+		assert.Equal(t, wsSubprotocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+		return conn
+	}
+	send := func(conn *websocket.Conn, message string) {
+		require.NoError(t, conn.WriteMessage(websocket.TextMessage, []byte(message)))
+	}
+	receive := func(conn *websocket.Conn) (message wsMessage) {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(3*time.Second)))
+		require.NoError(t, conn.ReadJSON(&message))
+		return
+	}
+
+	alice := dial("alice")
+	defer alice.Close()
+	bob := dial("bob")
+	defer bob.Close()
+
+	send(alice, `{"type": "join", "room": "chat:1"}`)
+	assert.Equal(t, wsMessage{Type: wsTypeJoined, Room: "chat:1"}, receive(alice))
+	send(bob, `{"type": "join", "room": "chat:1"}`)
+	assert.Equal(t, wsMessage{Type: wsTypeJoined, Room: "chat:1"}, receive(bob))
+
+	send(alice, `{"type": "publish", "room": "chat:1", "data": {"text": "hi"}}`)
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		message := receive(conn)
+		assert.Equal(t, wsTypeMessage, message.Type)
+		assert.Equal(t, "alice", message.From)
+		assert.JSONEq(t, `{"text": "hi"}`, string(message.Data))
+	}
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			message  string
+			wantCode int
+		}{
+			{message: `not JSON`, wantCode: errorcode.CodeBadBinding},
+			{message: `{"type": "dance", "room": "chat:1"}`, wantCode: errorcode.CodeValidationFailed},
+			{message: `{"type": "join"}`, wantCode: errorcode.CodeValidationFailed},
+			{message: `{"type": "join", "room": "chat:"}`, wantCode: errorcode.CodeUnknownTopic},
+			{message: `{"type": "join", "room": "admin"}`, wantCode: errorcode.CodeForbidden},
+			{message: `{"type": "publish", "room": "chat:2", "data": 1}`, wantCode: errorcode.CodeForbidden},
+		}
+		for _, tt := range tests {
+			send(bob, tt.message)
+			message := receive(bob)
+			assert.Equal(t, wsTypeError, message.Type, tt.message)
+			assert.Equal(t, tt.wantCode, message.Code, tt.message)
+			assert.NotEmpty(t, message.Msg, tt.message)
+		}
+	})
+
+	t.Run("leave", func(t *testing.T) {
+		send(bob, `{"type": "leave", "room": "chat:1"}`)
+		assert.Equal(t, wsMessage{Type: wsTypeLeft, Room: "chat:1"}, receive(bob))
+
+		send(alice, `{"type": "publish", "room": "chat:1", "data": 2}`)
+		assert.JSONEq(t, `2`, string(receive(alice).Data))
+		send(bob, `{"type": "publish", "room": "chat:1", "data": 3}`)
+		assert.Equal(t, errorcode.CodeForbidden, receive(bob).Code)
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		con.WebSocketHub.Close()
+
+		require.NoError(t, alice.SetReadDeadline(time.Now().Add(3*time.Second)))
+		_, _, err := alice.ReadMessage()
+		assert.True(t, websocket.IsCloseError(err, websocket.CloseGoingAway), err)
+	})
+}
+
+func TestController_checkWebSocketOrigin(t *testing.T) {
+	cors, err := NewCORS(CORSConfig{
+		Default: CORSPolicy{AllowOrigins: []string{"https://app.example.com"}},
+	}, func() gin.RoutesInfo { return nil })
+	require.NoError(t, err)
+	con := &Controller{cors: cors}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{origin: "", want: true},
+		{origin: "https://api.example.com", want: true},
+		{origin: "https://app.example.com", want: true},
+		{origin: "https://evil.example.com", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "https://api.example.com/api/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			assert.Equal(t, tt.want, con.checkWebSocketOrigin(r))
+		})
+	}
+}
+
+func Test_credentialOf(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		testName string
+		header   map[string]string
+		want     string
+	}{
+		{testName: "bearer", header: map[string]string{"Authorization": "Bearer abc"}, want: "abc"},
+		{testName: "token", header: map[string]string{tokenHeader: "abc"}, want: "abc"},
+		{
+			testName: "WebSocket subprotocol",
+			header: map[string]string{
+				"Connection":             "Upgrade",
+				"Upgrade":                "websocket",
+				"Sec-WebSocket-Protocol": wsSubprotocol + ", " + wsTokenProtocolPrefix + "abc",
+			},
+			want: "abc",
+		},
+		{
+			testName: "subprotocol without upgrade",
+			header:   map[string]string{"Sec-WebSocket-Protocol": wsTokenProtocolPrefix + "abc"},
+			want:     "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/ws", nil)
+			for k, v := range tt.header {
+				c.Request.Header.Set(k, v)
+			}
+			assert.Equal(t, tt.want, credentialOf(c))
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// APIKey is a static credential for machine clients.
+//
+// Only the hash of key is stored.
+type APIKey struct {
+	tableName struct{} `pg:"api_keys"`
+
+	ID int64
+	// Name tells who holds the key
+	Name string `pg:",notnull"`
+	// KeyHash is hex encoded SHA-256 of the key
+	KeyHash string   `pg:",notnull,unique"`
+	Roles   []string `pg:",array"`
+	// ExpiresAt zero value means never expires
+	ExpiresAt time.Time
+	// RevokedAt zero value means not revoked
+	RevokedAt time.Time
+	CreatedAt time.Time `pg:"default:now(),notnull"`
+}
+
+// Usable tells whether the key can be used at the moment
+func (k *APIKey) Usable(now time.Time) bool {
+	if !k.RevokedAt.IsZero() {
+		return false
+	}
+	if !k.ExpiresAt.IsZero() && now.After(k.ExpiresAt) {
+		return false
+	}
+
+	return true
+}
+
+// APIKeyByHash finds API key by its hash.
+//
+// key is nil if there's no such key.
+func (op Operator) APIKeyByHash(ctx context.Context, keyHash string) (key *APIKey, err error) {
+	key = new(APIKey)
+	err = op.core.ModelContext(ctx, key).
+		Where("key_hash = ?", keyHash).
+		Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		key = nil
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("selecting API key: %w", err)
+		return
+	}
+
+	return
+}
+
+// CreateAPIKey saves a new API key, key.ID is filled after creating.
+func (op Operator) CreateAPIKey(ctx context.Context, key *APIKey) (err error) {
+	_, err = op.core.ModelContext(ctx, key).Insert()
+	if err != nil {
+		err = fmt.Errorf("inserting API key: %w", err)
+		return
+	}
+
+	return
+}
+
+// RevokeAPIKey revokes API key by its ID
+func (op Operator) RevokeAPIKey(ctx context.Context, id int64) (err error) {
+	_, err = op.core.ModelContext(ctx, (*APIKey)(nil)).
+		Set("revoked_at = now()").
+		Where("id = ?", id).
+		Where("revoked_at IS NULL").
+		Update()
+	if err != nil {
+		err = fmt.Errorf("revoking API key: %w", err)
+		return
+	}
+
+	return
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AuditRecord is an API call kept for compliance,
+// bodies are redacted before they get here.
+type AuditRecord struct {
+	tableName struct{} `pg:"audit_records"`
+
+	ID        int64  `json:"id"`
+	RequestID string `json:"requestID"`
+	// Principal is ID of user or API key, empty for anonymous callers
+	Principal string `json:"principal"`
+	Method    string `pg:",notnull" json:"method"`
+	// Route is the route template like /api/users/:id, empty if no route matched
+	Route        string  `json:"route"`
+	Path         string  `pg:",notnull" json:"path"`
+	Status       int     `pg:",notnull,use_zero" json:"status"`
+	LatencyMs    float64 `pg:",notnull,use_zero" json:"latencyMs"`
+	ClientIP     string  `json:"clientIP"`
+	RequestBody  string  `json:"requestBody,omitempty"`
+	ResponseBody string  `json:"responseBody,omitempty"`
+	// CreatedAt is when the request came in
+	CreatedAt time.Time `pg:"default:now(),notnull" json:"createdAt"`
+}
+
+// AuditRecordFilter narrows down QueryAuditRecords, zero value fields are ignored.
+type AuditRecordFilter struct {
+	Principal string
+	// From is inclusive
+	From time.Time
+	// To is exclusive
+	To time.Time
+	// BeforeID pages backwards, pass ID of the last record of previous page
+	BeforeID int64
+	Limit    int
+}
+
+// InsertAuditRecords saves records in one statement
+func (op Operator) InsertAuditRecords(ctx context.Context, records []*AuditRecord) (err error) {
+	if len(records) == 0 {
+		return
+	}
+
+	_, err = op.core.ModelContext(ctx, &records).Insert()
+	if err != nil {
+		err = fmt.Errorf("inserting audit records: %w", err)
+		return
+	}
+
+	return
+}
+
+// QueryAuditRecords lists records matching filter, the latest first.
+func (op Operator) QueryAuditRecords(ctx context.Context, filter AuditRecordFilter) (records []AuditRecord, err error) {
+	query := op.core.ModelContext(ctx, &records).
+		Order("id DESC").
+		Limit(filter.Limit)
+	if filter.Principal != "" {
+		query = query.Where("principal = ?", filter.Principal)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.BeforeID > 0 {
+		query = query.Where("id < ?", filter.BeforeID)
+	}
+
+	err = query.Select()
+	if err != nil {
+		err = fmt.Errorf("selecting audit records: %w", err)
+		return
+	}
+
+	return
+}
+
+// PruneAuditRecords deletes records created before the time
+func (op Operator) PruneAuditRecords(ctx context.Context, before time.Time) (deleted int, err error) {
+	result, err := op.core.ModelContext(ctx, (*AuditRecord)(nil)).
+		Where("created_at < ?", before).
+		Delete()
+	if err != nil {
+		err = fmt.Errorf("deleting audit records: %w", err)
+		return
+	}
+
+	deleted = result.RowsAffected()
+	return
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+)
+
+const (
+	// cacheInvalidationFunction is the trigger function shared by all tables
+	cacheInvalidationFunction = "telescope_notify_cache_invalidation"
+	// cacheInvalidationTrigger trigger names are scoped to table, so one name is enough
+	cacheInvalidationTrigger = "telescope_cache_invalidation"
+	// defaultIDColumn is used when idColumn is not specified
+	defaultIDColumn = "id"
+)
+
+// cacheInvalidationFunctionSQL notifies channel TG_ARGV[0] with a JSON payload like
+//
+//	{"table": "users", "op": "UPDATE", "ids": ["42"]}
+//
+// ids holds the value of column TG_ARGV[1] of both the old and the new row,
+// which is what cache.Invalidator expects.
+//
+// Note: no question mark is allowed here since go-pg treats it as placeholder.
+const cacheInvalidationFunctionSQL = `CREATE OR REPLACE FUNCTION ` + cacheInvalidationFunction + `() RETURNS trigger AS $$
+DECLARE
+	id_column text := coalesce(TG_ARGV[1], '` + defaultIDColumn + `');
+	old_id text;
+	new_id text;
+	ids text[] := ARRAY[]::text[];
+BEGIN
+	IF TG_OP IN ('UPDATE', 'DELETE') THEN
+		old_id := to_jsonb(OLD) ->> id_column;
+		IF old_id IS NOT NULL THEN
+			ids := array_append(ids, old_id);
+		END IF;
+	END IF;
+	IF TG_OP IN ('INSERT', 'UPDATE') THEN
+		new_id := to_jsonb(NEW) ->> id_column;
+		IF new_id IS NOT NULL AND new_id IS DISTINCT FROM old_id THEN
+			ids := array_append(ids, new_id);
+		END IF;
+	END IF;
+
+	PERFORM pg_notify(TG_ARGV[0], json_build_object(
+		'table', TG_TABLE_NAME,
+		'op', TG_OP,
+		'ids', ids
+	)::text);
+
+	RETURN NULL;
+END;
+$$ LANGUAGE plpgsql`
+
+// CacheInvalidationMigration returns SQL statements which install(up) and remove(down)
+// a trigger on table, notifying channel with changed row ids after every INSERT, UPDATE and DELETE.
+//
+// Run up statements in order inside a migration, cache.Invalidator listening on channel
+// turns these notifications into cache revoking.
+//
+// idColumn defaults to "id".
+func CacheInvalidationMigration(table, channel, idColumn string) (up []string, down []string) {
+	if idColumn == "" {
+		idColumn = defaultIDColumn
+	}
+
+	formatter := orm.NewFormatter()
+	format := func(query string, params ...interface{}) string {
+		return string(formatter.FormatQuery(nil, query, params...))
+	}
+
+	up = []string{
+		cacheInvalidationFunctionSQL,
+		format("DROP TRIGGER IF EXISTS ? ON ?", pg.Ident(cacheInvalidationTrigger), pg.Ident(table)),
+		// EXECUTE PROCEDURE rather than EXECUTE FUNCTION, which requires Postgres 11+
+		format("CREATE TRIGGER ? AFTER INSERT OR UPDATE OR DELETE ON ? FOR EACH ROW EXECUTE PROCEDURE "+cacheInvalidationFunction+"(?, ?)",
+			pg.Ident(cacheInvalidationTrigger), pg.Ident(table), channel, idColumn),
+	}
+
+	// the function is shared among tables, so leave it alone.
+	down = []string{
+		format("DROP TRIGGER IF EXISTS ? ON ?", pg.Ident(cacheInvalidationTrigger), pg.Ident(table)),
+	}
+
+	return
+}
+
+// InstallCacheInvalidationTrigger installs cache invalidation trigger on table.
+// It's safe to run it multiple times.
+//
+// Use it inside RunInTransaction to make it atomic.
+func (op Operator) InstallCacheInvalidationTrigger(ctx context.Context, table, channel, idColumn string) (err error) {
+	up, _ := CacheInvalidationMigration(table, channel, idColumn)
+	for _, query := range up {
+		_, err = op.core.ExecContext(ctx, query)
+		if err != nil {
+			err = fmt.Errorf("op.core.ExecContext: %w", err)
+			return
+		}
+	}
+
+	return
+}
+
+// DropCacheInvalidationTrigger removes cache invalidation trigger from table.
+func (op Operator) DropCacheInvalidationTrigger(ctx context.Context, table string) (err error) {
+	_, down := CacheInvalidationMigration(table, "", "")
+	for _, query := range down {
+		_, err = op.core.ExecContext(ctx, query)
+		if err != nil {
+			err = fmt.Errorf("op.core.ExecContext: %w", err)
+			return
+		}
+	}
+
+	return
+}
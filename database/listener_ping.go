@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// listenerPingChannel carries PingListener round trips
+const listenerPingChannel = "telescope_listener_ping"
+
+// PingListener checks the listener started by Watch with a NOTIFY round trip,
+// since a broken listener reconnects silently and drops notifications meanwhile.
+//
+// It returns nil if Watch has never been called, as there's nothing to check.
+func (db *DB) PingListener(ctx context.Context) (err error) {
+	if !db.listenerStarted.Load() {
+		return
+	}
+
+	err = db.watchPing(ctx)
+	if err != nil {
+		err = fmt.Errorf("watching ping channel: %w", err)
+		return
+	}
+
+	token, err := pingToken()
+	if err != nil {
+		err = fmt.Errorf("generating ping token: %w", err)
+		return
+	}
+
+	received := make(chan struct{})
+	db.pingWaiterMu.Lock()
+	db.pingWaiters[token] = received
+	db.pingWaiterMu.Unlock()
+
+	defer func() {
+		db.pingWaiterMu.Lock()
+		delete(db.pingWaiters, token)
+		db.pingWaiterMu.Unlock()
+	}()
+
+	err = db.Notify(ctx, listenerPingChannel, token)
+	if err != nil {
+		err = fmt.Errorf("db.Notify: %w", err)
+		return
+	}
+
+	select {
+	case <-received:
+	case <-ctx.Done():
+		err = fmt.Errorf("waiting for notification: %w", ctx.Err())
+	}
+
+	return
+}
+
+// watchPing subscribes ping channel once, retrying on later calls if it fails.
+func (db *DB) watchPing(ctx context.Context) (err error) {
+	db.pingWatchMu.Lock()
+	defer db.pingWatchMu.Unlock()
+
+	if db.pingWatching {
+		return
+	}
+
+	db.pingWaiterMu.Lock()
+	if db.pingWaiters == nil {
+		db.pingWaiters = make(map[string]chan struct{})
+	}
+	db.pingWaiterMu.Unlock()
+
+	err = db.Watch(ctx, db.receivePing, listenerPingChannel)
+	if err != nil {
+		return
+	}
+	db.pingWatching = true
+
+	return
+}
+
+// receivePing wakes up the waiting PingListener.
+// Tokens from other instances sharing the database are ignored.
+func (db *DB) receivePing(_ context.Context, notify pg.Notification) {
+	db.pingWaiterMu.Lock()
+	defer db.pingWaiterMu.Unlock()
+
+	received, ok := db.pingWaiters[notify.Payload]
+	if !ok {
+		return
+	}
+	close(received)
+	delete(db.pingWaiters, notify.Payload)
+}
+
+func pingToken() (token string, err error) {
+	b := make([]byte, 12)
+	_, err = rand.Read(b)
+	if err != nil {
+		return
+	}
+
+	token = hex.EncodeToString(b)
+	return
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"telescope/logging"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+	"go.uber.org/zap"
+)
+
+// queryLogHook logs queries with logger carried by context,
+// so that they can be told apart by request ID.
+type queryLogHook struct {
+	// verbose logs every query at debug level
+	verbose bool
+	// slowThreshold queries taking longer are logged at warn level, 0 disables it.
+	slowThreshold time.Duration
+}
+
+var _ pg.QueryHook = (*queryLogHook)(nil)
+
+func (h *queryLogHook) BeforeQuery(ctx context.Context, _ *pg.QueryEvent) (context.Context, error) {
+	return ctx, nil
+}
+
+func (h *queryLogHook) AfterQuery(ctx context.Context, event *pg.QueryEvent) error {
+	var (
+		lapse  = time.Since(event.StartTime)
+		failed = event.Err != nil && !errors.Is(event.Err, pg.ErrNoRows)
+		slow   = h.slowThreshold > 0 && lapse > h.slowThreshold
+	)
+
+	if !failed && !slow && !h.verbose {
+		return nil
+	}
+
+	// unformatted query keeps parameters, which may be sensitive, out of logs.
+	query, err := event.UnformattedQuery()
+	if err != nil {
+		query = []byte(err.Error())
+	}
+
+	logger := logging.FromContext(ctx)
+	fields := []zap.Field{
+		zap.ByteString("query", query),
+		zap.Duration("lapse", lapse),
+	}
+
+	switch {
+	case failed:
+		logger.Error("query failed", append(fields, zap.Error(event.Err))...)
+	case slow:
+		logger.Warn("slow query", fields...)
+	default:
+		logger.Debug("query", fields...)
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"fmt"
+)
+
+// RolePermission grants Permission to Role
+type RolePermission struct {
+	tableName struct{} `pg:"role_permissions"`
+
+	ID         int64
+	Role       string `pg:"unique:role_permission,notnull"`
+	Permission string `pg:"unique:role_permission,notnull"`
+}
+
+// PermissionsOfRole lists permissions granted to role
+func (op Operator) PermissionsOfRole(ctx context.Context, role string) (permissions []string, err error) {
+	err = op.core.ModelContext(ctx, (*RolePermission)(nil)).
+		Column("permission").
+		Where("role = ?", role).
+		Order("permission").
+		Select(&permissions)
+	if err != nil {
+		err = fmt.Errorf("selecting permissions of role: %w", err)
+		return
+	}
+
+	return
+}
+
+// GrantPermission grants permission to role, granting twice is not an error.
+func (op Operator) GrantPermission(ctx context.Context, role, permission string) (err error) {
+	_, err = op.core.ModelContext(ctx, &RolePermission{
+		Role:       role,
+		Permission: permission,
+	}).OnConflict("DO NOTHING").Insert()
+	if err != nil {
+		err = fmt.Errorf("inserting role permission: %w", err)
+		return
+	}
+
+	return
+}
+
+// RevokePermission revokes permission from role
+func (op Operator) RevokePermission(ctx context.Context, role, permission string) (err error) {
+	_, err = op.core.ModelContext(ctx, (*RolePermission)(nil)).
+		Where("role = ?", role).
+		Where("permission = ?", permission).
+		Delete()
+	if err != nil {
+		err = fmt.Errorf("deleting role permission: %w", err)
+		return
+	}
+
+	return
+}
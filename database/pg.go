@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/go-pg/pg/v10/orm"
+	"go.uber.org/atomic"
 
 	"github.com/go-pg/pg/v10"
 )
@@ -18,6 +19,10 @@ type PostgresConfig struct {
 	User         string
 	Password     string
 	DatabaseName string
+	// LogQueries logs every query at debug level
+	LogQueries bool
+	// SlowQueryMilliseconds queries taking longer are logged at warn level, 0 disables it.
+	SlowQueryMilliseconds int
 }
 
 // Operator is where database access/write methods implemented
@@ -46,8 +51,16 @@ type DB struct {
 	// Listener and callbacks
 	listenerOnce    sync.Once
 	listener        *pg.Listener
+	listenerStarted atomic.Bool
+	listenerClosed  atomic.Bool
 	topicCallbackMu sync.RWMutex
 	topicCallbacks  map[string][]func(context.Context, pg.Notification)
+
+	// listener round trip
+	pingWatchMu  sync.Mutex
+	pingWatching bool
+	pingWaiterMu sync.Mutex
+	pingWaiters  map[string]chan struct{}
 }
 
 // RunInTransaction runs a function in a transaction.
@@ -70,6 +83,13 @@ func NewPostgres(ctx context.Context, dsn PostgresConfig) (db *DB, err error) {
 		Database:        dsn.DatabaseName,
 		ApplicationName: version.FullName,
 	})
+	postgres.AddQueryHook(&queryTraceHook{
+		databaseName: dsn.DatabaseName,
+	})
+	postgres.AddQueryHook(&queryLogHook{
+		verbose:       dsn.LogQueries,
+		slowThreshold: time.Duration(dsn.SlowQueryMilliseconds) * time.Millisecond,
+	})
 
 	err = postgres.Ping(ctx)
 	if err != nil {
@@ -87,6 +107,17 @@ func NewPostgres(ctx context.Context, dsn PostgresConfig) (db *DB, err error) {
 	return
 }
 
+// Ping checks the connection to database
+func (db *DB) Ping(ctx context.Context) (err error) {
+	err = db.pg.Ping(ctx)
+	if err != nil {
+		err = fmt.Errorf("postgres.Ping: %w", err)
+		return
+	}
+
+	return
+}
+
 // Notify sends a message
 func (op Operator) Notify(ctx context.Context, topic string, payload string) (err error) {
 	_, err = op.core.ExecContext(ctx, "NOTIFY ?, ?", pg.Ident(topic), payload)
@@ -106,16 +137,29 @@ func (db *DB) Listen(ctx context.Context, topic ...string) (channel <-chan pg.No
 	return
 }
 
+// CloseListener stops callbacks registered by Watch from receiving notifications,
+// it's fine to call it before Close, which closes listener as well.
+func (db *DB) CloseListener() (err error) {
+	if !db.listenerStarted.Load() || !db.listenerClosed.CAS(false, true) {
+		return
+	}
+
+	err = db.listener.Close()
+	if err != nil {
+		err = fmt.Errorf("db.listener.Close: %w", err)
+		return
+	}
+
+	return
+}
+
 // Close closes the database client, releasing any open resources.
 func (db *DB) Close() (errs []error) {
-	if db.listener != nil {
-		err := db.listener.Close()
-		if err != nil {
-			err = fmt.Errorf("db.listener.Close: %w", err)
-			errs = append(errs, err)
-		}
+	err := db.CloseListener()
+	if err != nil {
+		errs = append(errs, err)
 	}
-	err := db.pg.Close()
+	err = db.pg.Close()
 	if err != nil {
 		err = fmt.Errorf("db.pg.Close: %w", err)
 		errs = append(errs, err)
@@ -132,6 +176,7 @@ func (db *DB) Watch(ctx context.Context, callback func(context.Context, pg.Notif
 		db.listener = db.pg.Listen(ctx, topic...)
 		db.topicCallbacks = make(map[string][]func(context.Context, pg.Notification))
 		go db.watch()
+		db.listenerStarted.Store(true)
 	})
 
 	// It's ok to listen to the same topic for several times.
@@ -111,3 +111,101 @@ func TestDB_WatchAndNotify(t *testing.T) {
 	require.Equal(t, int64(2), cb2.Load())
 	require.Equal(t, int64(3), cb1.Load())
 }
+
+func TestOperator_AuditRecords(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// twice, CreateTables must be idempotent
+	require.NoError(t, db.CreateTables(ctx))
+	require.NoError(t, db.CreateTables(ctx))
+
+	var indexNames []string
+	_, err := db.pg.QueryContext(ctx, &indexNames, `SELECT indexname FROM pg_indexes WHERE tablename = ?`, "audit_records")
+	require.NoError(t, err)
+	assert.Contains(t, indexNames, "audit_records_created_at_idx")
+	assert.Contains(t, indexNames, "audit_records_principal_created_at_idx")
+
+	// IDs start from 1 again
+	_, err = db.pg.ExecContext(ctx, `TRUNCATE audit_records RESTART IDENTITY`)
+	require.NoError(t, err)
+
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	err = db.InsertAuditRecords(ctx, []*AuditRecord{
+		{Principal: "alice", Method: "GET", Path: "/api/whoami", Status: 200, CreatedAt: base},
+		{Principal: "bob", Method: "GET", Path: "/api/whoami", Status: 200, CreatedAt: base.Add(time.Hour)},
+		{Principal: "alice", Method: "POST", Path: "/api/uploads", Status: 413, CreatedAt: base.Add(2 * time.Hour)},
+		{Principal: "alice", Method: "DELETE", Path: "/api/session", Status: 200, CreatedAt: base.Add(3 * time.Hour)},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		testName string
+		filter   AuditRecordFilter
+		wantIDs  []int64
+	}{
+		{
+			testName: "all, the latest first",
+			filter:   AuditRecordFilter{},
+			wantIDs:  []int64{4, 3, 2, 1},
+		},
+		{
+			testName: "principal",
+			filter:   AuditRecordFilter{Principal: "alice"},
+			wantIDs:  []int64{4, 3, 1},
+		},
+		{
+			testName: "from inclusive, to exclusive",
+			filter:   AuditRecordFilter{From: base.Add(time.Hour), To: base.Add(3 * time.Hour)},
+			wantIDs:  []int64{3, 2},
+		},
+		{
+			testName: "before ID",
+			filter:   AuditRecordFilter{BeforeID: 3},
+			wantIDs:  []int64{2, 1},
+		},
+		{
+			testName: "limit",
+			filter:   AuditRecordFilter{Limit: 2},
+			wantIDs:  []int64{4, 3},
+		},
+		{
+			testName: "next page of principal",
+			filter:   AuditRecordFilter{Principal: "alice", BeforeID: 3, Limit: 2},
+			wantIDs:  []int64{1},
+		},
+		{
+			testName: "nothing matches",
+			filter:   AuditRecordFilter{Principal: "carol"},
+			wantIDs:  []int64{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			records, err := db.QueryAuditRecords(ctx, tt.filter)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantIDs, auditRecordIDs(records))
+		})
+	}
+
+	deleted, err := db.PruneAuditRecords(ctx, base.Add(2*time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, 2, deleted)
+
+	records, err := db.QueryAuditRecords(ctx, AuditRecordFilter{})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 3}, auditRecordIDs(records))
+
+	deleted, err = db.PruneAuditRecords(ctx, base)
+	require.NoError(t, err)
+	assert.Equal(t, 0, deleted)
+}
+
+func auditRecordIDs(records []AuditRecord) (ids []int64) {
+	ids = make([]int64, 0, len(records))
+	for _, record := range records {
+		ids = append(ids, record.ID)
+	}
+
+	return
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10/orm"
+)
+
+// models are tables managed by CreateTables,
+// append new model here when introducing one.
+var models = []interface{}{
+	(*APIKey)(nil),
+	(*User)(nil),
+	(*RolePermission)(nil),
+	(*AuditRecord)(nil),
+}
+
+// columns are added by CreateTables to tables created before the columns were introduced,
+// keep them idempotent.
+var columns = []string{
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1`,
+}
+
+// indexes are created by CreateTables after tables, keep them idempotent.
+var indexes = []string{
+	`CREATE INDEX IF NOT EXISTS audit_records_created_at_idx ON audit_records (created_at)`,
+	`CREATE INDEX IF NOT EXISTS audit_records_principal_created_at_idx ON audit_records (principal, created_at)`,
+}
+
+// CreateTables creates tables of models, their columns and indexes if they don't exist.
+//
+// Use it inside RunInTransaction to make it atomic.
+func (op Operator) CreateTables(ctx context.Context) (err error) {
+	for _, model := range models {
+		err = op.core.ModelContext(ctx, model).CreateTable(&orm.CreateTableOptions{
+			IfNotExists:   true,
+			FKConstraints: true,
+		})
+		if err != nil {
+			err = fmt.Errorf("creating table for %T: %w", model, err)
+			return
+		}
+	}
+
+	for _, column := range columns {
+		_, err = op.core.ExecContext(ctx, column)
+		if err != nil {
+			err = fmt.Errorf("adding column: %w", err)
+			return
+		}
+	}
+
+	for _, index := range indexes {
+		_, err = op.core.ExecContext(ctx, index)
+		if err != nil {
+			err = fmt.Errorf("creating index: %w", err)
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"telescope/tracing"
+
+	"github.com/go-pg/pg/v10"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = tracing.Tracer("telescope/database")
+
+// queryTraceHook starts a client span for each query
+type queryTraceHook struct {
+	// databaseName recorded as db.name
+	databaseName string
+}
+
+var _ pg.QueryHook = (*queryTraceHook)(nil)
+
+func (h *queryTraceHook) BeforeQuery(ctx context.Context, event *pg.QueryEvent) (context.Context, error) {
+	if !trace.SpanFromContext(ctx).IsRecording() {
+		// no trace to join, e.g. queries at startup
+		return ctx, nil
+	}
+
+	// unformatted query keeps parameters, which may be sensitive, out of traces.
+	query, err := event.UnformattedQuery()
+	if err != nil {
+		query = []byte(err.Error())
+	}
+	operation := queryOperation(query)
+
+	ctx, _ = tracer.Start(ctx, operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBNameKey.String(h.databaseName),
+			semconv.DBOperationKey.String(operation),
+			semconv.DBStatementKey.String(string(query)),
+		),
+	)
+
+	return ctx, nil
+}
+
+func (h *queryTraceHook) AfterQuery(ctx context.Context, event *pg.QueryEvent) error {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return nil
+	}
+	defer span.End()
+
+	if event.Result != nil {
+		span.SetAttributes(attribute.Int("db.rows_affected", event.Result.RowsAffected()))
+	}
+	if event.Err != nil && !errors.Is(event.Err, pg.ErrNoRows) {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+
+	return nil
+}
+
+// queryOperation is the first keyword of query, e.g. SELECT
+func queryOperation(query []byte) string {
+	query = bytes.TrimSpace(query)
+	if end := bytes.IndexAny(query, " \t\r\n("); end > 0 {
+		query = query[:end]
+	}
+	if len(query) == 0 {
+		return "query"
+	}
+
+	return string(bytes.ToUpper(query))
+}
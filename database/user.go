@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-pg/pg/v10"
+)
+
+// User is a human who logs in with username and password
+type User struct {
+	tableName struct{} `pg:"users"`
+
+	ID       int64
+	Username string `pg:",notnull,unique"`
+	// PasswordHash is bcrypt hash of password
+	PasswordHash string   `pg:",notnull"`
+	Roles        []string `pg:",array"`
+	// DisabledAt zero value means the user is active
+	DisabledAt time.Time
+	// Version increases on every update, for optimistic concurrency
+	Version   int64     `pg:"default:1,notnull"`
+	CreatedAt time.Time `pg:"default:now(),notnull"`
+}
+
+// UserByID finds user by id.
+//
+// user is nil if there's no such user.
+func (op Operator) UserByID(ctx context.Context, id int64) (user *User, err error) {
+	user = new(User)
+	err = op.core.ModelContext(ctx, user).
+		Where("id = ?", id).
+		Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		user = nil
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("selecting user: %w", err)
+		return
+	}
+
+	return
+}
+
+// UserByUsername finds user by username.
+//
+// user is nil if there's no such user.
+func (op Operator) UserByUsername(ctx context.Context, username string) (user *User, err error) {
+	user = new(User)
+	err = op.core.ModelContext(ctx, user).
+		Where("username = ?", username).
+		Select()
+	if errors.Is(err, pg.ErrNoRows) {
+		user = nil
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("selecting user: %w", err)
+		return
+	}
+
+	return
+}
+
+// CreateUser saves a new user, user.ID is filled after creating.
+func (op Operator) CreateUser(ctx context.Context, user *User) (err error) {
+	_, err = op.core.ModelContext(ctx, user).Insert()
+	if err != nil {
+		err = fmt.Errorf("inserting user: %w", err)
+		return
+	}
+
+	return
+}
+
+// UpdateUserRoles replaces roles of user by id if the user is still of version,
+// which increases by one on success.
+//
+// updated is false if there's no such user or the user has been changed since version.
+func (op Operator) UpdateUserRoles(ctx context.Context, id, version int64, roles []string) (updated bool, err error) {
+	result, err := op.core.ModelContext(ctx, (*User)(nil)).
+		Set("roles = ?", pg.Array(roles)).
+		Set("version = version + 1").
+		Where("id = ?", id).
+		Where("version = ?", version).
+		Update()
+	if err != nil {
+		err = fmt.Errorf("updating roles of user: %w", err)
+		return
+	}
+
+	updated = result.RowsAffected() > 0
+	return
+}
@@ -1,6 +1,11 @@
 package errorcode
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
 
 const (
 	// CodeGeneralError normal or unclassified error
@@ -8,32 +13,154 @@ const (
 
 	// CodeBadBinding binding failed
 	CodeBadBinding = 600001
+	// CodeInvalidCSRFToken CSRF token is missing or does not match the session
+	CodeInvalidCSRFToken = 600002
+	// CodeValidationFailed request is well-formed but some fields are invalid,
+	// details tell which and why.
+	CodeValidationFailed = 600003
+	// CodeInvalidIdempotencyKey Idempotency-Key header is malformed
+	CodeInvalidIdempotencyKey = 600004
+	// CodeIdempotencyKeyReused Idempotency-Key is reused by a different request
+	CodeIdempotencyKeyReused = 600005
+	// CodeIdempotencyKeyInFlight a request with the same Idempotency-Key is being processed
+	CodeIdempotencyKeyInFlight = 600006
+	// CodePreconditionFailed If-Match or If-Unmodified-Since does not hold
+	CodePreconditionFailed = 600007
+	// CodeUnknownTopic event topic is not exposed
+	CodeUnknownTopic = 600008
+	// CodePayloadTooLarge request body exceeds the limit of the route
+	CodePayloadTooLarge = 600009
+	// CodeServiceOverloaded too many requests are in progress, the request is shed
+	CodeServiceOverloaded = 600010
+	// CodeRequestTimeout the request is not finished before its deadline
+	CodeRequestTimeout = 600011
+	// CodeUserNotFound user of the ID does not exist
+	CodeUserNotFound = 600012
 	// CodeUnauthorized stands for invalid token,
 	// which is an umbrella error exposed to public
 	CodeUnauthorized = 600401
+	// CodeForbidden the caller is known but lacks permission
+	CodeForbidden = 600403
 )
 
 var (
+	// ErrGeneral normal or unclassified error, responded with status 200 for historical reasons
+	ErrGeneral = Register(http.StatusOK, CodeGeneralError, "Something went wrong",
+		"Unclassified error, the message tells what happened.")
+	// ErrBadBinding request body can not be decoded
+	ErrBadBinding = Register(http.StatusBadRequest, CodeBadBinding, "Malformed request body",
+		"Request body is empty, or is not valid JSON.")
+	// ErrValidationFailed request is well-formed but some fields are invalid
+	ErrValidationFailed = Register(http.StatusUnprocessableEntity, CodeValidationFailed, "Validation failed",
+		"Some fields are invalid, details list the field path, the failed rule and a message for each.")
 	// ErrUnauthorized stands for invalid token, which is an umbrella error exposed to public
-	ErrUnauthorized = newError(http.StatusForbidden, CodeUnauthorized, "Unauthorized")
+	ErrUnauthorized = Register(http.StatusUnauthorized, CodeUnauthorized, "Unauthorized",
+		"Credential is missing, invalid, expired or revoked.")
+	// ErrForbidden the caller is known but lacks permission
+	ErrForbidden = Register(http.StatusForbidden, CodeForbidden, "Forbidden",
+		"The caller is authenticated but lacks permission for the action.")
+	// ErrInvalidCSRFToken CSRF token is missing or does not match the session
+	ErrInvalidCSRFToken = Register(http.StatusForbidden, CodeInvalidCSRFToken, "Invalid CSRF Token",
+		"Unsafe request authenticated by session cookie lacks a matching X-CSRF-Token header.")
+	// ErrInvalidIdempotencyKey Idempotency-Key header is malformed
+	ErrInvalidIdempotencyKey = Register(http.StatusBadRequest, CodeInvalidIdempotencyKey, "Invalid Idempotency-Key",
+		"Idempotency-Key header is longer than 255 characters.")
+	// ErrIdempotencyKeyReused Idempotency-Key is reused by a different request
+	ErrIdempotencyKeyReused = Register(http.StatusUnprocessableEntity, CodeIdempotencyKeyReused, "Idempotency-Key is reused",
+		"The Idempotency-Key was used by a request with another method, path or body, use a new key for a new request.")
+	// ErrIdempotencyKeyInFlight a request with the same Idempotency-Key is being processed
+	ErrIdempotencyKeyInFlight = Register(http.StatusConflict, CodeIdempotencyKeyInFlight, "Request with the same Idempotency-Key is in progress",
+		"The original request is still being processed, retry after a while to get its response.")
+	// ErrPreconditionFailed If-Match or If-Unmodified-Since does not hold
+	ErrPreconditionFailed = Register(http.StatusPreconditionFailed, CodePreconditionFailed, "Precondition failed",
+		"The resource has been changed since the version in If-Match or If-Unmodified-Since, read it again before updating.")
+	// ErrUnknownTopic event topic is not exposed
+	ErrUnknownTopic = Register(http.StatusBadRequest, CodeUnknownTopic, "Unknown topic {topic}",
+		"The event topic to subscribe does not exist.")
+	// ErrPayloadTooLarge request body exceeds the limit of the route
+	ErrPayloadTooLarge = Register(http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body is larger than {limit} bytes",
+		"Request body exceeds the size limit of the route, which differs among routes.")
+	// ErrServiceOverloaded too many requests are in progress, the request is shed
+	ErrServiceOverloaded = Register(http.StatusServiceUnavailable, CodeServiceOverloaded, "Service is overloaded",
+		"Too many requests are in progress, the request is rejected without processing. Retry after seconds told by Retry-After.")
+	// ErrRequestTimeout the request is not finished before its deadline
+	ErrRequestTimeout = Register(http.StatusGatewayTimeout, CodeRequestTimeout, "Request timed out",
+		"The request is not finished before the deadline of the route, it may or may not take effect.")
+	// ErrUserNotFound user of the ID does not exist
+	ErrUserNotFound = Register(http.StatusNotFound, CodeUserNotFound, "User not found",
+		"There's no user of the ID.")
+)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[int]*Error)
 )
 
+// Register registers an error code, usually in package level var declarations.
+// message is in English, it may have placeholders like "{name}" filled by WithParams,
+// while description tells API users when it happens.
+//
+// Register panics if code is taken, so that code collision fails at init.
+func Register(statusCode, code int, message, description string) *Error {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if existing, ok := registry[code]; ok {
+		panic(fmt.Sprintf("errorcode: code %d is registered twice, first as %q then %q", code, existing.message, message))
+	}
+
+	e := &Error{
+		statusCode:  statusCode,
+		code:        code,
+		message:     message,
+		description: description,
+	}
+	registry[code] = e
+
+	return e
+}
+
+// Lookup finds registered error by code
+func Lookup(code int) (e *Error, ok bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	e, ok = registry[code]
+	return
+}
+
+// Registered lists registered errors ordered by code
+func Registered() (errs []*Error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	errs = make([]*Error, 0, len(registry))
+	for _, e := range registry {
+		errs = append(errs, e)
+	}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].code < errs[j].code
+	})
+
+	return
+}
+
 // Error standard API error
 type Error struct {
 	// http status code
 	statusCode int
 	// business layer code
-	code    int
+	code int
+	// message in English, used when catalog has no message for code
 	message string
-}
-
-// newError create a new API error
-func newError(statusCode, code int, message string) *Error {
-	return &Error{
-		statusCode: statusCode,
-		code:       code,
-		message:    message,
-	}
+	// description for API docs
+	description string
+	// params fill placeholders in message
+	params map[string]string
+	// cause is the underlying error, which is never exposed to API users
+	cause error
+	// details exposed to API users along with message
+	details []interface{}
 }
 
 // Code returns error code
@@ -46,7 +173,73 @@ func (e *Error) StatusCode() int {
 	return e.statusCode
 }
 
+// Description tells API users when it happens
+func (e *Error) Description() string {
+	return e.description
+}
+
+// Details returns details attached by WithDetails
+func (e *Error) Details() []interface{} {
+	return e.details
+}
+
+// WithParams returns a copy of e whose message placeholders like "{name}" are filled with params
+func (e *Error) WithParams(params map[string]string) *Error {
+	copied := *e
+	copied.params = make(map[string]string, len(e.params)+len(params))
+	for k, v := range e.params {
+		copied.params[k] = v
+	}
+	for k, v := range params {
+		copied.params[k] = v
+	}
+
+	return &copied
+}
+
+// Wrap returns a copy of e caused by cause,
+// cause shows in logs and errors.Is/As but not in API response.
+func (e *Error) Wrap(cause error) *Error {
+	copied := *e
+	copied.cause = cause
+
+	return &copied
+}
+
+// WithDetails returns a copy of e with details appended, which are responded along with message.
+func (e *Error) WithDetails(details ...interface{}) *Error {
+	copied := *e
+	copied.details = append(append([]interface{}(nil), e.details...), details...)
+
+	return &copied
+}
+
+// Message returns message in English with params filled, without cause
+func (e *Error) Message() string {
+	return fillParams(e.message, e.params)
+}
+
 // Error implements error interface
 func (e *Error) Error() string {
-	return e.message
+	if e.cause != nil {
+		return e.Message() + ": " + e.cause.Error()
+	}
+
+	return e.Message()
+}
+
+// Unwrap returns the cause
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is reports errors with the same code as equal,
+// so that errors.Is(err, ErrForbidden) holds for ErrForbidden.Wrap(cause).
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+
+	return e.code == t.code
 }
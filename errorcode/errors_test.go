@@ -0,0 +1,65 @@
+package errorcode
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegister(t *testing.T) {
+	assert.PanicsWithValue(t,
+		`errorcode: code 600403 is registered twice, first as "Forbidden" then "Forbidden again"`,
+		func() {
+			Register(http.StatusForbidden, CodeForbidden, "Forbidden again", "")
+		})
+
+	e, ok := Lookup(CodeUnauthorized)
+	require.True(t, ok)
+	assert.Same(t, ErrUnauthorized, e)
+
+	registered := Registered()
+	for i := 1; i < len(registered); i++ {
+		assert.Less(t, registered[i-1].Code(), registered[i].Code())
+	}
+}
+
+func TestError_Wrap(t *testing.T) {
+	cause := errors.New("role table is gone")
+	err := fmt.Errorf("checking permission: %w", ErrForbidden.Wrap(cause))
+
+	assert.True(t, errors.Is(err, ErrForbidden))
+	assert.True(t, errors.Is(err, cause))
+	assert.False(t, errors.Is(err, ErrUnauthorized))
+
+	var apiErr *Error
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "Forbidden: role table is gone", apiErr.Error())
+	assert.Equal(t, "Forbidden", apiErr.Message())
+	assert.Nil(t, ErrForbidden.Unwrap(), "registered error must stay untouched")
+}
+
+func TestError_WithDetails(t *testing.T) {
+	first := ErrForbidden.WithDetails("missing user:write")
+	second := first.WithDetails("missing user:delete")
+
+	assert.Empty(t, ErrForbidden.Details())
+	assert.Equal(t, []interface{}{"missing user:write"}, first.Details())
+	assert.Equal(t, []interface{}{"missing user:write", "missing user:delete"}, second.Details())
+}
+
+func TestWriteMarkdown(t *testing.T) {
+	var buf bytes.Buffer
+	err := WriteMarkdown(&buf, []Entry{
+		{Code: 42, StatusCode: http.StatusTooManyRequests, Message: "Quota exceeded", Description: "Too many | requests"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "| Code | HTTP Status | Message | Description |\n"+
+		"| ---: | --- | --- | --- |\n"+
+		"| 42 | 429 Too Many Requests | Quota exceeded | Too many \\| requests |\n", buf.String())
+}
@@ -0,0 +1,87 @@
+package errorcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Entry describes a registered error for API docs
+type Entry struct {
+	Code        int    `json:"code"`
+	StatusCode  int    `json:"statusCode"`
+	Message     string `json:"message"`
+	Description string `json:"description"`
+	// Messages localized by catalog, keyed by language
+	Messages map[string]string `json:"messages,omitempty"`
+}
+
+// Entries lists registered errors ordered by code,
+// with messages localized in every language catalog supports.
+func Entries(catalog *Catalog) (entries []Entry) {
+	var tags []language.Tag
+	if catalog != nil {
+		catalog.mu.RLock()
+		tags = append(tags, catalog.tags...)
+		catalog.mu.RUnlock()
+	}
+
+	for _, e := range Registered() {
+		entry := Entry{
+			Code:        e.code,
+			StatusCode:  e.statusCode,
+			Message:     e.message,
+			Description: e.description,
+		}
+		if len(tags) > 0 {
+			entry.Messages = make(map[string]string, len(tags))
+			for _, tag := range tags {
+				entry.Messages[tag.String()] = catalog.Localize(tag, e)
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return
+}
+
+// WriteJSON writes entries as an indented JSON array
+func WriteJSON(w io.Writer, entries []Entry) (err error) {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(entries)
+	if err != nil {
+		err = fmt.Errorf("encoding JSON: %w", err)
+		return
+	}
+
+	return
+}
+
+// WriteMarkdown writes entries as a Markdown table
+func WriteMarkdown(w io.Writer, entries []Entry) (err error) {
+	var b strings.Builder
+	b.WriteString("| Code | HTTP Status | Message | Description |\n")
+	b.WriteString("| ---: | --- | --- | --- |\n")
+	for _, entry := range entries {
+		fmt.Fprintf(&b, "| %d | %d %s | %s | %s |\n",
+			entry.Code,
+			entry.StatusCode,
+			http.StatusText(entry.StatusCode),
+			markdownCell(entry.Message),
+			markdownCell(entry.Description),
+		)
+	}
+
+	_, err = io.WriteString(w, b.String())
+	return
+}
+
+// markdownCell escapes what breaks a table row
+func markdownCell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
@@ -0,0 +1,226 @@
+package errorcode
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/text/language"
+)
+
+// ValidationMessagePrefix prefixes message IDs of validation rules, e.g. "validation.required"
+const ValidationMessagePrefix = "validation."
+
+//go:embed locales
+var embeddedLocales embed.FS
+
+// DefaultCatalog holds embedded messages, with English as fallback.
+var DefaultCatalog = mustLoadDefaultCatalog()
+
+func mustLoadDefaultCatalog() *Catalog {
+	catalog := NewCatalog(language.English)
+	err := catalog.Load(embeddedLocales, "locales")
+	if err != nil {
+		panic(fmt.Sprintf("errorcode: loading embedded locales: %s", err))
+	}
+
+	return catalog
+}
+
+// catalogFile is the layout of a locale file, in TOML or JSON
+type catalogFile struct {
+	// Codes messages keyed by error code
+	Codes map[string]string `json:"codes"`
+	// Validation messages keyed by validation rule
+	Validation map[string]string `json:"validation"`
+}
+
+// Catalog holds messages in several languages, use NewCatalog to create one.
+//
+// Message IDs are error codes like "600401",
+// or validation rules prefixed with ValidationMessagePrefix like "validation.required".
+// "{name}" in messages is replaced with parameter of that name.
+type Catalog struct {
+	fallback language.Tag
+
+	mu       sync.RWMutex
+	messages map[language.Tag]map[string]string
+	// tags supported, fallback first
+	tags    []language.Tag
+	matcher language.Matcher
+}
+
+// NewCatalog creates an empty Catalog, messages not found are looked up in fallback language.
+func NewCatalog(fallback language.Tag) *Catalog {
+	catalog := &Catalog{
+		fallback: fallback,
+		messages: make(map[language.Tag]map[string]string),
+	}
+	catalog.addLanguage(fallback)
+
+	return catalog
+}
+
+// Fallback language
+func (c *Catalog) Fallback() language.Tag {
+	return c.fallback
+}
+
+// Load loads every locale file in dir of fsys, named after its language,
+// e.g. "en.toml", "zh-TW.json".
+func (c *Catalog) Load(fsys fs.FS, dir string) (err error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		err = fmt.Errorf("fs.ReadDir: %w", err)
+		return
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		ext := path.Ext(name)
+		if ext != ".toml" && ext != ".json" {
+			continue
+		}
+
+		var tag language.Tag
+		tag, err = language.Parse(strings.TrimSuffix(name, ext))
+		if err != nil {
+			err = fmt.Errorf("language of %s: %w", name, err)
+			return
+		}
+
+		var content []byte
+		content, err = fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			err = fmt.Errorf("fs.ReadFile: %w", err)
+			return
+		}
+
+		var file catalogFile
+		if ext == ".json" {
+			err = json.Unmarshal(content, &file)
+		} else {
+			_, err = toml.Decode(string(content), &file)
+		}
+		if err != nil {
+			err = fmt.Errorf("decoding %s: %w", name, err)
+			return
+		}
+
+		for code, message := range file.Codes {
+			if _, err = strconv.Atoi(code); err != nil {
+				err = fmt.Errorf("%s: code %q is not a number", name, code)
+				return
+			}
+			c.Set(tag, code, message)
+		}
+		for rule, message := range file.Validation {
+			c.Set(tag, ValidationMessagePrefix+rule, message)
+		}
+	}
+
+	return
+}
+
+// Set sets message of id in language tag
+func (c *Catalog) Set(tag language.Tag, id, message string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.addLanguage(tag)
+	c.messages[tag][id] = message
+}
+
+// addLanguage requires c.mu being held, or c being not shared yet.
+func (c *Catalog) addLanguage(tag language.Tag) {
+	if _, ok := c.messages[tag]; ok {
+		return
+	}
+
+	c.messages[tag] = make(map[string]string)
+	c.tags = append(c.tags, tag)
+	c.matcher = language.NewMatcher(c.tags)
+}
+
+// Negotiate picks the best supported language for Accept-Language header value,
+// or the fallback language if nothing matches.
+func (c *Catalog) Negotiate(acceptLanguage string) language.Tag {
+	if acceptLanguage == "" {
+		return c.fallback
+	}
+
+	wanted, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(wanted) == 0 {
+		return c.fallback
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	_, index, confidence := c.matcher.Match(wanted...)
+	if confidence == language.No {
+		return c.fallback
+	}
+
+	return c.tags[index]
+}
+
+// Message looks up message of id in tag, then its parents, e.g. zh-Hant-TW, zh-Hant, zh,
+// and at last the fallback language.
+func (c *Catalog) Message(tag language.Tag, id string, params map[string]string) (message string, found bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for t := tag; ; t = t.Parent() {
+		if message, found = c.messages[t][id]; found {
+			break
+		}
+		if t == language.Und {
+			break
+		}
+	}
+	if !found {
+		message, found = c.messages[c.fallback][id]
+	}
+	if !found {
+		return
+	}
+
+	message = fillParams(message, params)
+	return
+}
+
+// Localize returns message of err in tag, or the built-in message of err if the catalog has none.
+// Cause of err is never included.
+func (c *Catalog) Localize(tag language.Tag, err *Error) string {
+	message, found := c.Message(tag, strconv.Itoa(err.code), err.params)
+	if !found {
+		return err.Message()
+	}
+
+	return message
+}
+
+// fillParams replaces "{name}" with value of params[name]
+func fillParams(message string, params map[string]string) string {
+	if len(params) == 0 {
+		return message
+	}
+
+	oldNew := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		oldNew = append(oldNew, "{"+name+"}", value)
+	}
+
+	return strings.NewReplacer(oldNew...).Replace(message)
+}
@@ -0,0 +1,94 @@
+package errorcode
+
+import (
+	"net/http"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func TestCatalog_Negotiate(t *testing.T) {
+	tests := []struct {
+		acceptLanguage string
+		want           language.Tag
+	}{
+		{acceptLanguage: "", want: language.English},
+		{acceptLanguage: "en-US,en;q=0.9", want: language.English},
+		{acceptLanguage: "zh-CN,zh;q=0.9,en;q=0.8", want: language.Chinese},
+		{acceptLanguage: "zh-TW", want: language.Chinese},
+		{acceptLanguage: "fr-FR,zh;q=0.5", want: language.Chinese},
+		{acceptLanguage: "fr-FR", want: language.English},
+		{acceptLanguage: "not a language;;", want: language.English},
+	}
+	for _, tt := range tests {
+		t.Run(tt.acceptLanguage, func(t *testing.T) {
+			if got := DefaultCatalog.Negotiate(tt.acceptLanguage); got != tt.want {
+				t.Errorf("Negotiate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCatalog_Message(t *testing.T) {
+	catalog := NewCatalog(language.English)
+	err := catalog.Load(fstest.MapFS{
+		"locales/en.toml": {Data: []byte(`
+[codes]
+"42" = "Quota of {name} exceeded"
+"43" = "Only in English"
+[validation]
+required = "{field} is required"
+`)},
+		"locales/zh.json": {Data: []byte(`{"codes": {"42": "{name} 配额已用完"}}`)},
+		"locales/README":  {Data: []byte(`ignored`)},
+	}, "locales")
+	require.NoError(t, err)
+
+	zhCN := language.MustParse("zh-Hans-CN")
+	tests := []struct {
+		testName  string
+		tag       language.Tag
+		id        string
+		want      string
+		wantFound bool
+	}{
+		{testName: "exact", tag: language.Chinese, id: "42", want: "files 配额已用完", wantFound: true},
+		{testName: "parent", tag: zhCN, id: "42", want: "files 配额已用完", wantFound: true},
+		{testName: "fallback", tag: zhCN, id: "43", want: "Only in English", wantFound: true},
+		{testName: "traditional is not simplified", tag: language.MustParse("zh-Hant-TW"), id: "42", want: "Quota of files exceeded", wantFound: true},
+		{testName: "unsupported", tag: language.French, id: "42", want: "Quota of files exceeded", wantFound: true},
+		{testName: "validation", tag: language.Chinese, id: ValidationMessagePrefix + "required", want: "files is required", wantFound: true},
+		{testName: "missing", tag: language.English, id: "44", want: "", wantFound: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			got, found := catalog.Message(tt.tag, tt.id, map[string]string{"name": "files", "field": "files"})
+			assert.Equal(t, tt.wantFound, found)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCatalog_Localize(t *testing.T) {
+	catalog := NewCatalog(language.English)
+	catalog.Set(language.Chinese, "42", "{name} 配额已用完")
+
+	err := (&Error{
+		statusCode: http.StatusTooManyRequests,
+		code:       42,
+		message:    "Quota of {name} exceeded",
+	}).WithParams(map[string]string{"name": "files"})
+	assert.Equal(t, "files 配额已用完", catalog.Localize(language.Chinese, err))
+	// built-in message when catalog has none
+	assert.Equal(t, "Quota of files exceeded", catalog.Localize(language.English, err))
+	assert.Equal(t, "Quota of files exceeded", err.Error())
+
+	// Chinese catalog covers every code
+	for _, apiErr := range Registered() {
+		assert.Equal(t, apiErr.Error(), DefaultCatalog.Localize(language.English, apiErr))
+		assert.NotEqual(t, apiErr.Error(), DefaultCatalog.Localize(language.Chinese, apiErr))
+	}
+}
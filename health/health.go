@@ -0,0 +1,260 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultTimeout  = time.Second
+	defaultCacheTTL = time.Second
+)
+
+// statuses
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusShuttingDown = "shutting down"
+)
+
+// Kind of check
+type Kind int
+
+const (
+	// Readiness checks decide whether the instance should receive traffic,
+	// usually on dependencies like database.
+	Readiness Kind = iota
+	// Liveness checks decide whether the instance should be restarted,
+	// they are also part of readiness.
+	Liveness
+)
+
+// Config config on health checks
+type Config struct {
+	// TimeoutMilliseconds of one check unless specified on registering, defaults to 1000
+	TimeoutMilliseconds int
+	// CacheMilliseconds how long a check result is reused, defaults to 1000
+	CacheMilliseconds int
+}
+
+// Checker reports a problem by returning an error
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckerFunc adapts a function to Checker
+type CheckerFunc func(ctx context.Context) error
+
+// Check calls f(ctx)
+func (f CheckerFunc) Check(ctx context.Context) error {
+	return f(ctx)
+}
+
+// Check to register
+type Check struct {
+	// Name is unique among checks, e.g. "postgres"
+	Name string
+	Kind Kind
+	// Timeout of one run, defaults to Config.TimeoutMilliseconds
+	Timeout time.Duration
+	Checker Checker
+}
+
+// Result of a check
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Lapse how long the check took, in milliseconds
+	Lapse     float64   `json:"lapse"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report of checks
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Healthy tells whether the report is good
+func (r Report) Healthy() bool {
+	return r.Status == StatusOK
+}
+
+// registeredCheck guards its cached result
+type registeredCheck struct {
+	Check
+
+	mu        sync.Mutex
+	result    Result
+	expiresAt time.Time
+}
+
+// Registry holds checks and runs them, use NewRegistry to create one.
+type Registry struct {
+	timeout  time.Duration
+	cacheTTL time.Duration
+
+	mu     sync.RWMutex
+	checks []*registeredCheck
+
+	shuttingDown atomic.Bool
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry(config Config) *Registry {
+	registry := &Registry{
+		timeout:  time.Duration(config.TimeoutMilliseconds) * time.Millisecond,
+		cacheTTL: time.Duration(config.CacheMilliseconds) * time.Millisecond,
+	}
+	if registry.timeout <= 0 {
+		registry.timeout = defaultTimeout
+	}
+	if registry.cacheTTL <= 0 {
+		registry.cacheTTL = defaultCacheTTL
+	}
+
+	return registry
+}
+
+// Register adds a check, it panics if the name is empty or already taken.
+func (r *Registry) Register(check Check) {
+	if check.Name == "" {
+		panic("health: check name is empty")
+	}
+	if check.Checker == nil {
+		panic(fmt.Sprintf("health: check %q has nil Checker", check.Name))
+	}
+	if check.Timeout <= 0 {
+		check.Timeout = r.timeout
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.checks {
+		if existing.Name == check.Name {
+			panic(fmt.Sprintf("health: check %q registered twice", check.Name))
+		}
+	}
+	r.checks = append(r.checks, &registeredCheck{Check: check})
+	sort.Slice(r.checks, func(i, j int) bool {
+		return r.checks[i].Name < r.checks[j].Name
+	})
+}
+
+// Shutdown makes readiness fail from now on,
+// so that load balancers stop sending traffic while in-flight requests finish.
+func (r *Registry) Shutdown() {
+	r.shuttingDown.Store(true)
+}
+
+// Liveness runs liveness checks
+func (r *Registry) Liveness() Report {
+	return r.run(func(check *registeredCheck) bool {
+		return check.Kind == Liveness
+	})
+}
+
+// Readiness runs all checks, and fails once Shutdown is called.
+func (r *Registry) Readiness() Report {
+	if r.shuttingDown.Load() {
+		return Report{Status: StatusShuttingDown}
+	}
+
+	return r.run(func(*registeredCheck) bool {
+		return true
+	})
+}
+
+// run runs selected checks concurrently
+func (r *Registry) run(selected func(check *registeredCheck) bool) (report Report) {
+	r.mu.RLock()
+	var checks []*registeredCheck
+	for _, check := range r.checks {
+		if selected(check) {
+			checks = append(checks, check)
+		}
+	}
+	r.mu.RUnlock()
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	wg.Add(len(checks))
+	for i, check := range checks {
+		go func(i int, check *registeredCheck) {
+			defer wg.Done()
+			results[i] = r.result(check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report.Status = StatusOK
+	report.Checks = make(map[string]Result, len(checks))
+	for i, check := range checks {
+		report.Checks[check.Name] = results[i]
+		if results[i].Status != StatusOK {
+			report.Status = StatusFailing
+		}
+	}
+
+	return
+}
+
+// result returns cached result if it's fresh, or runs the check.
+//
+// Concurrent callers wait for the same run, so that probes can not pile up on dependencies.
+func (r *Registry) result(check *registeredCheck) Result {
+	check.mu.Lock()
+	defer check.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(check.expiresAt) {
+		return check.result
+	}
+
+	// detached from any request, the result is shared
+	ctx, cancel := context.WithTimeout(context.Background(), check.Timeout)
+	defer cancel()
+
+	err := runCheck(ctx, check.Checker)
+	result := Result{
+		Status:    StatusOK,
+		Lapse:     float64(time.Since(now).Microseconds()) / 1000,
+		CheckedAt: now,
+	}
+	if err != nil {
+		result.Status = StatusFailing
+		result.Error = err.Error()
+	}
+
+	check.result = result
+	check.expiresAt = time.Now().Add(r.cacheTTL)
+
+	return result
+}
+
+// runCheck returns on timeout even if checker ignores ctx
+func runCheck(ctx context.Context, checker Checker) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- fmt.Errorf("check panicked: %v", recovered)
+			}
+		}()
+		done <- checker.Check(ctx)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("check timed out: %w", ctx.Err())
+	}
+
+	return
+}
@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry(Config{
+		TimeoutMilliseconds: 50,
+		CacheMilliseconds:   60000,
+	})
+
+	var dbCalls atomic.Int64
+	registry.Register(Check{
+		Name: "process",
+		Kind: Liveness,
+		Checker: CheckerFunc(func(ctx context.Context) error {
+			return nil
+		}),
+	})
+	registry.Register(Check{
+		Name: "db",
+		Kind: Readiness,
+		Checker: CheckerFunc(func(ctx context.Context) error {
+			dbCalls.Inc()
+			return errors.New("connection refused")
+		}),
+	})
+	registry.Register(Check{
+		Name:    "stuck",
+		Kind:    Readiness,
+		Timeout: 10 * time.Millisecond,
+		Checker: CheckerFunc(func(ctx context.Context) error {
+			// ignores ctx
+			time.Sleep(time.Second)
+			return nil
+		}),
+	})
+
+	t.Run("duplicate", func(t *testing.T) {
+		assert.Panics(t, func() {
+			registry.Register(Check{Name: "db", Checker: CheckerFunc(func(context.Context) error { return nil })})
+		})
+	})
+
+	t.Run("liveness", func(t *testing.T) {
+		report := registry.Liveness()
+		assert.True(t, report.Healthy())
+		assert.Len(t, report.Checks, 1)
+		assert.Equal(t, StatusOK, report.Checks["process"].Status)
+	})
+
+	t.Run("readiness", func(t *testing.T) {
+		startedAt := time.Now()
+		report := registry.Readiness()
+		assert.Less(t, time.Since(startedAt), 500*time.Millisecond, "timeout of stuck check should apply")
+
+		assert.False(t, report.Healthy())
+		assert.Equal(t, StatusFailing, report.Status)
+		require.Len(t, report.Checks, 3)
+		assert.Equal(t, StatusOK, report.Checks["process"].Status)
+		assert.Equal(t, "connection refused", report.Checks["db"].Error)
+		assert.Contains(t, report.Checks["stuck"].Error, "timed out")
+	})
+
+	t.Run("cached", func(t *testing.T) {
+		registry.Readiness()
+		assert.EqualValues(t, 1, dbCalls.Load())
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		registry.Shutdown()
+		report := registry.Readiness()
+		assert.Equal(t, StatusShuttingDown, report.Status)
+		assert.False(t, report.Healthy())
+
+		assert.True(t, registry.Liveness().Healthy())
+	})
+}
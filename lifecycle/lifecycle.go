@@ -0,0 +1,284 @@
+package lifecycle
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const defaultPhaseTimeout = 10
+
+// Priority orders hooks, lower ones stop first and start last.
+// Hooks of the same priority form a phase.
+type Priority int
+
+const (
+	// PriorityReadiness fails readiness probes, the drain period is waited after it.
+	PriorityReadiness Priority = 0
+	// PriorityServer stops accepting connections and finishes in-flight requests
+	PriorityServer Priority = 100
+	// PriorityWorker stops background workers, which may still be fed by listeners
+	PriorityWorker Priority = 200
+	// PriorityListener stops notification listeners and pub/sub subscriptions
+	PriorityListener Priority = 300
+	// PriorityStore closes connection pools of Redis and Postgres
+	PriorityStore Priority = 400
+	// PriorityTelemetry flushes metrics and traces, which are produced till the very end
+	PriorityTelemetry Priority = 500
+)
+
+// Config config on starting and stopping
+type Config struct {
+	// DrainSeconds how long to wait after readiness fails before stopping the server,
+	// so that load balancers notice, 0 skips draining.
+	DrainSeconds int
+	// PhaseTimeoutSeconds bounds starting or stopping hooks of each priority, defaults to 10 seconds
+	PhaseTimeoutSeconds int
+}
+
+func (c Config) withDefaults() Config {
+	if c.PhaseTimeoutSeconds <= 0 {
+		c.PhaseTimeoutSeconds = defaultPhaseTimeout
+	}
+
+	return c
+}
+
+func (c Config) phaseTimeout() time.Duration {
+	return time.Duration(c.PhaseTimeoutSeconds) * time.Second
+}
+
+// Hook of a component, both Start and Stop are optional.
+type Hook struct {
+	// Name of component in logs
+	Name     string
+	Priority Priority
+	// Start must not block, run long-living work by Manager.Go.
+	Start func(ctx context.Context) error
+	// Stop should return once ctx is done.
+	Stop func(ctx context.Context) error
+}
+
+// Manager starts components from the highest priority down and stops them from the lowest up,
+// use New to create one.
+type Manager struct {
+	config Config
+	logger *zap.Logger
+
+	signals chan os.Signal
+	// failed receives the first error of routines started by Go
+	failed chan error
+	// shutdown is closed by Shutdown
+	shutdown     chan struct{}
+	shutdownOnce sync.Once
+	// exit is os.Exit, tests replace it
+	exit func(code int)
+
+	mu    sync.Mutex
+	hooks []Hook
+}
+
+// New creates a Manager without hooks
+func New(config Config, logger *zap.Logger) *Manager {
+	return &Manager{
+		config:   config.withDefaults(),
+		logger:   logger,
+		signals:  make(chan os.Signal, 1),
+		failed:   make(chan error, 1),
+		shutdown: make(chan struct{}),
+		exit:     os.Exit,
+	}
+}
+
+// Append registers hook, it panics if the name is empty.
+func (m *Manager) Append(hook Hook) {
+	if hook.Name == "" {
+		panic("lifecycle: hook name is empty")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.hooks = append(m.hooks, hook)
+}
+
+// Go runs fn in a goroutine, shutdown begins if fn returns an error.
+func (m *Manager) Go(name string, fn func() error) {
+	go func() {
+		err := fn()
+		if err == nil {
+			return
+		}
+
+		select {
+		case m.failed <- fmt.Errorf("%s: %w", name, err):
+		default:
+			// shutdown has begun
+			m.logger.Error("component failed", zap.String("component", name), zap.Error(err))
+		}
+	}()
+}
+
+// Shutdown begins shutting down as if a signal is received, it's fine to call it many times.
+func (m *Manager) Shutdown() {
+	m.shutdownOnce.Do(func() {
+		close(m.shutdown)
+	})
+}
+
+// Run starts hooks then blocks until SIGTERM or SIGINT is received, Shutdown is called,
+// or a routine by Go fails, then stops hooks. Receiving signal again while stopping exits the process immediately.
+//
+// err is the one failing start or a routine, errors on stopping are logged.
+func (m *Manager) Run() (err error) {
+	signal.Notify(m.signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(m.signals)
+
+	m.mu.Lock()
+	hooks := make([]Hook, len(m.hooks))
+	copy(hooks, m.hooks)
+	m.mu.Unlock()
+
+	started, err := m.start(hooks)
+	if err != nil {
+		m.logger.Error("starting failed, stopping started ones...", zap.Error(err))
+		m.stop(started, false)
+		return
+	}
+
+	select {
+	case received := <-m.signals:
+		m.logger.Info("received signal, shutting down...", zap.String("signal", received.String()))
+	case err = <-m.failed:
+		m.logger.Error("component failed, shutting down...", zap.Error(err))
+	case <-m.shutdown:
+		m.logger.Info("shutting down as requested...")
+	}
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go m.exitOnSignal(stopped)
+
+	m.stop(started, true)
+	m.logger.Info("shut down")
+	return
+}
+
+// exitOnSignal exits immediately if signal is received before stopped is closed
+func (m *Manager) exitOnSignal(stopped <-chan struct{}) {
+	select {
+	case received := <-m.signals:
+		m.logger.Warn("received signal again, exiting immediately", zap.String("signal", received.String()))
+		m.exit(1)
+	case <-stopped:
+	}
+}
+
+// start runs Start of hooks phase by phase, started are the ones to stop.
+func (m *Manager) start(hooks []Hook) (started []Hook, err error) {
+	phases := byPriority(hooks)
+	for i := len(phases) - 1; i >= 0; i-- {
+		ctx, cancel := context.WithTimeout(context.Background(), m.config.phaseTimeout())
+		for _, hook := range phases[i] {
+			if hook.Start != nil {
+				err = hook.Start(ctx)
+				if err != nil {
+					err = fmt.Errorf("starting %s: %w", hook.Name, err)
+					cancel()
+					return
+				}
+			}
+
+			started = append(started, hook)
+		}
+		cancel()
+	}
+
+	return
+}
+
+// stop runs Stop of hooks phase by phase, hooks in one phase are stopped concurrently.
+// A phase running out of time is left behind.
+func (m *Manager) stop(hooks []Hook, drain bool) {
+	for _, phase := range byPriority(hooks) {
+		if drain && phase[0].Priority > PriorityReadiness {
+			drain = false
+			m.drain()
+		}
+
+		m.stopPhase(phase)
+	}
+}
+
+func (m *Manager) drain() {
+	if m.config.DrainSeconds <= 0 {
+		return
+	}
+
+	m.logger.Info("draining...", zap.Int("seconds", m.config.DrainSeconds))
+	time.Sleep(time.Duration(m.config.DrainSeconds) * time.Second)
+}
+
+func (m *Manager) stopPhase(phase []Hook) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.phaseTimeout())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, hook := range phase {
+		if hook.Stop == nil {
+			continue
+		}
+
+		wg.Add(1)
+		go func(hook Hook) {
+			defer wg.Done()
+
+			err := hook.Stop(ctx)
+			if err != nil {
+				m.logger.Error("stopping failed", zap.String("component", hook.Name), zap.Error(err))
+				return
+			}
+			m.logger.Debug("stopped", zap.String("component", hook.Name))
+		}(hook)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		m.logger.Error("stopping timed out, moving on",
+			zap.Int("priority", int(phase[0].Priority)),
+			zap.Duration("timeout", m.config.phaseTimeout()),
+		)
+	}
+}
+
+// byPriority groups hooks into phases by ascending priority, keeping registration order in phase.
+func byPriority(hooks []Hook) (phases [][]Hook) {
+	sorted := make([]Hook, len(hooks))
+	copy(sorted, hooks)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Priority < sorted[j].Priority
+	})
+
+	for i, hook := range sorted {
+		if i == 0 || hook.Priority != sorted[i-1].Priority {
+			phases = append(phases, nil)
+		}
+		phases[len(phases)-1] = append(phases[len(phases)-1], hook)
+	}
+
+	return
+}
@@ -0,0 +1,172 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// recorder records calls of hooks in order
+type recorder struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (r *recorder) hook(name string, priority Priority) Hook {
+	return Hook{
+		Name:     name,
+		Priority: priority,
+		Start: func(context.Context) error {
+			r.record("start " + name)
+			return nil
+		},
+		Stop: func(context.Context) error {
+			r.record("stop " + name)
+			return nil
+		},
+	}
+}
+
+func (r *recorder) record(call string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls = append(r.calls, call)
+}
+
+func (r *recorder) recorded() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.calls...)
+}
+
+func TestManager_Run(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		testName string
+		trigger  func(m *Manager)
+		wantErr  error
+	}{
+		{
+			testName: "signal",
+			trigger: func(m *Manager) {
+				m.signals <- syscall.SIGTERM
+			},
+		},
+		{
+			testName: "shutdown",
+			trigger: func(m *Manager) {
+				m.Shutdown()
+				m.Shutdown()
+			},
+		},
+		{
+			testName: "routine failure",
+			trigger: func(m *Manager) {
+				m.Go("worker", func() error {
+					return errBoom
+				})
+			},
+			wantErr: errBoom,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			var r recorder
+			m := New(Config{}, zap.NewNop())
+			m.Append(r.hook("postgres", PriorityStore))
+			m.Append(r.hook("server", PriorityServer))
+			m.Append(r.hook("readiness", PriorityReadiness))
+			m.Append(r.hook("tracing", PriorityTelemetry))
+
+			go func() {
+				// started till the last one
+				for len(r.recorded()) < 4 {
+					time.Sleep(time.Millisecond)
+				}
+				tt.trigger(m)
+			}()
+
+			err := m.Run()
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, []string{
+				"start tracing",
+				"start postgres",
+				"start server",
+				"start readiness",
+				"stop readiness",
+				"stop server",
+				"stop postgres",
+				"stop tracing",
+			}, r.recorded())
+		})
+	}
+}
+
+func TestManager_Run_startFailure(t *testing.T) {
+	errBoom := errors.New("port in use")
+
+	var r recorder
+	m := New(Config{}, zap.NewNop())
+	m.Append(r.hook("postgres", PriorityStore))
+	server := r.hook("server", PriorityServer)
+	server.Start = func(context.Context) error {
+		return errBoom
+	}
+	m.Append(server)
+	m.Append(r.hook("readiness", PriorityReadiness))
+
+	err := m.Run()
+	assert.ErrorIs(t, err, errBoom)
+	assert.Equal(t, []string{"start postgres", "stop postgres"}, r.recorded())
+}
+
+func TestManager_stopPhase_timeout(t *testing.T) {
+	var r recorder
+	m := New(Config{PhaseTimeoutSeconds: 1}, zap.NewNop())
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	m.stop([]Hook{
+		{
+			Name:     "stuck",
+			Priority: PriorityWorker,
+			Stop: func(context.Context) error {
+				<-stuck
+				return nil
+			},
+		},
+		r.hook("postgres", PriorityStore),
+	}, false)
+
+	assert.Equal(t, []string{"stop postgres"}, r.recorded())
+}
+
+func TestManager_exitOnSignal(t *testing.T) {
+	m := New(Config{}, zap.NewNop())
+	exited := make(chan int, 1)
+	m.exit = func(code int) {
+		exited <- code
+	}
+
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go m.exitOnSignal(stopped)
+	m.signals <- syscall.SIGINT
+
+	select {
+	case code := <-exited:
+		assert.Equal(t, 1, code)
+	case <-time.After(time.Second):
+		require.Fail(t, "second signal does not exit")
+	}
+}
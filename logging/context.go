@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+type ctxKey int
+
+const (
+	ctxLoggerKey ctxKey = iota
+	ctxRequestIDKey
+)
+
+// WithLogger returns a copy of ctx carrying logger,
+// which is usually request-scoped with fields like request ID.
+func WithLogger(ctx context.Context, logger *zap.Logger) context.Context {
+	return context.WithValue(ctx, ctxLoggerKey, logger)
+}
+
+// FromContext returns logger carried by ctx,
+// or the global logger if there's none.
+func FromContext(ctx context.Context) *zap.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(ctxLoggerKey).(*zap.Logger); ok {
+			return logger
+		}
+	}
+
+	return zap.L()
+}
+
+// WithRequestID returns a copy of ctx carrying request ID
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, ctxRequestIDKey, requestID)
+}
+
+// RequestIDFromContext returns request ID carried by ctx, or empty string if there's none.
+func RequestIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	requestID, _ := ctx.Value(ctxRequestIDKey).(string)
+	return requestID
+}
@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// AuditMessage is the message of API audit log lines, which are sampled by Config.AuditSampling
+const AuditMessage = "APIAuditLog"
+
+// encodings
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+)
+
+const defaultRotationMaxSize = 100
+
+// Config config on logging
+type Config struct {
+	// ProductionMode decides defaults of Level and Encoding,
+	// and logs stacktrace at error level rather than warn.
+	ProductionMode bool
+	// Level is one of debug, info, warn, error, defaults to info in production mode, debug otherwise.
+	Level string
+	// Encoding is "json" or "console", defaults to json in production mode, console otherwise.
+	Encoding string
+	// OutputPaths are "stdout", "stderr" or paths of files, which are rotated by size, defaults to ["stderr"]
+	OutputPaths []string
+	Rotation    RotationConfig
+	// AuditSampling samples APIAuditLog lines, other lines are never sampled
+	AuditSampling SamplingConfig
+}
+
+// RotationConfig config on rotating log files
+type RotationConfig struct {
+	// MaxSizeMB a file is rotated once it's larger than this, defaults to 100 MB
+	MaxSizeMB int
+	// MaxBackups rotated files are kept at most, 0 keeps all
+	MaxBackups int
+	// MaxAgeDays rotated files are removed after this long, 0 keeps them forever
+	MaxAgeDays int
+	// Compress rotated files by gzip
+	Compress bool
+}
+
+// SamplingConfig logs the first Initial lines each second, then every Thereafter-th line in that second.
+type SamplingConfig struct {
+	// Initial 0 turns sampling off
+	Initial int
+	// Thereafter 0 drops the rest in that second
+	Thereafter int
+}
+
+// New builds a logger, whose level can be changed at runtime by level.
+func New(config Config) (logger *zap.Logger, level zap.AtomicLevel, err error) {
+	if config.Level == "" {
+		config.Level = "debug"
+		if config.ProductionMode {
+			config.Level = "info"
+		}
+	}
+	if config.Encoding == "" {
+		config.Encoding = EncodingConsole
+		if config.ProductionMode {
+			config.Encoding = EncodingJSON
+		}
+	}
+	if len(config.OutputPaths) == 0 {
+		config.OutputPaths = []string{"stderr"}
+	}
+	if config.Rotation.MaxSizeMB <= 0 {
+		config.Rotation.MaxSizeMB = defaultRotationMaxSize
+	}
+
+	level = zap.NewAtomicLevel()
+	err = level.UnmarshalText([]byte(config.Level))
+	if err != nil {
+		err = fmt.Errorf("parsing level: %w", err)
+		return
+	}
+
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	if config.ProductionMode {
+		encoderConfig = zap.NewProductionEncoderConfig()
+	}
+	var encoder zapcore.Encoder
+	switch config.Encoding {
+	case EncodingJSON:
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case EncodingConsole:
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		err = fmt.Errorf("unknown encoding %q", config.Encoding)
+		return
+	}
+
+	writers := make([]zapcore.WriteSyncer, 0, len(config.OutputPaths))
+	for _, path := range config.OutputPaths {
+		writers = append(writers, outputOf(path, config.Rotation))
+	}
+
+	var core zapcore.Core = zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(writers...), level)
+	if config.AuditSampling.Initial > 0 {
+		core = newMessageSampler(core, AuditMessage, time.Second, config.AuditSampling)
+	}
+
+	options := []zap.Option{zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr))}
+	if config.ProductionMode {
+		options = append(options, zap.AddStacktrace(zapcore.ErrorLevel))
+	} else {
+		options = append(options, zap.Development(), zap.AddStacktrace(zapcore.WarnLevel))
+	}
+
+	logger = zap.New(core, options...)
+	return
+}
+
+func outputOf(path string, rotation RotationConfig) zapcore.WriteSyncer {
+	switch path {
+	case "stdout":
+		return zapcore.Lock(os.Stdout)
+	case "stderr":
+		return zapcore.Lock(os.Stderr)
+	}
+
+	return zapcore.AddSync(&lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    rotation.MaxSizeMB,
+		MaxBackups: rotation.MaxBackups,
+		MaxAge:     rotation.MaxAgeDays,
+		Compress:   rotation.Compress,
+	})
+}
+
+// messageSampler samples entries of message, leaving others to Core.
+type messageSampler struct {
+	zapcore.Core
+	// sampled wraps Core, counts are shared by its children from With
+	sampled zapcore.Core
+	message string
+}
+
+func newMessageSampler(core zapcore.Core, message string, tick time.Duration, config SamplingConfig) *messageSampler {
+	if config.Thereafter <= 0 {
+		// never reached in a tick
+		config.Thereafter = math.MaxInt32
+	}
+
+	return &messageSampler{
+		Core:    core,
+		sampled: zapcore.NewSamplerWithOptions(core, tick, config.Initial, config.Thereafter),
+		message: message,
+	}
+}
+
+func (s *messageSampler) With(fields []zapcore.Field) zapcore.Core {
+	return &messageSampler{
+		Core:    s.Core.With(fields),
+		sampled: s.sampled.With(fields),
+		message: s.message,
+	}
+}
+
+func (s *messageSampler) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if entry.Message == s.message {
+		return s.sampled.Check(entry, checked)
+	}
+
+	return s.Core.Check(entry, checked)
+}
+
+// WatchLevelSignal toggles level between debug and its current one on SIGUSR1,
+// call stop to stop watching.
+func WatchLevelSignal(level zap.AtomicLevel, logger *zap.Logger) (stop func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1)
+	done := make(chan struct{})
+
+	go func() {
+		// level to restore when toggling back from debug
+		previous := level.Level()
+		if previous == zapcore.DebugLevel {
+			previous = zapcore.InfoLevel
+		}
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-signals:
+				current := level.Level()
+				if current == zapcore.DebugLevel {
+					level.SetLevel(previous)
+				} else {
+					previous = current
+					level.SetLevel(zapcore.DebugLevel)
+				}
+				logger.Info("log level changed by signal", zap.Stringer("level", level.Level()))
+			}
+		}
+	}()
+
+	stop = func() {
+		signal.Stop(signals)
+		close(done)
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		testName  string
+		config    Config
+		wantLevel zapcore.Level
+		wantErr   bool
+	}{
+		{testName: "development", config: Config{}, wantLevel: zapcore.DebugLevel},
+		{testName: "production", config: Config{ProductionMode: true}, wantLevel: zapcore.InfoLevel},
+		{testName: "explicit level", config: Config{ProductionMode: true, Level: "warn"}, wantLevel: zapcore.WarnLevel},
+		{testName: "unknown level", config: Config{Level: "verbose"}, wantErr: true},
+		{testName: "unknown encoding", config: Config{Encoding: "xml"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			logger, level, err := New(tt.config)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, logger)
+			assert.Equal(t, tt.wantLevel, level.Level())
+		})
+	}
+}
+
+func Test_messageSampler(t *testing.T) {
+	tests := []struct {
+		testName string
+		config   SamplingConfig
+		want     int
+	}{
+		{testName: "every third", config: SamplingConfig{Initial: 2, Thereafter: 3}, want: 4},
+		{testName: "drop the rest", config: SamplingConfig{Initial: 2}, want: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			logger := zap.New(newMessageSampler(core, AuditMessage, time.Minute, tt.config))
+
+			for i := 0; i < 8; i++ {
+				// counts are shared by loggers from With, like request-scoped ones
+				logger.With(zap.Int("request", i)).Info(AuditMessage)
+				logger.Info("other")
+			}
+
+			assert.Equal(t, tt.want, logs.FilterMessage(AuditMessage).Len())
+			assert.Equal(t, 8, logs.FilterMessage("other").Len())
+		})
+	}
+}
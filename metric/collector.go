@@ -1,10 +1,15 @@
 package metric
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"math"
+	"net"
 	"net/http"
 	"strings"
+	"telescope/lifecycle"
 	"time"
 
 	"github.com/segmentio/stats/v4"
@@ -12,7 +17,7 @@ import (
 	"github.com/segmentio/stats/v4/prometheus"
 )
 
-// listeningAddr address where metric server listening
+// listeningAddr default address where metric server listening
 const listeningAddr = ":2000"
 
 const sep = "."
@@ -23,6 +28,34 @@ var DefaultSecondBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5,
 // DefaultByteBuckets good for data size
 var DefaultByteBuckets = []float64{1 << 10, 5 << 10, 10 << 10, 25 << 10, 50 << 10, 100 << 10, 250 << 10, 500 << 10, 1 << 20, 2 << 20, 5 << 20}
 
+// Config config on metric collecting
+type Config struct {
+	// Enabled collects metrics and serves them for scraping
+	Enabled bool
+	// Addr where metric server listening, defaults to ":2000"
+	Addr string
+	// Prefix of metric names
+	Prefix string
+	// ProcessStats collects Go runtime and process stats
+	ProcessStats bool
+}
+
+// NewCollector creates a Prometheus Collector with buckets for usual API metrics,
+// or a nop one if config is not enabled.
+func NewCollector(config Config, tag ...stats.Tag) *Collector {
+	if !config.Enabled {
+		return NewNopCollector()
+	}
+
+	buckets := HistogramBuckets{
+		RequestDuration:   DefaultSecondBuckets,
+		RequestSizeBytes:  DefaultByteBuckets,
+		ResponseSizeBytes: DefaultByteBuckets,
+	}
+
+	return NewPrometheusCollector(config.Prefix, buckets, config.ProcessStats, tag...)
+}
+
 // Collector use factory functions to create
 type Collector struct {
 	engine                *stats.Engine
@@ -78,25 +111,72 @@ func (c *Collector) Close() {
 	c.Flush()
 }
 
-// ServeMetrics starts metric server for scape, usually runs in goroutine
+// Register hooks collector on lc, which serves metrics for scrape at addr if it's a Prometheus one,
+// and flushes metrics on stopping. addr defaults to listeningAddr.
 //
-// service is listening at listeningAddr
-func (c *Collector) ServeMetrics() {
-	if c.handler == nil {
-		return
+// Metrics are served till telemetry stops, i.e. during drain and shutdown of others.
+func (c *Collector) Register(lc *lifecycle.Manager, addr string) {
+	var server *http.Server
+	lc.Append(lifecycle.Hook{
+		Name:     "metric",
+		Priority: lifecycle.PriorityTelemetry,
+		Start: func(context.Context) (err error) {
+			if c.handler == nil {
+				return
+			}
+
+			server = newMetricServer(addr, c.handler)
+			listener, err := net.Listen("tcp", server.Addr)
+			if err != nil {
+				err = fmt.Errorf("listening on %s: %w", server.Addr, err)
+				return
+			}
+
+			lc.Go("metric server", func() (err error) {
+				err = server.Serve(listener)
+				// After Shutdown or Close, the returned error is ErrServerClosed.
+				if errors.Is(err, http.ErrServerClosed) {
+					err = nil
+					return
+				}
+
+				err = fmt.Errorf("metric server stopped unexpectedly: %w", err)
+				return
+			})
+			return
+		},
+		Stop: func(ctx context.Context) (err error) {
+			defer c.Close()
+
+			if server == nil {
+				return
+			}
+			err = server.Shutdown(ctx)
+			if err != nil {
+				err = fmt.Errorf("metric server Shutdown: %w", err)
+				return
+			}
+
+			return
+		},
+	})
+}
+
+func newMetricServer(addr string, handler http.Handler) *http.Server {
+	if addr == "" {
+		addr = listeningAddr
 	}
 
 	mux := http.NewServeMux()
-	mux.Handle("/metrics", c.handler)
+	mux.Handle("/metrics", handler)
 
-	server := http.Server{
-		Addr:              listeningAddr,
+	return &http.Server{
+		Addr:              addr,
 		Handler:           mux,
 		ReadTimeout:       2 * time.Second,
 		ReadHeaderTimeout: 1 * time.Second,
 		WriteTimeout:      2 * time.Second,
 	}
-	_ = server.ListenAndServe()
 }
 
 // Incr increments by one the counter identified by name and tags.
@@ -1,10 +1,19 @@
 package metric
 
 import (
+	"context"
+	"io"
+	"net"
+	"net/http"
 	"reflect"
+	"telescope/lifecycle"
 	"testing"
+	"time"
 
 	"github.com/segmentio/stats/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
 func Test_newStatsKey(t *testing.T) {
@@ -86,3 +95,48 @@ func Test_newStatsKey(t *testing.T) {
 		})
 	}
 }
+
+func TestCollector_Register(t *testing.T) {
+	// a free port, which is released for the collector to bind
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := probe.Addr().String()
+	require.NoError(t, probe.Close())
+
+	collector := NewPrometheusCollector("", nil, false)
+	collector.Incr(RequestsTotal)
+	lc := lifecycle.New(lifecycle.Config{}, zap.NewNop())
+	collector.Register(lc, addr)
+
+	// serving starts in background, so we wait for the hook by a hook of lower priority started later
+	started := make(chan struct{})
+	lc.Append(lifecycle.Hook{
+		Name:     "probe",
+		Priority: lifecycle.PriorityReadiness,
+		Start: func(context.Context) error {
+			close(started)
+			return nil
+		},
+	})
+
+	ran := make(chan error, 1)
+	go func() {
+		ran <- lc.Run()
+	}()
+	<-started
+
+	resp, err := http.Get("http://" + addr + "/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), "requests_total")
+
+	lc.Shutdown()
+	require.NoError(t, <-ran)
+
+	// the listener is closed on stopping
+	_, err = net.DialTimeout("tcp", addr, time.Second)
+	assert.Error(t, err)
+}
@@ -0,0 +1,11 @@
+package metric
+
+import "github.com/segmentio/stats/v4"
+
+// NewHandlerCollector creates a Collector reporting to handler,
+// e.g. statstest.Handler which records measures for testing.
+func NewHandlerCollector(handler stats.Handler) *Collector {
+	return &Collector{
+		engine: stats.NewEngine("", handler),
+	}
+}
@@ -0,0 +1,106 @@
+package metric_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"telescope/controller"
+	"telescope/metric"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/segmentio/stats/v4"
+	"github.com/segmentio/stats/v4/statstest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// MetricMiddleware lives in controller, it is tested here
+// where NewHandlerCollector is available without being public API.
+func TestController_MetricMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handler := new(statstest.Handler)
+	con := &controller.Controller{
+		Logger: zap.NewNop(),
+		Metric: metric.NewHandlerCollector(handler),
+	}
+
+	var inFlightInHandler interface{}
+	g := gin.New()
+	g.Use(con.MetricMiddleware())
+	g.GET("/users/:id", func(c *gin.Context) {
+		inFlightInHandler = lastGauge(handler.Measures(), metric.RequestsInFlight)
+		c.String(http.StatusOK, "hello")
+	})
+	g.GET("/boom", func(c *gin.Context) {
+		c.Status(http.StatusInternalServerError)
+	})
+
+	tests := []struct {
+		testName   string
+		path       string
+		wantRoute  string
+		wantStatus string
+	}{
+		{
+			testName:   "route template",
+			path:       "/users/42",
+			wantRoute:  "/users/:id",
+			wantStatus: "2xx",
+		},
+		{
+			testName:   "unmatched",
+			path:       "/users/42/secrets",
+			wantRoute:  "unmatched",
+			wantStatus: "4xx",
+		},
+		{
+			testName:   "server error",
+			path:       "/boom",
+			wantRoute:  "/boom",
+			wantStatus: "5xx",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			handler.Clear()
+			g.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			measures := handler.Measures()
+			var found bool
+			for _, measure := range measures {
+				if measureFieldName(measure) != metric.RequestsTotal {
+					continue
+				}
+				found = true
+				assert.Equal(t, []stats.Tag{
+					stats.T("method", http.MethodGet),
+					stats.T("route", tt.wantRoute),
+					stats.T("status", tt.wantStatus),
+				}, measure.Tags)
+			}
+			require.True(t, found, "no %s in %v", metric.RequestsTotal, measures)
+
+			assert.Equal(t, int64(0), lastGauge(measures, metric.RequestsInFlight))
+		})
+	}
+
+	assert.Equal(t, int64(1), inFlightInHandler)
+}
+
+// measureFieldName is the metric name of measure with single field
+func measureFieldName(measure stats.Measure) string {
+	return measure.Name + "." + measure.Fields[0].Name
+}
+
+// lastGauge value of name in measures, nil if not found
+func lastGauge(measures []stats.Measure, name string) (value interface{}) {
+	for _, measure := range measures {
+		if measureFieldName(measure) == name {
+			value = measure.Fields[0].Value.Interface()
+		}
+	}
+
+	return
+}
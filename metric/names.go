@@ -7,4 +7,29 @@ const (
 	RequestDuration   = "request.duration"
 	RequestSizeBytes  = "request.size.bytes"
 	ResponseSizeBytes = "response.size.bytes"
+	// RequestsInFlight is a gauge of requests being served
+	RequestsInFlight = "requests.in_flight"
+
+	// WebSocketConnections is a gauge of WebSocket connections
+	WebSocketConnections = "websocket.connections"
+	// WebSocketMessagesTotal counts WebSocket messages, tagged by direction
+	WebSocketMessagesTotal = "websocket.messages.total"
+)
+
+// Audit records saved to database
+const (
+	// AuditRecordsTotal counts audit records, tagged by result of written, failed or dropped
+	AuditRecordsTotal = "audit.records.total"
+	// AuditQueueLength is a gauge of audit records waiting to be saved
+	AuditQueueLength = "audit.queue.length"
+)
+
+// Overload protection
+const (
+	// RequestsShedTotal counts requests rejected by load shedding, tagged by route
+	RequestsShedTotal = "requests.shed.total"
+	// RequestsTimedOutTotal counts requests exceeding their deadline, tagged by route
+	RequestsTimedOutTotal = "requests.timed_out.total"
+	// ConcurrencyLimit is a gauge of in-flight requests allowed by load shedding
+	ConcurrencyLimit = "concurrency.limit"
 )
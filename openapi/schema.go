@@ -0,0 +1,329 @@
+package openapi
+
+import (
+	"encoding/json"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	durationType      = reflect.TypeOf(time.Duration(0))
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	rawMessageType    = reflect.TypeOf(json.RawMessage(nil))
+)
+
+// Generator reflects Go types into schemas,
+// named struct types go to components and are referenced,
+// use NewGenerator to create one.
+type Generator struct {
+	schemas map[string]*Schema
+	// names of struct types in schemas
+	names map[reflect.Type]string
+}
+
+// NewGenerator creates a Generator with no component
+func NewGenerator() *Generator {
+	return &Generator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+// Schemas generated for components
+func (g *Generator) Schemas() map[string]*Schema {
+	return g.schemas
+}
+
+// Define adds a hand-written schema to components, it returns a reference to it.
+func (g *Generator) Define(name string, schema *Schema) *Schema {
+	g.schemas[name] = schema
+	return RefTo(name)
+}
+
+// Schema of the type of v, which may be a value or a nil pointer of the type.
+// nil v means any value.
+func (g *Generator) Schema(v interface{}) *Schema {
+	if v == nil {
+		return &Schema{}
+	}
+
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+func (g *Generator) schemaOf(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		schema := g.schemaOf(t.Elem())
+		if schema.Ref == "" {
+			schema.Nullable = true
+		}
+		return schema
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+	case rawMessageType:
+		return &Schema{}
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		// can not tell what it marshals into
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return g.namedStructSchema(t)
+	default:
+		// interface and others
+		return &Schema{}
+	}
+}
+
+// namedStructSchema defines schema in components on first encounter,
+// which also copes with recursive types.
+func (g *Generator) namedStructSchema(t reflect.Type) *Schema {
+	if name, ok := g.names[t]; ok {
+		return RefTo(name)
+	}
+
+	name := componentName(t)
+	if _, taken := g.schemas[name]; taken {
+		// same name from another package
+		name = componentName(t) + "_" + path.Base(t.PkgPath())
+	}
+	g.names[t] = name
+	// placeholder for recursive reference
+	g.schemas[name] = &Schema{}
+	*g.schemas[name] = *g.structSchema(t)
+
+	return RefTo(name)
+}
+
+// componentName capitalizes type name, e.g. loginRequest becomes LoginRequest
+func componentName(t reflect.Type) string {
+	name := []rune(t.Name())
+	name[0] = unicode.ToUpper(name[0])
+	return string(name)
+}
+
+func (g *Generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+	g.addFields(schema, t)
+
+	return schema
+}
+
+// addFields adds fields of struct t to schema, embedded structs are flattened as encoding/json does.
+func (g *Generator) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, omitEmpty, ok := jsonName(field)
+		if !ok {
+			continue
+		}
+
+		fieldType := field.Type
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if fieldType.Kind() == reflect.Struct {
+				g.addFields(schema, fieldType)
+				continue
+			}
+		}
+
+		fieldSchema := g.schemaOf(fieldType)
+		// sibling keys of $ref are ignored by OpenAPI 3.0, keep them off
+		decorated := fieldSchema
+		if fieldSchema.Ref != "" {
+			decorated = &Schema{}
+		}
+		required := applyBindingRules(decorated, field.Tag.Get("binding"))
+		if description := field.Tag.Get("description"); description != "" {
+			decorated.Description = description
+		}
+		if example := field.Tag.Get("example"); example != "" {
+			decorated.Example = example
+		}
+
+		schema.Properties[name] = fieldSchema
+		if required && !omitEmpty {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// jsonName is the name field encodes to, ok is false if it's not encoded at all.
+func jsonName(field reflect.StructField) (name string, omitEmpty bool, ok bool) {
+	if field.PkgPath != "" && !field.Anonymous {
+		// unexported
+		return
+	}
+
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return
+	}
+
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitEmpty = true
+		}
+	}
+
+	ok = true
+	return
+}
+
+// applyBindingRules reflects some validator rules in schema,
+// it tells whether the field is required.
+func applyBindingRules(schema *Schema, binding string) (required bool) {
+	if binding == "" {
+		return
+	}
+
+	for _, rule := range strings.Split(binding, ",") {
+		name, param := rule, ""
+		if eq := strings.IndexByte(rule, '='); eq >= 0 {
+			name, param = rule[:eq], rule[eq+1:]
+		}
+
+		switch name {
+		case "dive":
+			// rules after dive apply to elements
+			return
+		case "required":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "url", "uri":
+			schema.Format = "uri"
+		case "uuid", "uuid4":
+			schema.Format = "uuid"
+		case "oneof":
+			for _, option := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, option)
+			}
+		case "min", "gte":
+			applyBound(schema, param, true)
+		case "max", "lte":
+			applyBound(schema, param, false)
+		case "len":
+			applyBound(schema, param, true)
+			applyBound(schema, param, false)
+		}
+	}
+
+	return
+}
+
+// applyBound sets length or value bound by schema type
+func applyBound(schema *Schema, param string, lower bool) {
+	value, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+
+	switch schema.Type {
+	case "string":
+		n := int(value)
+		if lower {
+			schema.MinLength = &n
+		} else {
+			schema.MaxLength = &n
+		}
+	case "array":
+		n := int(value)
+		if lower {
+			schema.MinItems = &n
+		} else {
+			schema.MaxItems = &n
+		}
+	case "integer", "number":
+		if lower {
+			schema.Minimum = &value
+		} else {
+			schema.Maximum = &value
+		}
+	}
+}
+
+// Parameters reflects fields of struct v tagged with form into parameters located in "in",
+// v may be a value or a nil pointer of the struct type.
+func (g *Generator) Parameters(v interface{}, in string) (params []*Parameter) {
+	if v == nil {
+		return
+	}
+
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.SplitN(field.Tag.Get("form"), ",", 2)[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := g.schemaOf(field.Type)
+		params = append(params, &Parameter{
+			Name:        name,
+			In:          in,
+			Description: field.Tag.Get("description"),
+			Required:    applyBindingRules(schema, field.Tag.Get("binding")),
+			Schema:      schema,
+		})
+	}
+
+	return
+}
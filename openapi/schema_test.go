@@ -0,0 +1,94 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testAudit struct {
+	CreatedAt time.Time  `json:"createdAt"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+type testNode struct {
+	testAudit
+	Name     string            `json:"name" binding:"required,max=32" description:"display name"`
+	Email    string            `json:"email" binding:"omitempty,email"`
+	Kind     string            `json:"kind" binding:"oneof=leaf branch"`
+	Weight   float64           `json:"weight" binding:"gte=0,lte=1"`
+	Children []*testNode       `json:"children" binding:"dive"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Secret   string            `json:"-"`
+	internal int
+}
+
+type testQuery struct {
+	Page     int    `form:"page" binding:"min=1"`
+	Keyword  string `form:"q" binding:"required" description:"search keyword"`
+	Internal string `form:"-"`
+}
+
+func TestGenerator_Schema(t *testing.T) {
+	g := NewGenerator()
+
+	ref := g.Schema(&testNode{})
+	assert.Equal(t, "#/components/schemas/TestNode", ref.Ref)
+
+	schema := g.Schemas()["TestNode"]
+	require.NotNil(t, schema)
+	assert.Equal(t, "object", schema.Type)
+	assert.Equal(t, []string{"name"}, schema.Required)
+	assert.ElementsMatch(t,
+		[]string{"createdAt", "deletedAt", "name", "email", "kind", "weight", "children", "labels"},
+		keys(schema.Properties))
+
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time"}, schema.Properties["createdAt"])
+	assert.Equal(t, &Schema{Type: "string", Format: "date-time", Nullable: true}, schema.Properties["deletedAt"])
+
+	name := schema.Properties["name"]
+	assert.Equal(t, "string", name.Type)
+	assert.Equal(t, "display name", name.Description)
+	require.NotNil(t, name.MaxLength)
+	assert.Equal(t, 32, *name.MaxLength)
+
+	assert.Equal(t, "email", schema.Properties["email"].Format)
+	assert.Equal(t, []interface{}{"leaf", "branch"}, schema.Properties["kind"].Enum)
+
+	weight := schema.Properties["weight"]
+	require.NotNil(t, weight.Minimum)
+	require.NotNil(t, weight.Maximum)
+	assert.Equal(t, 0.0, *weight.Minimum)
+	assert.Equal(t, 1.0, *weight.Maximum)
+
+	// recursive type is referenced
+	assert.Equal(t, &Schema{Type: "array", Items: RefTo("TestNode")}, schema.Properties["children"])
+	assert.Equal(t, &Schema{Type: "object", AdditionalProperties: &Schema{Type: "string"}}, schema.Properties["labels"])
+}
+
+func TestGenerator_Parameters(t *testing.T) {
+	g := NewGenerator()
+
+	params := g.Parameters(testQuery{}, InQuery)
+	require.Len(t, params, 2)
+
+	assert.Equal(t, "page", params[0].Name)
+	assert.Equal(t, InQuery, params[0].In)
+	assert.False(t, params[0].Required)
+	require.NotNil(t, params[0].Schema.Minimum)
+	assert.Equal(t, 1.0, *params[0].Schema.Minimum)
+
+	assert.Equal(t, "q", params[1].Name)
+	assert.True(t, params[1].Required)
+	assert.Equal(t, "search keyword", params[1].Description)
+}
+
+func keys(m map[string]*Schema) (keys []string) {
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	return
+}
@@ -0,0 +1,177 @@
+// Package storage keeps files uploaded by API users.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidKey is returned for keys escaping storage or being empty
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage keeps files by key, keys are slash separated paths like "2021/10/abc.png".
+type Storage interface {
+	// Put streams r into key, overwriting existing one.
+	// Nothing is left at key if it fails.
+	Put(ctx context.Context, key string, r io.Reader) (written int64, err error)
+	// Open reads file at key, err wraps os.ErrNotExist if there's none.
+	Open(ctx context.Context, key string) (file io.ReadCloser, err error)
+	// Delete removes file at key, it's fine if there's none.
+	Delete(ctx context.Context, key string) (err error)
+}
+
+// LocalConfig of storage on local disk
+type LocalConfig struct {
+	// Dir where files live, created if not exist
+	Dir string
+}
+
+// Local keeps files in a directory on local disk
+type Local struct {
+	dir string
+}
+
+// NewLocal creates storage in config.Dir
+func NewLocal(config LocalConfig) (local *Local, err error) {
+	if config.Dir == "" {
+		err = errors.New("storage directory is empty")
+		return
+	}
+
+	dir, err := filepath.Abs(config.Dir)
+	if err != nil {
+		err = fmt.Errorf("filepath.Abs: %w", err)
+		return
+	}
+	err = os.MkdirAll(dir, 0o750)
+	if err != nil {
+		err = fmt.Errorf("creating storage directory: %w", err)
+		return
+	}
+
+	local = &Local{dir: dir}
+	return
+}
+
+// Put writes r into a temporary file then renames it to key,
+// so that readers never see a partial file.
+func (l *Local) Put(ctx context.Context, key string, r io.Reader) (written int64, err error) {
+	path, err := l.path(key)
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0o750)
+	if err != nil {
+		err = fmt.Errorf("creating directory: %w", err)
+		return
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		err = fmt.Errorf("creating temporary file: %w", err)
+		return
+	}
+	defer func() {
+		if err != nil {
+			_ = temp.Close()
+			_ = os.Remove(temp.Name())
+		}
+	}()
+
+	written, err = io.Copy(temp, &contextReader{ctx: ctx, r: r})
+	if err != nil {
+		err = fmt.Errorf("writing file: %w", err)
+		return
+	}
+	err = temp.Sync()
+	if err != nil {
+		err = fmt.Errorf("syncing file: %w", err)
+		return
+	}
+	err = temp.Close()
+	if err != nil {
+		err = fmt.Errorf("closing file: %w", err)
+		return
+	}
+	err = os.Rename(temp.Name(), path)
+	if err != nil {
+		err = fmt.Errorf("renaming file: %w", err)
+		return
+	}
+
+	return
+}
+
+// Open opens file at key
+func (l *Local) Open(_ context.Context, key string) (file io.ReadCloser, err error) {
+	path, err := l.path(key)
+	if err != nil {
+		return
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		err = fmt.Errorf("opening file: %w", err)
+		return
+	}
+
+	return
+}
+
+// Delete removes file at key
+func (l *Local) Delete(_ context.Context, key string) (err error) {
+	path, err := l.path(key)
+	if err != nil {
+		return
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("removing file: %w", err)
+		return
+	}
+
+	return
+}
+
+// path of key on disk, which never escapes dir
+func (l *Local) path(key string) (path string, err error) {
+	if key == "" || strings.Contains(key, "\\") {
+		err = fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		return
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			err = fmt.Errorf("%w: %q", ErrInvalidKey, key)
+			return
+		}
+	}
+
+	path = filepath.Join(l.dir, filepath.FromSlash(key))
+	return
+}
+
+// contextReader stops reading once ctx is done, e.g. client is gone
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (n int, err error) {
+	err = r.ctx.Err()
+	if err != nil {
+		return
+	}
+
+	return r.r.Read(p)
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	local, err := NewLocal(LocalConfig{Dir: t.TempDir()})
+	require.NoError(t, err)
+
+	written, err := local.Put(ctx, "2021/10/hello.txt", strings.NewReader("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), written)
+
+	file, err := local.Open(ctx, "2021/10/hello.txt")
+	require.NoError(t, err)
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	assert.Equal(t, "hello", string(content))
+
+	require.NoError(t, local.Delete(ctx, "2021/10/hello.txt"))
+	require.NoError(t, local.Delete(ctx, "2021/10/hello.txt"))
+	_, err = local.Open(ctx, "2021/10/hello.txt")
+	assert.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestLocal_Put_failed(t *testing.T) {
+	dir := t.TempDir()
+	local, err := NewLocal(LocalConfig{Dir: dir})
+	require.NoError(t, err)
+
+	_, err = local.Put(context.Background(), "broken.bin", io.MultiReader(
+		strings.NewReader("partial"),
+		&errReader{err: io.ErrUnexpectedEOF},
+	))
+	assert.True(t, errors.Is(err, io.ErrUnexpectedEOF))
+
+	// neither file nor temporary one is left
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestLocal_path(t *testing.T) {
+	local := &Local{dir: filepath.FromSlash("/data")}
+
+	tests := []struct {
+		key     string
+		want    string
+		wantErr bool
+	}{
+		{key: "a/b.png", want: filepath.FromSlash("/data/a/b.png")},
+		{key: "", wantErr: true},
+		{key: "../etc/passwd", wantErr: true},
+		{key: "a/../../b", wantErr: true},
+		{key: "/etc/passwd", wantErr: true},
+		{key: "a//b", wantErr: true},
+		{key: `a\..\b`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := local.path(tt.key)
+			if tt.wantErr {
+				assert.True(t, errors.Is(err, ErrInvalidKey))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,175 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"telescope/version"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// exporters
+const (
+	// ExporterNone disables tracing, incoming trace context is still propagated.
+	ExporterNone = ""
+	// ExporterOTLP sends spans to an OpenTelemetry collector over OTLP/HTTP
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to stdout in JSON
+	ExporterStdout = "stdout"
+	// ExporterFile writes spans to a file in JSON
+	ExporterFile = "file"
+)
+
+// Config config on tracing
+type Config struct {
+	// Exporter is one of "otlp", "stdout" and "file", empty disables tracing
+	Exporter string
+	// ServiceName reported to backend, defaults to "telescope"
+	ServiceName string
+	// OTLPEndpoint host and port of OTLP/HTTP receiver, defaults to "localhost:4318"
+	OTLPEndpoint string
+	// OTLPInsecure uses plain HTTP instead of HTTPS
+	OTLPInsecure bool
+	// FilePath where the file exporter writes spans
+	FilePath string
+	// SampleRatio of new traces sampled, in (0, 1], defaults to 1.
+	// Incoming traces follow the sampling decision of the caller.
+	SampleRatio float64
+}
+
+// Tracer returns a tracer named after the instrumented component, e.g. "telescope/database".
+//
+// It's safe to be called before Setup, spans are forwarded once Setup is done.
+func Tracer(component string) trace.Tracer {
+	return otel.Tracer(component, trace.WithInstrumentationVersion(version.Version))
+}
+
+// Setup installs the global tracer provider and W3C trace context propagator.
+//
+// Call shutdown before exiting to flush pending spans.
+func Setup(ctx context.Context, config Config) (shutdown func(context.Context) error, err error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	shutdown = func(context.Context) error {
+		return nil
+	}
+
+	if config.Exporter == ExporterNone {
+		return
+	}
+
+	exporter, err := newExporter(ctx, config)
+	if err != nil {
+		err = fmt.Errorf("creating %s exporter: %w", config.Exporter, err)
+		return
+	}
+
+	serviceName := config.ServiceName
+	if serviceName == "" {
+		serviceName = version.Name
+	}
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(version.Version),
+	))
+	if err != nil {
+		err = fmt.Errorf("resource.Merge: %w", err)
+		return
+	}
+
+	sampleRatio := config.SampleRatio
+	if sampleRatio <= 0 || sampleRatio > 1 {
+		sampleRatio = 1
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		zap.L().Warn("tracing error", zap.Error(err))
+	}))
+
+	shutdown = provider.Shutdown
+	return
+}
+
+func newExporter(ctx context.Context, config Config) (exporter sdktrace.SpanExporter, err error) {
+	switch config.Exporter {
+	case ExporterOTLP:
+		opts := []otlptracehttp.Option{}
+		if config.OTLPEndpoint != "" {
+			opts = append(opts, otlptracehttp.WithEndpoint(config.OTLPEndpoint))
+		}
+		if config.OTLPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(ctx, opts...)
+	case ExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterFile:
+		if config.FilePath == "" {
+			err = fmt.Errorf("FilePath is required")
+			return
+		}
+		var file *os.File
+		file, err = os.OpenFile(config.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return
+		}
+		exporter = &closingExporter{SpanExporter: exporter, closer: file}
+	default:
+		err = fmt.Errorf("unknown exporter %q, want one of otlp, stdout and file", config.Exporter)
+	}
+
+	return
+}
+
+// closingExporter closes closer after shutting down exporter
+type closingExporter struct {
+	sdktrace.SpanExporter
+	closer io.Closer
+}
+
+func (e *closingExporter) Shutdown(ctx context.Context) error {
+	err := e.SpanExporter.Shutdown(ctx)
+	if closeErr := e.closer.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// LogFields returns trace ID and span ID of the span carried by ctx as zap fields,
+// or nil if there's no valid span.
+func LogFields(ctx context.Context) []zap.Field {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+
+	return []zap.Field{
+		zap.String("traceID", spanContext.TraceID().String()),
+		zap.String("spanID", spanContext.SpanID().String()),
+	}
+}